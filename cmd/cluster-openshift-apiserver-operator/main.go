@@ -12,7 +12,9 @@ import (
 	kmspreflight "github.com/openshift/library-go/pkg/operator/encryption/kms/preflight"
 
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/cmd/operator"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/cmd/render"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/cmd/resourcegraph"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/cmd/verifyencryption"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/encryptionstatusprovider"
 )
 
@@ -34,6 +36,8 @@ func NewSSCSCommand() *cobra.Command {
 
 	cmd.AddCommand(operator.NewOperator())
 	cmd.AddCommand(resourcegraph.NewResourceChainCommand())
+	cmd.AddCommand(render.NewRenderCommand())
+	cmd.AddCommand(verifyencryption.NewVerifyRouteEncryptionCommand())
 	cmd.AddCommand(kmshealth.NewCommand(context.Background(), encryptionstatusprovider.NewOpenShiftAPIServerEncryptionStatusProvider))
 	cmd.AddCommand(kmspreflight.NewCommand(context.Background()))
 
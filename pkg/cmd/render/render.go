@@ -0,0 +1,379 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/imdario/mergo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	corelistersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/openshift/api/features"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configlistersv1 "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceread"
+	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/configobservation"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/configobservation/configobservercontroller"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/v311_00_assets"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/workload"
+)
+
+var (
+	renderScheme = runtime.NewScheme()
+	renderCodecs = serializer.NewCodecFactory(renderScheme)
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(renderScheme))
+	utilruntime.Must(configv1.Install(renderScheme))
+	utilruntime.Must(operatorv1.Install(renderScheme))
+	utilruntime.Must(apiregistrationv1.AddToScheme(renderScheme))
+}
+
+type renderOpts struct {
+	operatorConfigFile  string
+	clusterVersionFile  string
+	infrastructureFile  string
+	featureGateFile     string
+	imageConfigFile     string
+	ingressConfigFile   string
+	projectConfigFile   string
+	proxyConfigFile     string
+	apiServerConfigFile string
+	additionalObjects   []string
+
+	image                      string
+	operatorImage              string
+	kubeAPIServerOperatorImage string
+	masterNodeCount            int32
+
+	outputDir string
+}
+
+// NewRenderCommand creates a command that renders the operand manifests from local files, without a cluster.
+func NewRenderCommand() *cobra.Command {
+	o := &renderOpts{
+		image:                      os.Getenv("IMAGE"),
+		operatorImage:              os.Getenv("OPERATOR_IMAGE"),
+		kubeAPIServerOperatorImage: os.Getenv("KUBE_APISERVER_OPERATOR_IMAGE"),
+		masterNodeCount:            3,
+	}
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "Render the openshift-apiserver manifests the operator would apply, from local input files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := o.Validate(); err != nil {
+				klog.Fatal(err)
+			}
+			if err := o.Run(context.Background()); err != nil {
+				klog.Fatal(err)
+			}
+		},
+	}
+	o.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func (o *renderOpts) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.operatorConfigFile, "operator-config", o.operatorConfigFile, "File containing the OpenShiftAPIServer 'cluster' resource.")
+	fs.StringVar(&o.clusterVersionFile, "cluster-version", o.clusterVersionFile, "File containing the ClusterVersion 'version' resource.")
+	fs.StringVar(&o.infrastructureFile, "infrastructure-config", o.infrastructureFile, "Optional file containing the infrastructures.config.openshift.io 'cluster' resource.")
+	fs.StringVar(&o.featureGateFile, "featuregate-config", o.featureGateFile, "Optional file containing the featuregates.config.openshift.io 'cluster' resource.")
+	fs.StringVar(&o.imageConfigFile, "image-config", o.imageConfigFile, "Optional file containing the images.config.openshift.io 'cluster' resource.")
+	fs.StringVar(&o.ingressConfigFile, "ingress-config", o.ingressConfigFile, "Optional file containing the ingresses.config.openshift.io 'cluster' resource.")
+	fs.StringVar(&o.projectConfigFile, "project-config", o.projectConfigFile, "Optional file containing the projects.config.openshift.io 'cluster' resource.")
+	fs.StringVar(&o.proxyConfigFile, "proxy-config", o.proxyConfigFile, "Optional file containing the proxies.config.openshift.io 'cluster' resource.")
+	fs.StringVar(&o.apiServerConfigFile, "apiserver-config", o.apiServerConfigFile, "Optional file containing the apiservers.config.openshift.io 'cluster' resource.")
+	fs.StringSliceVar(&o.additionalObjects, "additional-object", o.additionalObjects, "Optional files containing ConfigMaps, Secrets or Endpoints visible to the observers and the workload, e.g. the merged-trusted-image-registry-ca ConfigMap.")
+	fs.StringVar(&o.image, "image", o.image, "Pull spec of the openshift-apiserver image. Defaults to $IMAGE.")
+	fs.StringVar(&o.operatorImage, "operator-image", o.operatorImage, "Pull spec of the operator image. Defaults to $OPERATOR_IMAGE.")
+	fs.StringVar(&o.kubeAPIServerOperatorImage, "kube-apiserver-operator-image", o.kubeAPIServerOperatorImage, "Pull spec of the kube-apiserver-operator image used by check-endpoints. Defaults to $KUBE_APISERVER_OPERATOR_IMAGE.")
+	fs.Int32Var(&o.masterNodeCount, "master-node-count", o.masterNodeCount, "Number of master nodes, used as the deployment replica count.")
+	fs.StringVar(&o.outputDir, "output-dir", o.outputDir, "Directory the rendered manifests are written to.")
+}
+
+func (o *renderOpts) Validate() error {
+	if len(o.operatorConfigFile) == 0 {
+		return errors.New("missing required flag: --operator-config")
+	}
+	if len(o.clusterVersionFile) == 0 {
+		return errors.New("missing required flag: --cluster-version")
+	}
+	if len(o.image) == 0 {
+		return errors.New("missing required flag: --image")
+	}
+	if len(o.operatorImage) == 0 {
+		return errors.New("missing required flag: --operator-image")
+	}
+	if len(o.outputDir) == 0 {
+		return errors.New("missing required flag: --output-dir")
+	}
+	if o.masterNodeCount < 1 {
+		return fmt.Errorf("--master-node-count must be positive, got %d", o.masterNodeCount)
+	}
+	return nil
+}
+
+func (o *renderOpts) Run(ctx context.Context) error {
+	operatorConfig := &operatorv1.OpenShiftAPIServer{}
+	if err := readObject(o.operatorConfigFile, operatorConfig); err != nil {
+		return err
+	}
+	clusterVersion := &configv1.ClusterVersion{}
+	if err := readObject(o.clusterVersionFile, clusterVersion); err != nil {
+		return err
+	}
+
+	listers, imageConfig, existingObjects, err := o.listers()
+	if err != nil {
+		return err
+	}
+
+	// without an explicit FeatureGate, render what a default cluster would run
+	featureGateAccessor := featuregates.NewHardcodedFeatureGateAccess(nil, []configv1.FeatureGateName{features.FeatureGateKMSEncryption})
+	if len(o.featureGateFile) > 0 {
+		featureGate := &configv1.FeatureGate{}
+		if err := readObject(o.featureGateFile, featureGate); err != nil {
+			return err
+		}
+		featureGateAccessor, err = featuregates.NewHardcodedFeatureGateAccessFromFeatureGate(featureGate, clusterVersion.Status.Desired.Version)
+		if err != nil {
+			return err
+		}
+	}
+
+	observedConfig, err := observeConfig(listers, featureGateAccessor, operatorConfig.Spec.ObservedConfig.Raw)
+	if err != nil {
+		return err
+	}
+	operatorConfig.Spec.ObservedConfig.Raw = observedConfig
+
+	topology := configv1.HighlyAvailableTopologyMode
+	if len(o.infrastructureFile) > 0 {
+		infrastructure := &configv1.Infrastructure{}
+		if err := readObject(o.infrastructureFile, infrastructure); err != nil {
+			return err
+		}
+		if len(infrastructure.Status.ControlPlaneTopology) > 0 {
+			topology = infrastructure.Status.ControlPlaneTopology
+		}
+	}
+
+	// the deployment template reads this from the environment just like the operator does
+	if err := os.Setenv("KUBE_APISERVER_OPERATOR_IMAGE", o.kubeAPIServerOperatorImage); err != nil {
+		return err
+	}
+	rendered, err := workload.RenderOperand(ctx, workload.RenderInput{
+		OperatorConfig:        operatorConfig,
+		ClusterVersion:        clusterVersion,
+		ImageConfig:           imageConfig,
+		ExistingObjects:       existingObjects,
+		TargetImagePullSpec:   o.image,
+		OperatorImagePullSpec: o.operatorImage,
+		MasterNodeCount:       o.masterNodeCount,
+		ControlPlaneTopology:  topology,
+		FeatureGateAccessor:   featureGateAccessor,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(o.outputDir, 0755); err != nil {
+		return err
+	}
+	if err := writeObject(o.outputDir, "configmap-config.yaml", rendered.Config); err != nil {
+		return err
+	}
+	if err := writeObject(o.outputDir, "configmap-image-import-ca.yaml", rendered.ImageImportCA); err != nil {
+		return err
+	}
+	if err := writeObject(o.outputDir, "deployment-apiserver.yaml", rendered.Deployment); err != nil {
+		return err
+	}
+
+	if topology != configv1.SingleReplicaTopologyMode {
+		pdb := resourceread.ReadPodDisruptionBudgetV1OrDie(v311_00_assets.MustAsset("v3.11.0/openshift-apiserver/pdb.yaml"))
+		if err := writeObject(o.outputDir, "pdb-openshift-apiserver-pdb.yaml", pdb); err != nil {
+			return err
+		}
+	}
+
+	enabledAPIServices, _, err := operator.APIServices(clusterVersion)
+	if err != nil {
+		return err
+	}
+	for _, apiService := range enabledAPIServices {
+		if err := writeObject(o.outputDir, fmt.Sprintf("apiservice-%s.yaml", apiService.Name), apiService); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listers builds the listers the config observers read from the optional input files.
+func (o *renderOpts) listers() (configobservation.Listers, *configv1.Image, []runtime.Object, error) {
+	newIndexer := func() cache.Indexer {
+		return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	}
+	apiServerIndexer, imageIndexer, projectIndexer, proxyIndexer, ingressIndexer := newIndexer(), newIndexer(), newIndexer(), newIndexer(), newIndexer()
+	endpointsIndexer, configMapIndexer, secretIndexer := newIndexer(), newIndexer(), newIndexer()
+
+	var imageConfig *configv1.Image
+	for _, input := range []struct {
+		file    string
+		obj     runtime.Object
+		indexer cache.Indexer
+	}{
+		{file: o.apiServerConfigFile, obj: &configv1.APIServer{}, indexer: apiServerIndexer},
+		{file: o.imageConfigFile, obj: &configv1.Image{}, indexer: imageIndexer},
+		{file: o.projectConfigFile, obj: &configv1.Project{}, indexer: projectIndexer},
+		{file: o.proxyConfigFile, obj: &configv1.Proxy{}, indexer: proxyIndexer},
+		{file: o.ingressConfigFile, obj: &configv1.Ingress{}, indexer: ingressIndexer},
+	} {
+		if len(input.file) == 0 {
+			continue
+		}
+		if err := readObject(input.file, input.obj); err != nil {
+			return configobservation.Listers{}, nil, nil, err
+		}
+		if err := input.indexer.Add(input.obj); err != nil {
+			return configobservation.Listers{}, nil, nil, err
+		}
+		if image, ok := input.obj.(*configv1.Image); ok {
+			imageConfig = image
+		}
+	}
+
+	var existingObjects []runtime.Object
+	for _, file := range o.additionalObjects {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return configobservation.Listers{}, nil, nil, err
+		}
+		obj, _, err := renderCodecs.UniversalDeserializer().Decode(data, nil, nil)
+		if err != nil {
+			return configobservation.Listers{}, nil, nil, fmt.Errorf("unable to decode %s: %v", file, err)
+		}
+		switch obj.(type) {
+		case *corev1.ConfigMap:
+			err = configMapIndexer.Add(obj)
+		case *corev1.Secret:
+			err = secretIndexer.Add(obj)
+		case *corev1.Endpoints:
+			err = endpointsIndexer.Add(obj)
+		default:
+			err = fmt.Errorf("unsupported object %T in %s, only ConfigMaps, Secrets and Endpoints are supported", obj, file)
+		}
+		if err != nil {
+			return configobservation.Listers{}, nil, nil, err
+		}
+		existingObjects = append(existingObjects, obj)
+	}
+
+	return configobservation.Listers{
+		ResourceSync:        noopResourceSyncer{},
+		APIServerLister_:    configlistersv1.NewAPIServerLister(apiServerIndexer),
+		ImageConfigLister:   configlistersv1.NewImageLister(imageIndexer),
+		ProjectConfigLister: configlistersv1.NewProjectLister(projectIndexer),
+		ProxyLister_:        configlistersv1.NewProxyLister(proxyIndexer),
+		IngressConfigLister: configlistersv1.NewIngressLister(ingressIndexer),
+		EndpointsLister_:    corelistersv1.NewEndpointsLister(endpointsIndexer),
+		ConfigmapLister_:    corelistersv1.NewConfigMapLister(configMapIndexer),
+		SecretLister_:       corelistersv1.NewSecretLister(secretIndexer),
+	}, imageConfig, existingObjects, nil
+}
+
+// observeConfig runs all config observers once and merges their output the same way the config observer controller does.
+func observeConfig(listers configobservation.Listers, featureGateAccessor featuregates.FeatureGateAccess, existingRaw []byte) ([]byte, error) {
+	existingConfig := map[string]interface{}{}
+	if len(existingRaw) > 0 {
+		if err := json.NewDecoder(bytes.NewBuffer(existingRaw)).Decode(&existingConfig); err != nil {
+			klog.Warningf("decode of existing observedConfig failed with error: %v", err)
+		}
+	}
+
+	recorder := events.NewInMemoryRecorder("openshift-apiserver-render", clocktesting.NewFakePassiveClock(time.Now()))
+	var errs []error
+	mergedObservedConfig := map[string]interface{}{}
+	for _, observe := range configobservercontroller.Observers(featureGateAccessor) {
+		observedConfig, currErrs := observe(listers, recorder, existingConfig)
+		errs = append(errs, currErrs...)
+		if err := mergo.Merge(&mergedObservedConfig, observedConfig); err != nil {
+			errs = append(errs, fmt.Errorf("merging observed config failed: %v", err))
+		}
+	}
+	for _, err := range errs {
+		klog.Warningf("config observation: %v", err)
+	}
+
+	return json.Marshal(mergedObservedConfig)
+}
+
+func readObject(file string, into runtime.Object) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if _, _, err := renderCodecs.UniversalDeserializer().Decode(data, nil, into); err != nil {
+		return fmt.Errorf("unable to decode %s: %v", file, err)
+	}
+	return nil
+}
+
+func writeObject(dir, name string, obj runtime.Object) error {
+	gvks, _, err := renderScheme.ObjectKinds(obj)
+	if err != nil {
+		return err
+	}
+	obj = obj.DeepCopyObject()
+	obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, strings.ToLower(name))
+	klog.Infof("Writing %s", path)
+	return os.WriteFile(path, data, 0644)
+}
+
+// noopResourceSyncer satisfies the config observers that request resource synchronization,
+// there is nothing to synchronize when rendering.
+type noopResourceSyncer struct{}
+
+var _ resourcesynccontroller.ResourceSyncer = noopResourceSyncer{}
+
+func (noopResourceSyncer) SyncConfigMap(_, _ resourcesynccontroller.ResourceLocation) error {
+	return nil
+}
+
+func (noopResourceSyncer) SyncSecret(_, _ resourcesynccontroller.ResourceLocation) error {
+	return nil
+}
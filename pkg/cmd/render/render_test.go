@@ -0,0 +1,94 @@
+package render
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// TestRender renders the sample config in testdata and compares the manifests with the golden files in
+// testdata/golden. Run it with -update to regenerate them.
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name               string
+		infrastructureFile string
+		masterNodeCount    int32
+	}{
+		{
+			name:            "highly-available",
+			masterNodeCount: 3,
+		},
+		{
+			// without a PDB
+			name:               "single-replica",
+			infrastructureFile: "testdata/infrastructure-single-replica.yaml",
+			masterNodeCount:    1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &renderOpts{
+				operatorConfigFile:         "testdata/operator-config.yaml",
+				clusterVersionFile:         "testdata/cluster-version.yaml",
+				infrastructureFile:         tc.infrastructureFile,
+				imageConfigFile:            "testdata/image-config.yaml",
+				additionalObjects:          []string{"testdata/etcd-endpoints.yaml"},
+				image:                      "quay.io/openshift/openshift-apiserver:test",
+				operatorImage:              "quay.io/openshift/cluster-openshift-apiserver-operator:test",
+				kubeAPIServerOperatorImage: "quay.io/openshift/cluster-kube-apiserver-operator:test",
+				masterNodeCount:            tc.masterNodeCount,
+				outputDir:                  t.TempDir(),
+			}
+			if err := o.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if err := o.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "golden", tc.name)
+			if *update {
+				if err := os.RemoveAll(golden); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.CopyFS(golden, os.DirFS(o.outputDir)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rendered, expected := readDir(t, o.outputDir), readDir(t, golden)
+			if diff := cmp.Diff(expected, rendered); len(diff) > 0 {
+				t.Errorf("rendered manifests differ from %s, run the test with -update if this is expected:\n%s", golden, diff)
+			}
+		})
+	}
+}
+
+// readDir returns the content of the files in dir by their name.
+func readDir(t *testing.T, dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	files := map[string]string{}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(data)
+	}
+	return files
+}
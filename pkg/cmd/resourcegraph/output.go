@@ -0,0 +1,105 @@
+package resourcegraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gonum/graph/encoding/dot"
+
+	"github.com/openshift/library-go/pkg/operator/resource/resourcegraph"
+)
+
+var outputFormats = []string{"dot", "json", "mermaid"}
+
+// Marshal encodes the resource graph in one of the outputFormats.
+func Marshal(resources resourcegraph.Resources, format string) ([]byte, error) {
+	switch format {
+	case "dot":
+		return dot.Marshal(resources.NewGraph(), resourcegraph.Quote("openshift-apiserver-operator"), "", "  ", false)
+	case "json":
+		return json.MarshalIndent(newJSONGraph(resources), "", "  ")
+	case "mermaid":
+		return marshalMermaid(resources), nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %q, must be one of: %s", format, strings.Join(outputFormats, ", "))
+	}
+}
+
+type jsonGraph struct {
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+}
+
+type jsonNode struct {
+	ID        string `json:"id"`
+	Group     string `json:"group,omitempty"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Note      string `json:"note,omitempty"`
+}
+
+type jsonEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func newJSONGraph(resources resourcegraph.Resources) jsonGraph {
+	ret := jsonGraph{Nodes: []jsonNode{}, Edges: []jsonEdge{}}
+	for _, resource := range resources.AllResources() {
+		coordinates := resource.Coordinates()
+		ret.Nodes = append(ret.Nodes, jsonNode{
+			ID:        coordinates.String(),
+			Group:     coordinates.Group,
+			Resource:  coordinates.Resource,
+			Namespace: coordinates.Namespace,
+			Name:      coordinates.Name,
+			Note:      resource.GetNote(),
+		})
+		for _, source := range resource.Sources() {
+			ret.Edges = append(ret.Edges, jsonEdge{From: source.Coordinates().String(), To: coordinates.String()})
+		}
+	}
+	return ret
+}
+
+// marshalMermaid renders the graph as a mermaid flowchart. Mermaid node IDs are restricted, so nodes are numbered in
+// the order they were added and the coordinates go into the label.
+func marshalMermaid(resources resourcegraph.Resources) []byte {
+	allResources := resources.AllResources()
+	ids := map[resourcegraph.ResourceCoordinates]string{}
+	lines := []string{"flowchart LR"}
+	for i, resource := range allResources {
+		id := fmt.Sprintf("n%d", i)
+		ids[resource.Coordinates()] = id
+		lines = append(lines, fmt.Sprintf(`  %s["%s"]`, id, mermaidLabel(resource)))
+	}
+	for _, resource := range allResources {
+		for _, source := range resource.Sources() {
+			lines = append(lines, fmt.Sprintf("  %s --> %s", ids[source.Coordinates()], ids[resource.Coordinates()]))
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+func mermaidLabel(resource resourcegraph.Resource) string {
+	coordinates := resource.Coordinates()
+	kind := coordinates.Resource
+	if len(coordinates.Group) > 0 {
+		kind = kind + "." + coordinates.Group
+	}
+	parts := []string{kind, coordinates.Name}
+	if len(coordinates.Namespace) > 0 {
+		parts = append(parts, coordinates.Namespace)
+	}
+	if len(resource.GetNote()) > 0 {
+		parts = append(parts, resource.GetNote())
+	}
+	// mermaid labels are HTML, quotes and angle brackets have to be escaped
+	escape := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;")
+	for i := range parts {
+		parts[i] = escape.Replace(parts[i])
+	}
+	return strings.Join(parts, "<br/>")
+}
@@ -2,109 +2,208 @@ package resourcegraph
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
-	"github.com/gonum/graph/encoding/dot"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 
-	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+	libgoetcd "github.com/openshift/library-go/pkg/operator/configobserver/etcd"
 	"github.com/openshift/library-go/pkg/operator/resource/resourcegraph"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/configobservation/configobservercontroller"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/resourcesynccontroller"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/workload"
 )
 
 func NewResourceChainCommand() *cobra.Command {
+	output := "dot"
 	cmd := &cobra.Command{
 		Use:   "resource-graph",
 		Short: "Where do resources come from? Ask your mother.",
-		Run: func(cmd *cobra.Command, args []string) {
-			resources := Resources()
-			g := resources.NewGraph()
+		Long: `Print where the resources of openshift-apiserver come from.
 
-			data, err := dot.Marshal(g, resourcegraph.Quote("openshift-apiserver-operator"), "", "  ", false)
+The graph is built from the operator wiring: the inputs the config observers declare, the resource sync mappings with
+their producers, the revisioned resources, the volumes of the operand deployment and the resources hashed into it.
+The producers of the resources the operator only reads, e.g. which operator writes a config.openshift.io resource,
+and the inputs of the managed configmaps and secrets are declared by hand in this command.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := Marshal(Resources(), output)
 			if err != nil {
 				klog.Fatal(err)
 			}
-			fmt.Println(string(data))
+			fmt.Fprintln(os.Stdout, string(data))
 		},
 	}
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Output format. One of: "+strings.Join(outputFormats, "|"))
 
 	return cmd
 }
 
+// revisionSuffix stands in for the revision number in the names of revisioned resources.
+const revisionSuffix = "-N"
+
+// Resources builds the resource graph from the declarations the operator is wired with: the config observer inputs,
+// the resource sync mappings, the revision controller resources, the volumes of the operand deployment and the
+// resources hashed into it. Only the producers of resources this operator merely reads are described here.
 func Resources() resourcegraph.Resources {
 	ret := resourcegraph.NewResources()
+	g := &graphBuilder{resources: ret}
+
+	payload := g.resource(resourcegraph.NewCoordinates("", "Payload", "", "cluster"))
+	installer := g.resource(resourcegraph.NewCoordinates("", "Installer", "", "cluster"))
+	user := g.resource(resourcegraph.NewCoordinates("", "User", "", "cluster"))
 
-	payload := resourcegraph.NewResource(resourcegraph.NewCoordinates("", "Payload", "", "cluster")).
-		Add(ret)
-	installer := resourcegraph.NewResource(resourcegraph.NewCoordinates("", "Installer", "", "cluster")).
-		Add(ret)
-	user := resourcegraph.NewResource(resourcegraph.NewCoordinates("", "User", "", "cluster")).
-		Add(ret)
-
-	cvo := resourcegraph.NewOperator("cluster-version").
-		From(payload).
-		Add(ret)
-	serviceCAOperator := resourcegraph.NewOperator("service-ca").
-		From(cvo).
-		Add(ret)
-	imageRegistryOperator := resourcegraph.NewOperator("image-registry").
-		From(cvo).
-		Add(ret)
+	cvo := g.operator("cluster-version", payload)
+	serviceCAOperator := g.operator("service-ca", cvo)
+	imageRegistryOperator := g.operator("image-registry", cvo)
+	networkOperator := g.operator("network", cvo)
+	etcdOperator := g.operator("etcd", cvo)
+	thisOperator := g.operator("openshift-apiserver", cvo)
+
+	// the namespaces our informers watch
+	for _, namespace := range operator.WatchedNamespaces {
+		if len(namespace) == 0 {
+			continue
+		}
+		ns := g.resource(resourcegraph.NewCoordinates("", "namespaces", "", namespace), "Watched")
+		g.from(thisOperator, ns)
+	}
 
 	// config.openshift.io
-	imageConfig := resourcegraph.NewConfig("images").
-		From(user).
-		From(imageRegistryOperator).
-		Add(ret)
-	ingressConfig := resourcegraph.NewConfig("ingresses").
-		From(user).
-		From(installer).
-		Add(ret)
-	projectConfig := resourcegraph.NewConfig("projects").
-		From(user).
-		Add(ret)
-
-	// etcd certs
-	fromEtcdServingCA := resourcegraph.NewConfigMap("kube-system", "etcd-serving-ca").
-		Note("Static").
-		From(installer).
-		Add(ret)
-	fromEtcdClient := resourcegraph.NewSecret("kube-system", "etcd-client").
-		Note("Static").
-		From(installer).
-		Add(ret)
-	etcdServingCA := resourcegraph.NewConfigMap(operatorclient.TargetNamespace, "etcd-serving-ca").
-		Note("Synchronized").
-		From(fromEtcdServingCA).
-		Add(ret)
-	etcdClient := resourcegraph.NewSecret(operatorclient.TargetNamespace, "etcd-client").
-		Note("Synchronized").
-		From(fromEtcdClient).
-		Add(ret)
-
-	// serving cert
-	serviceCAController := resourcegraph.NewResource(resourcegraph.NewCoordinates("apps", "deployments", "openshift-service-cert-signer", "service-serving-cert-signer")).
-		From(serviceCAOperator).
-		Add(ret)
-	servingCert := resourcegraph.NewConfigMap(operatorclient.TargetNamespace, "serving-cert").
-		Note("Rotated").
-		From(serviceCAController).
-		Add(ret)
+	apiServerConfig := g.resource(configCoordinates("apiservers"))
+	imageConfig := g.resource(configCoordinates("images"))
+	proxyConfig := g.resource(configCoordinates("proxies"))
+	g.from(apiServerConfig, user)
+	g.from(imageConfig, user, imageRegistryOperator)
+	g.from(g.resource(configCoordinates("ingresses")), user, installer)
+	g.from(g.resource(configCoordinates("projects")), user)
+	g.from(proxyConfig, user, installer)
 
 	// observedConfig
-	config := resourcegraph.NewConfigMap(operatorclient.OperatorNamespace, "config").
-		Note("Managed").
-		From(imageConfig).   // to specify internal and external registries and trust
-		From(ingressConfig). // routing subdomain
-		From(projectConfig). // project request configuration
-		Add(ret)
-
-	// and finally our target pod
-	_ = resourcegraph.NewResource(resourcegraph.NewCoordinates("", "pods", operatorclient.TargetNamespace, "openshift-apiserver")).
-		From(etcdServingCA).
-		From(etcdClient).
-		From(servingCert).
-		From(config).
-		Add(ret)
+	operatorConfig := g.resource(resourcegraph.NewCoordinates("operator.openshift.io", "openshiftapiservers", "", "cluster"), "Observed")
+	for _, input := range configobservercontroller.ObservedInputs() {
+		observed := g.resource(resourcegraph.NewCoordinates(input.Group, input.Resource, input.Namespace, input.Name))
+		g.from(operatorConfig, observed)
+		if input.Namespace == libgoetcd.EtcdEndpointNamespace {
+			g.from(observed, etcdOperator)
+		}
+	}
+
+	// synchronized from other namespaces
+	for _, mapping := range resourcesynccontroller.ConfigMapSyncs {
+		source := g.resource(resourcegraph.NewCoordinates("", "configmaps", mapping.Source.Namespace, mapping.Source.Name))
+		g.from(source, g.operator(mapping.Producer, cvo))
+		g.from(g.resource(resourcegraph.NewCoordinates("", "configmaps", mapping.Destination.Namespace, mapping.Destination.Name), "Synchronized"), source)
+	}
+	for _, mapping := range resourcesynccontroller.SecretSyncs {
+		source := g.resource(resourcegraph.NewCoordinates("", "secrets", mapping.Source.Namespace, mapping.Source.Name))
+		g.from(source, g.operator(mapping.Producer, cvo))
+		g.from(g.resource(resourcegraph.NewCoordinates("", "secrets", mapping.Destination.Namespace, mapping.Destination.Name), "Synchronized"), source)
+	}
+
+	// managed by our own controllers
+	config := g.from(g.resource(resourcegraph.NewConfigMap(operatorclient.TargetNamespace, "config").Coordinates(), "Managed"), operatorConfig)
+	// mounted instead of config while rolled back to the known-good revision
+	knownGoodConfig := g.from(g.resource(resourcegraph.NewConfigMap(operatorclient.TargetNamespace, workload.KnownGoodConfigMapName).Coordinates(), "Snapshot"), config)
+	g.from(g.resource(resourcegraph.NewConfigMap(operatorclient.TargetNamespace, "image-import-ca").Coordinates(), "Managed"),
+		imageConfig,
+		g.from(g.resource(resourcegraph.NewConfigMap(operatorclient.GlobalMachineSpecifiedConfigNamespace, "merged-trusted-image-registry-ca").Coordinates()), imageRegistryOperator),
+		g.from(g.resource(resourcegraph.NewConfigMap(operatorclient.GlobalUserSpecifiedConfigNamespace, "<spec.additionalTrustedCA>").Coordinates()), user),
+	)
+	g.from(g.resource(resourcegraph.NewConfigMap(operatorclient.TargetNamespace, "trusted-ca-bundle").Coordinates(), "Injected"), networkOperator, proxyConfig)
+	g.from(g.resource(resourcegraph.NewConfigMap(operatorclient.TargetNamespace, "audit").Coordinates(), "Managed"), apiServerConfig)
+	g.from(g.resource(resourcegraph.NewSecret(operatorclient.TargetNamespace, "encryption-config").Coordinates(), "Managed"),
+		apiServerConfig,
+		g.from(g.resource(resourcegraph.NewSecret(operatorclient.GlobalMachineSpecifiedConfigNamespace, "encryption-key-openshift-apiserver"+revisionSuffix).Coordinates(), "Managed"), apiServerConfig),
+	)
+	g.from(g.resource(resourcegraph.NewSecret(operatorclient.TargetNamespace, "serving-cert").Coordinates(), "Rotated"), serviceCAOperator)
+
+	// revisioned copies
+	for _, revisioned := range operator.RevisionConfigMaps {
+		g.from(g.resource(resourcegraph.NewConfigMap(operatorclient.TargetNamespace, revisioned.Name+revisionSuffix).Coordinates(), "Revisioned"),
+			g.resource(resourcegraph.NewConfigMap(operatorclient.TargetNamespace, revisioned.Name).Coordinates()))
+	}
+	for _, revisioned := range operator.RevisionSecrets {
+		g.from(g.resource(resourcegraph.NewSecret(operatorclient.TargetNamespace, revisioned.Name+revisionSuffix).Coordinates(), "Revisioned"),
+			g.resource(resourcegraph.NewSecret(operatorclient.TargetNamespace, revisioned.Name).Coordinates()))
+	}
+
+	// and finally our target pod, which mounts the deployment volumes and is rolled out when a hashed input changes
+	deployment, err := workload.ReadDeploymentTemplate()
+	if err != nil {
+		// the template is compiled in, it is covered by the tests
+		panic(err)
+	}
+	pods := g.resource(resourcegraph.NewCoordinates("", "pods", operatorclient.TargetNamespace, deployment.Name))
+	for _, volume := range deployment.Spec.Template.Spec.Volumes {
+		switch {
+		case volume.ConfigMap != nil:
+			g.from(pods, g.resource(resourcegraph.NewConfigMap(operatorclient.TargetNamespace, revisionedName(volume.Name, volume.ConfigMap.Name)).Coordinates()))
+		case volume.Secret != nil:
+			g.from(pods, g.resource(resourcegraph.NewSecret(operatorclient.TargetNamespace, revisionedName(volume.Name, volume.Secret.SecretName)).Coordinates()))
+		}
+	}
+	for _, input := range workload.DeploymentInputs() {
+		hashed := g.resource(resourcegraph.NewCoordinates(input.Resource.Group, input.Resource.Resource, input.Namespace, input.Name))
+		g.from(pods, hashed)
+		if len(hashed.GetNote()) == 0 {
+			hashed.Note("Hashed")
+		} else if !strings.Contains(hashed.GetNote(), "Hashed") {
+			hashed.Note(hashed.GetNote() + ", Hashed")
+		}
+	}
+	g.from(pods, knownGoodConfig, thisOperator)
 
 	return ret
 }
+
+func configCoordinates(resource string) resourcegraph.ResourceCoordinates {
+	return resourcegraph.NewConfig(resource).Coordinates()
+}
+
+func revisionedName(volume, name string) string {
+	if workload.RevisionedVolumes.Has(volume) {
+		return name + revisionSuffix
+	}
+	return name
+}
+
+// graphBuilder adds resources and edges to a graph at most once, so that the same resource can be reached through
+// several declarations.
+type graphBuilder struct {
+	resources resourcegraph.Resources
+}
+
+func (g *graphBuilder) resource(coordinates resourcegraph.ResourceCoordinates, note ...string) resourcegraph.Resource {
+	r := g.resources.Resource(coordinates)
+	if r == nil {
+		r = resourcegraph.NewResource(coordinates).Add(g.resources)
+	}
+	if len(note) > 0 && len(r.GetNote()) == 0 {
+		r.Note(strings.Join(note, ", "))
+	}
+	return r
+}
+
+func (g *graphBuilder) operator(name string, sources ...resourcegraph.Resource) resourcegraph.Resource {
+	return g.from(g.resource(resourcegraph.NewOperator(name).Coordinates()), sources...)
+}
+
+func (g *graphBuilder) from(r resourcegraph.Resource, sources ...resourcegraph.Resource) resourcegraph.Resource {
+	for _, source := range sources {
+		known := false
+		for _, existing := range r.Sources() {
+			if existing.Coordinates() == source.Coordinates() {
+				known = true
+				break
+			}
+		}
+		if !known {
+			r.From(source)
+		}
+	}
+	return r
+}
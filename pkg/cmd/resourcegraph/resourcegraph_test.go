@@ -0,0 +1,96 @@
+package resourcegraph
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/openshift/library-go/pkg/operator/resource/resourcegraph"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/resourcesynccontroller"
+)
+
+func TestResources(t *testing.T) {
+	resources := Resources()
+
+	for _, coordinates := range []resourcegraph.ResourceCoordinates{
+		resourcegraph.NewConfigMap(operatorclient.TargetNamespace, "trusted-ca-bundle").Coordinates(),
+		resourcegraph.NewConfigMap(operatorclient.TargetNamespace, "image-import-ca").Coordinates(),
+		resourcegraph.NewConfigMap(operatorclient.TargetNamespace, "audit-N").Coordinates(),
+		resourcegraph.NewSecret(operatorclient.TargetNamespace, "encryption-config-N").Coordinates(),
+		resourcegraph.NewSecret(operatorclient.TargetNamespace, "serving-cert").Coordinates(),
+	} {
+		pods := resources.Resource(resourcegraph.NewCoordinates("", "pods", operatorclient.TargetNamespace, "apiserver"))
+		if pods == nil {
+			t.Fatal("missing operand pods")
+		}
+		found := false
+		for _, source := range pods.Sources() {
+			if source.Coordinates() == coordinates {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected the operand pods to come from %v", coordinates)
+		}
+	}
+
+	for _, mapping := range append(resourcesynccontroller.ConfigMapSyncs, resourcesynccontroller.SecretSyncs...) {
+		found := false
+		for _, source := range resources.AllResources() {
+			if source.Coordinates().Namespace != mapping.Source.Namespace || source.Coordinates().Name != mapping.Source.Name {
+				continue
+			}
+			for _, producer := range source.Sources() {
+				if producer.Coordinates() == resourcegraph.NewOperator(mapping.Producer).Coordinates() {
+					found = true
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected %s/%s to come from the %s operator", mapping.Source.Namespace, mapping.Source.Name, mapping.Producer)
+		}
+	}
+
+	for _, coordinates := range []resourcegraph.ResourceCoordinates{
+		resourcegraph.NewConfig("proxies").Coordinates(),
+		resourcegraph.NewConfig("apiservers").Coordinates(),
+		resourcegraph.NewCoordinates("", "namespaces", "", "openshift-oauth-apiserver"),
+	} {
+		if resources.Resource(coordinates) == nil {
+			t.Errorf("missing %v", coordinates)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	resources := Resources()
+
+	data, err := Marshal(resources, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := jsonGraph{}
+	if err := json.Unmarshal(data, &graph); err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Nodes) != len(resources.AllResources()) {
+		t.Errorf("expected %d nodes, got %d", len(resources.AllResources()), len(graph.Nodes))
+	}
+
+	data, err = Marshal(resources, "mermaid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "flowchart LR\n") {
+		t.Errorf("unexpected mermaid output: %s", data)
+	}
+
+	if _, err := Marshal(resources, "dot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Marshal(resources, "svg"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,281 @@
+package verifyencryption
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	corev1 "k8s.io/api/core/v1"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
+)
+
+const (
+	// keyBucket is the bucket etcd keeps the revisions of all keys in, keyed by revision.
+	keyBucket = "key"
+	// revisionBytesLen is the length of a revision in keyBucket, a tombstone has a trailing 't'.
+	revisionBytesLen = 17
+
+	// encryptedPrefix starts values written through an encryption provider, followed by <provider>:<version>:<key name>:.
+	encryptedPrefix = "k8s:enc:"
+)
+
+// Entry statuses of the report.
+const (
+	// Unencrypted values were written through the identity provider.
+	Unencrypted = "Unencrypted"
+	// StaleKey values are encrypted with a read key of the encryption configuration, but not with the write key.
+	StaleKey = "StaleKey"
+	// UnknownKey values are encrypted with a key that is not in the encryption configuration, so they can't be read.
+	UnknownKey = "UnknownKey"
+)
+
+// Report is the result of the verification, written as JSON.
+type Report struct {
+	Prefix   string `json:"prefix"`
+	Resource string `json:"resource"`
+	// WriteKey is the provider and key new values are encrypted with, e.g. aescbc:v1:2, or identity.
+	WriteKey string `json:"writeKey"`
+	// Total counts the live keys below the prefix, Verified the ones stored as the write key stores them.
+	Total    int     `json:"total"`
+	Verified int     `json:"verified"`
+	Entries  []Entry `json:"entries"`
+}
+
+// Entry is a key that isn't stored as the write key stores it.
+type Entry struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	// Provider is the provider, version and key name of an encrypted value, e.g. aescbc:v1:1.
+	Provider string `json:"provider,omitempty"`
+}
+
+type verifyOpts struct {
+	snapshotFile         string
+	encryptionConfigFile string
+	prefix               string
+	resource             string
+}
+
+// NewVerifyRouteEncryptionCommand creates a command that checks how the routes in an etcd snapshot are encrypted,
+// without a cluster.
+func NewVerifyRouteEncryptionCommand() *cobra.Command {
+	o := &verifyOpts{
+		prefix:   "/openshift.io/routes/",
+		resource: "routes.route.openshift.io",
+	}
+	cmd := &cobra.Command{
+		Use:   "verify-route-encryption",
+		Short: "Report the routes of an etcd snapshot that aren't encrypted with the write key of an encryption-config secret",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := o.Validate(); err != nil {
+				klog.Fatal(err)
+			}
+			report, err := o.Run()
+			if err != nil {
+				klog.Fatal(err)
+			}
+			if err := writeReport(os.Stdout, report); err != nil {
+				klog.Fatal(err)
+			}
+			if len(report.Entries) > 0 {
+				klog.Fatalf("%d of %d keys below %s are not encrypted with %s", len(report.Entries), report.Total, report.Prefix, report.WriteKey)
+			}
+		},
+	}
+	o.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func (o *verifyOpts) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.snapshotFile, "snapshot", o.snapshotFile, "etcd snapshot, e.g. from 'etcdctl snapshot save', or the bbolt db file of an etcd member.")
+	fs.StringVar(&o.encryptionConfigFile, "encryption-config", o.encryptionConfigFile, "File containing the encryption-config secret in use, e.g. openshift-config-managed/encryption-config-openshift-apiserver.")
+	fs.StringVar(&o.prefix, "prefix", o.prefix, "etcd key prefix of the resource.")
+	fs.StringVar(&o.resource, "resource", o.resource, "Resource in the encryption configuration the keys below the prefix belong to.")
+}
+
+func (o *verifyOpts) Validate() error {
+	if len(o.snapshotFile) == 0 {
+		return fmt.Errorf("--snapshot is required")
+	}
+	if len(o.encryptionConfigFile) == 0 {
+		return fmt.Errorf("--encryption-config is required")
+	}
+	if len(o.prefix) == 0 || len(o.resource) == 0 {
+		return fmt.Errorf("--prefix and --resource must not be empty")
+	}
+	return nil
+}
+
+func (o *verifyOpts) Run() (*Report, error) {
+	providers, err := o.readProviders()
+	if err != nil {
+		return nil, err
+	}
+	values, err := readLatestValues(o.snapshotFile, o.prefix)
+	if err != nil {
+		return nil, err
+	}
+	return verify(o.prefix, o.resource, providers, values), nil
+}
+
+// readProviders returns the providers of the resource in the encryption configuration of the secret, the write
+// provider first.
+func (o *verifyOpts) readProviders() ([]apiserverv1.ProviderConfiguration, error) {
+	data, err := os.ReadFile(o.encryptionConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{}
+	if err := yaml.Unmarshal(data, secret); err != nil {
+		return nil, fmt.Errorf("failed to decode the secret in %s: %v", o.encryptionConfigFile, err)
+	}
+	config, err := encryptiondata.FromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.Encryption == nil {
+		return nil, fmt.Errorf("%s has no %s key", o.encryptionConfigFile, encryptiondata.EncryptionConfSecretKey)
+	}
+	for _, resourceConfig := range config.Encryption.Resources {
+		for _, resource := range resourceConfig.Resources {
+			if resource == o.resource {
+				return resourceConfig.Providers, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("the encryption configuration in %s has no providers for %s", o.encryptionConfigFile, o.resource)
+}
+
+// readLatestValues returns the value of the latest revision of every live key below the prefix. The snapshot is
+// opened read-only.
+func readLatestValues(snapshotFile, prefix string) (map[string][]byte, error) {
+	if _, err := os.Stat(snapshotFile); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(snapshotFile, 0400, &bolt.Options{ReadOnly: true, Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", snapshotFile, err)
+	}
+	defer db.Close()
+
+	values := map[string][]byte{}
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(keyBucket))
+		if bucket == nil {
+			return fmt.Errorf("%s has no %q bucket, is it an etcd snapshot?", snapshotFile, keyBucket)
+		}
+		// revisions are sorted in ascending order, so later ones replace earlier ones
+		return bucket.ForEach(func(revision, data []byte) error {
+			kv := &mvccpb.KeyValue{}
+			if err := kv.Unmarshal(data); err != nil {
+				return fmt.Errorf("failed to decode revision %x: %v", revision, err)
+			}
+			key := string(kv.Key)
+			if !strings.HasPrefix(key, prefix) {
+				return nil
+			}
+			if len(revision) > revisionBytesLen && revision[revisionBytesLen] == 't' {
+				delete(values, key)
+				return nil
+			}
+			values[key] = kv.Value
+			return nil
+		})
+	})
+	return values, err
+}
+
+// verify compares the values with the prefix the write provider stores them with.
+func verify(prefix, resource string, providers []apiserverv1.ProviderConfiguration, values map[string][]byte) *Report {
+	readKeys := []string{}
+	for _, provider := range providers {
+		readKeys = append(readKeys, providerKeys(provider)...)
+	}
+	writeKey := "identity"
+	if len(readKeys) > 0 && providers[0].Identity == nil {
+		writeKey = readKeys[0]
+	}
+
+	report := &Report{Prefix: prefix, Resource: resource, WriteKey: writeKey, Total: len(values), Entries: []Entry{}}
+	for key, value := range values {
+		status, provider := "", ""
+		if bytes.HasPrefix(value, []byte(encryptedPrefix)) {
+			provider = valueProvider(value)
+			switch {
+			case provider == writeKey:
+			case slices.Contains(readKeys, provider):
+				status = StaleKey
+			default:
+				status = UnknownKey
+			}
+		} else if writeKey != "identity" {
+			status = Unencrypted
+		}
+		if len(status) == 0 {
+			report.Verified++
+			continue
+		}
+		report.Entries = append(report.Entries, Entry{Key: key, Status: status, Provider: provider})
+	}
+	sort.Slice(report.Entries, func(i, j int) bool { return report.Entries[i].Key < report.Entries[j].Key })
+	return report
+}
+
+// providerKeys returns the keys of the provider as <provider>:<version>:<key name>, the way they prefix values.
+func providerKeys(provider apiserverv1.ProviderConfiguration) []string {
+	keys := []string{}
+	addKeys := func(name string, configuredKeys []apiserverv1.Key) {
+		for _, key := range configuredKeys {
+			keys = append(keys, fmt.Sprintf("%s:v1:%s", name, key.Name))
+		}
+	}
+	switch {
+	case provider.AESCBC != nil:
+		addKeys("aescbc", provider.AESCBC.Keys)
+	case provider.AESGCM != nil:
+		addKeys("aesgcm", provider.AESGCM.Keys)
+	case provider.Secretbox != nil:
+		addKeys("secretbox", provider.Secretbox.Keys)
+	case provider.KMS != nil:
+		version := provider.KMS.APIVersion
+		if len(version) == 0 {
+			version = "v1"
+		}
+		keys = append(keys, fmt.Sprintf("kms:%s:%s", version, provider.KMS.Name))
+	}
+	return keys
+}
+
+// valueProvider returns <provider>:<version>:<key name> of a value starting with k8s:enc:.
+func valueProvider(value []byte) string {
+	parts := strings.SplitN(strings.TrimPrefix(string(value), encryptedPrefix), ":", 4)
+	if len(parts) < 4 {
+		return strings.Join(parts, ":")
+	}
+	return strings.Join(parts[:3], ":")
+}
+
+func writeReport(w io.Writer, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
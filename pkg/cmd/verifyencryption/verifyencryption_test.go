@@ -0,0 +1,147 @@
+package verifyencryption
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
+
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+
+	snapshotFile := filepath.Join(dir, "snapshot.db")
+	writeSnapshot(t, snapshotFile, []revision{
+		{key: "/openshift.io/routes/a/current", value: "k8s:enc:aescbc:v1:2:ciphertext"},
+		{key: "/openshift.io/routes/a/stale", value: "k8s:enc:aescbc:v1:1:ciphertext"},
+		{key: "/openshift.io/routes/b/plain", value: "k8s:enc:aescbc:v1:2:ciphertext"},
+		{key: "/openshift.io/routes/b/plain", value: `{"kind":"Route"}`},
+		{key: "/openshift.io/routes/b/unknown", value: "k8s:enc:aesgcm:v1:7:ciphertext"},
+		{key: "/openshift.io/routes/c/deleted", value: `{"kind":"Route"}`},
+		{key: "/openshift.io/routes/c/deleted", tombstone: true},
+		{key: "/openshift.io/templates/a/plain", value: `{"kind":"Template"}`},
+	})
+
+	config := &encryptiondata.Config{Encryption: &apiserverv1.EncryptionConfiguration{
+		Resources: []apiserverv1.ResourceConfiguration{{
+			Resources: []string{"routes.route.openshift.io"},
+			Providers: []apiserverv1.ProviderConfiguration{
+				{AESCBC: &apiserverv1.AESConfiguration{Keys: []apiserverv1.Key{
+					{Name: "2", Secret: "NzFlYTdjOTE0MTlhNjhmZDEyMjRmODhkNTAzMTZiNGU="},
+					{Name: "1", Secret: "ZGU0NmQ5NzAyOTQ2YjkzNGY4YzJkYjE3ZmY0N2NjNjI="},
+				}}},
+				{Identity: &apiserverv1.IdentityConfiguration{}},
+			},
+		}},
+	}}
+	secret, err := encryptiondata.ToSecret("openshift-config-managed", "encryption-config-openshift-apiserver", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretData, err := yaml.Marshal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptionConfigFile := filepath.Join(dir, "encryption-config.yaml")
+	if err := os.WriteFile(encryptionConfigFile, secretData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &verifyOpts{
+		snapshotFile:         snapshotFile,
+		encryptionConfigFile: encryptionConfigFile,
+		prefix:               "/openshift.io/routes/",
+		resource:             "routes.route.openshift.io",
+	}
+	if err := o.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := o.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Report{
+		Prefix:   "/openshift.io/routes/",
+		Resource: "routes.route.openshift.io",
+		WriteKey: "aescbc:v1:2",
+		Total:    4,
+		Verified: 1,
+		Entries: []Entry{
+			{Key: "/openshift.io/routes/a/stale", Status: StaleKey, Provider: "aescbc:v1:1"},
+			{Key: "/openshift.io/routes/b/plain", Status: Unencrypted},
+			{Key: "/openshift.io/routes/b/unknown", Status: UnknownKey, Provider: "aesgcm:v1:7"},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %#v, got %#v", expected, report)
+	}
+
+	o.resource = "templates.template.openshift.io"
+	if _, err := o.Run(); err == nil {
+		t.Errorf("expected an error for a resource without providers")
+	}
+}
+
+func TestVerifyIdentity(t *testing.T) {
+	providers := []apiserverv1.ProviderConfiguration{
+		{Identity: &apiserverv1.IdentityConfiguration{}},
+		{AESCBC: &apiserverv1.AESConfiguration{Keys: []apiserverv1.Key{{Name: "1"}}}},
+	}
+	report := verify("/openshift.io/routes/", "routes.route.openshift.io", providers, map[string][]byte{
+		"/openshift.io/routes/a/plain":     []byte(`{"kind":"Route"}`),
+		"/openshift.io/routes/a/encrypted": []byte("k8s:enc:aescbc:v1:1:ciphertext"),
+	})
+	expected := []Entry{{Key: "/openshift.io/routes/a/encrypted", Status: StaleKey, Provider: "aescbc:v1:1"}}
+	if report.WriteKey != "identity" || report.Verified != 1 || !reflect.DeepEqual(report.Entries, expected) {
+		t.Errorf("unexpected report %#v", report)
+	}
+}
+
+type revision struct {
+	key, value string
+	tombstone  bool
+}
+
+// writeSnapshot writes the revisions to the key bucket of a bbolt db the way etcd stores them.
+func writeSnapshot(t *testing.T, file string, revisions []revision) {
+	db, err := bolt.Open(file, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte(keyBucket))
+		if err != nil {
+			return err
+		}
+		for i, r := range revisions {
+			revision := make([]byte, revisionBytesLen, revisionBytesLen+1)
+			binary.BigEndian.PutUint64(revision, uint64(i+1))
+			revision[8] = '_'
+			if r.tombstone {
+				revision = append(revision, 't')
+			}
+			data, err := (&mvccpb.KeyValue{Key: []byte(r.key), Value: []byte(r.value), ModRevision: int64(i + 1)}).Marshal()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(revision, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
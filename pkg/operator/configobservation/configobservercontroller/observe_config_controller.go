@@ -1,6 +1,8 @@
 package configobservercontroller
 
 import (
+	"bytes"
+	"encoding/json"
 	"slices"
 
 	configv1 "github.com/openshift/api/config/v1"
@@ -10,6 +12,7 @@ import (
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/configobservation/images"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/configobservation/ingresses"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/configobservation/project"
+	operatormetrics "github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/metrics"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
 	"github.com/openshift/library-go/pkg/controller/factory"
 	"github.com/openshift/library-go/pkg/operator/configobserver"
@@ -17,6 +20,7 @@ import (
 	libgoetcd "github.com/openshift/library-go/pkg/operator/configobserver/etcd"
 	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
 	"github.com/openshift/library-go/pkg/operator/configobserver/proxy"
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
 	"github.com/openshift/library-go/pkg/operator/encryption/observer"
 	"github.com/openshift/library-go/pkg/operator/events"
 	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
@@ -26,6 +30,20 @@ import (
 	"k8s.io/client-go/tools/cache"
 )
 
+// ObservedInputs returns the resources the config observers read through the listers handed to them in
+// NewConfigObserver, as declared by the observers.
+func ObservedInputs() []configv1.ObjectReference {
+	inputs := []configv1.ObjectReference{}
+	for _, named := range namedObservers(nil) {
+		for _, input := range named.inputs {
+			if !slices.Contains(inputs, input) {
+				inputs = append(inputs, input)
+			}
+		}
+	}
+	return inputs
+}
+
 // NewConfigObserver initializes a new configuration observer.
 func NewConfigObserver(
 	kubeInformers kubeinformers.SharedInformerFactory,
@@ -37,6 +55,10 @@ func NewConfigObserver(
 	featureGateAccessor featuregates.FeatureGateAccess,
 	eventRecorder events.Recorder,
 ) factory.Controller {
+	observers := []configobserver.ObserveConfigFunc{}
+	for _, named := range namedObservers(featureGateAccessor) {
+		observers = append(observers, countChanges(named.name, named.observe))
+	}
 	c := configobserver.NewConfigObserver(
 		"openshift-apiserver",
 		operatorClient,
@@ -64,26 +86,83 @@ func NewConfigObserver(
 			},
 		},
 		[]factory.Informer{operatorConfigInformers.Operator().V1().OpenShiftAPIServers().Informer()},
-		images.ObserveImagestreamImportMode,
-		images.ObserveInternalRegistryHostname,
-		images.ObserveExternalRegistryHostnames,
-		images.ObserveAllowedRegistriesForImport,
-		ingresses.ObserveIngressDomain,
-		libgoetcd.ObserveStorageURLs,
-		libgoapiserver.ObserveTLSSecurityProfile,
-		project.ObserveProjectRequestMessage,
-		project.ObserveProjectRequestTemplateName,
-		proxy.NewProxyObserveFunc([]string{"workloadcontroller", "proxy"}),
-		observer.NewEncryptionConfigObserver(operatorclient.TargetNamespace, "/var/run/secrets/encryption-config/encryption-config"),
-		featuregates.NewObserveFeatureFlagsFunc(
+		observers...,
+	)
+
+	return c
+}
+
+// Observers returns the config observer functions whose merged output forms the observedConfig of the
+// openshift-apiserver. It is shared between the operator and the offline render command.
+func Observers(featureGateAccessor featuregates.FeatureGateAccess) []configobserver.ObserveConfigFunc {
+	observers := []configobserver.ObserveConfigFunc{}
+	for _, named := range namedObservers(featureGateAccessor) {
+		observers = append(observers, named.observe)
+	}
+	return observers
+}
+
+// namedObserver is a config observer with the name it is reported by in the metrics and the resources it reads,
+// TestObservedInputs fails when an observer reads a resource it doesn't declare.
+type namedObserver struct {
+	name    string
+	observe configobserver.ObserveConfigFunc
+	inputs  []configv1.ObjectReference
+}
+
+var (
+	apiServerInput = configv1.ObjectReference{Group: configv1.GroupName, Resource: "apiservers", Name: "cluster"}
+	imageInput     = configv1.ObjectReference{Group: configv1.GroupName, Resource: "images", Name: "cluster"}
+	ingressInput   = configv1.ObjectReference{Group: configv1.GroupName, Resource: "ingresses", Name: "cluster"}
+	projectInput   = configv1.ObjectReference{Group: configv1.GroupName, Resource: "projects", Name: "cluster"}
+	proxyInput     = configv1.ObjectReference{Group: configv1.GroupName, Resource: "proxies", Name: "cluster"}
+)
+
+func namedObservers(featureGateAccessor featuregates.FeatureGateAccess) []namedObserver {
+	return []namedObserver{
+		{"ImagestreamImportMode", images.ObserveImagestreamImportMode, []configv1.ObjectReference{imageInput}},
+		{"InternalRegistryHostname", images.ObserveInternalRegistryHostname, []configv1.ObjectReference{imageInput}},
+		{"ExternalRegistryHostnames", images.ObserveExternalRegistryHostnames, []configv1.ObjectReference{imageInput}},
+		{"AllowedRegistriesForImport", images.ObserveAllowedRegistriesForImport, []configv1.ObjectReference{imageInput}},
+		{"IngressDomain", ingresses.ObserveIngressDomain, []configv1.ObjectReference{ingressInput}},
+		{"StorageURLs", libgoetcd.ObserveStorageURLs, []configv1.ObjectReference{
+			{Resource: "configmaps", Namespace: libgoetcd.EtcdEndpointNamespace, Name: "etcd-endpoints"},
+			// read when etcd-endpoints is missing
+			{Resource: "endpoints", Namespace: libgoetcd.EtcdEndpointNamespace, Name: libgoetcd.EtcdEndpointName},
+		}},
+		{"TLSSecurityProfile", libgoapiserver.ObserveTLSSecurityProfile, []configv1.ObjectReference{apiServerInput}},
+		{"ProjectRequestMessage", project.ObserveProjectRequestMessage, []configv1.ObjectReference{projectInput}},
+		{"ProjectRequestTemplateName", project.ObserveProjectRequestTemplateName, []configv1.ObjectReference{projectInput}},
+		{"Proxy", proxy.NewProxyObserveFunc([]string{"workloadcontroller", "proxy"}), []configv1.ObjectReference{proxyInput}},
+		{"EncryptionConfig", observer.NewEncryptionConfigObserver(operatorclient.TargetNamespace, "/var/run/secrets/encryption-config/encryption-config"), []configv1.ObjectReference{
+			{Resource: "secrets", Namespace: operatorclient.TargetNamespace, Name: encryptiondata.EncryptionConfSecretName},
+		}},
+		// the feature gates are read through the FeatureGateAccess, not through the listers
+		{"FeatureFlags", featuregates.NewObserveFeatureFlagsFunc(
 			nil,
 			nil,
 			[]string{"apiServerArguments", "feature-gates"},
 			newFeatureGateAccessWithWatchListDisabled(featureGateAccessor),
-		),
-	)
+		), nil},
+	}
+}
 
-	return c
+// countChanges counts the changes of the config observed by observe in the metrics. The first observation is not a
+// change, the config it observes was observed before the operator started.
+func countChanges(name string, observe configobserver.ObserveConfigFunc) configobserver.ObserveConfigFunc {
+	var last []byte
+	return func(listers configobserver.Listers, recorder events.Recorder, existingConfig map[string]interface{}) (map[string]interface{}, []error) {
+		observedConfig, errs := observe(listers, recorder, existingConfig)
+		encoded, err := json.Marshal(observedConfig)
+		if err != nil {
+			return observedConfig, errs
+		}
+		if last != nil && !bytes.Equal(last, encoded) {
+			operatormetrics.ObserveObservedConfigChange(name)
+		}
+		last = encoded
+		return observedConfig, errs
+	}
 }
 
 // newFeatureGateAccessWithWatchListDisabled wraps a FeatureGateAccess to force WatchList to be disabled.
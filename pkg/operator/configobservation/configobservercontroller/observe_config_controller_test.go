@@ -0,0 +1,171 @@
+package configobservercontroller
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	corelistersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	configlistersv1 "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/configobservation"
+)
+
+// TestObservedInputs fails when the inputs a config observer declares, which the resource graph is built from, no
+// longer match what it reads through its listers.
+func TestObservedInputs(t *testing.T) {
+	recorder := events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(time.Now()))
+	for _, named := range namedObservers(featuregates.NewHardcodedFeatureGateAccess(nil, nil)) {
+		t.Run(named.name, func(t *testing.T) {
+			read := map[configv1.ObjectReference]bool{}
+			named.observe(recordingListers(func(group, resource, namespace, name string) {
+				read[configv1.ObjectReference{Group: group, Resource: resource, Namespace: namespace, Name: name}] = true
+			}), recorder, map[string]interface{}{})
+
+			for _, input := range named.inputs {
+				if !read[input] {
+					t.Errorf("%v is declared, but not read", input)
+				}
+				delete(read, input)
+			}
+			for input := range read {
+				t.Errorf("%v is read, but not declared", input)
+			}
+		})
+	}
+}
+
+// recordingListers returns empty listers that record the resources read through them.
+func recordingListers(record recordFunc) configobservation.Listers {
+	newIndexer := func() cache.Indexer {
+		return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	}
+	return configobservation.Listers{
+		APIServerLister_:    recordingAPIServerLister{configlistersv1.NewAPIServerLister(newIndexer()), record},
+		ImageConfigLister:   recordingImageLister{configlistersv1.NewImageLister(newIndexer()), record},
+		ProjectConfigLister: recordingProjectLister{configlistersv1.NewProjectLister(newIndexer()), record},
+		ProxyLister_:        recordingProxyLister{configlistersv1.NewProxyLister(newIndexer()), record},
+		IngressConfigLister: recordingIngressLister{configlistersv1.NewIngressLister(newIndexer()), record},
+		EndpointsLister_:    recordingEndpointsLister{corelistersv1.NewEndpointsLister(newIndexer()), record},
+		ConfigmapLister_:    recordingConfigMapLister{corelistersv1.NewConfigMapLister(newIndexer()), record},
+		SecretLister_:       recordingSecretLister{corelistersv1.NewSecretLister(newIndexer()), record},
+	}
+}
+
+type recordFunc func(group, resource, namespace, name string)
+
+type recordingAPIServerLister struct {
+	configlistersv1.APIServerLister
+	record recordFunc
+}
+
+func (l recordingAPIServerLister) Get(name string) (*configv1.APIServer, error) {
+	l.record(configv1.GroupName, "apiservers", "", name)
+	return l.APIServerLister.Get(name)
+}
+
+type recordingImageLister struct {
+	configlistersv1.ImageLister
+	record recordFunc
+}
+
+func (l recordingImageLister) Get(name string) (*configv1.Image, error) {
+	l.record(configv1.GroupName, "images", "", name)
+	return l.ImageLister.Get(name)
+}
+
+type recordingProjectLister struct {
+	configlistersv1.ProjectLister
+	record recordFunc
+}
+
+func (l recordingProjectLister) Get(name string) (*configv1.Project, error) {
+	l.record(configv1.GroupName, "projects", "", name)
+	return l.ProjectLister.Get(name)
+}
+
+type recordingProxyLister struct {
+	configlistersv1.ProxyLister
+	record recordFunc
+}
+
+func (l recordingProxyLister) Get(name string) (*configv1.Proxy, error) {
+	l.record(configv1.GroupName, "proxies", "", name)
+	return l.ProxyLister.Get(name)
+}
+
+type recordingIngressLister struct {
+	configlistersv1.IngressLister
+	record recordFunc
+}
+
+func (l recordingIngressLister) Get(name string) (*configv1.Ingress, error) {
+	l.record(configv1.GroupName, "ingresses", "", name)
+	return l.IngressLister.Get(name)
+}
+
+type recordingEndpointsLister struct {
+	corelistersv1.EndpointsLister
+	record recordFunc
+}
+
+func (l recordingEndpointsLister) Endpoints(namespace string) corelistersv1.EndpointsNamespaceLister {
+	return recordingEndpointsNamespaceLister{l.EndpointsLister.Endpoints(namespace), namespace, l.record}
+}
+
+type recordingEndpointsNamespaceLister struct {
+	corelistersv1.EndpointsNamespaceLister
+	namespace string
+	record    recordFunc
+}
+
+func (l recordingEndpointsNamespaceLister) Get(name string) (*corev1.Endpoints, error) {
+	l.record("", "endpoints", l.namespace, name)
+	return l.EndpointsNamespaceLister.Get(name)
+}
+
+type recordingConfigMapLister struct {
+	corelistersv1.ConfigMapLister
+	record recordFunc
+}
+
+func (l recordingConfigMapLister) ConfigMaps(namespace string) corelistersv1.ConfigMapNamespaceLister {
+	return recordingConfigMapNamespaceLister{l.ConfigMapLister.ConfigMaps(namespace), namespace, l.record}
+}
+
+type recordingConfigMapNamespaceLister struct {
+	corelistersv1.ConfigMapNamespaceLister
+	namespace string
+	record    recordFunc
+}
+
+func (l recordingConfigMapNamespaceLister) Get(name string) (*corev1.ConfigMap, error) {
+	l.record("", "configmaps", l.namespace, name)
+	return l.ConfigMapNamespaceLister.Get(name)
+}
+
+type recordingSecretLister struct {
+	corelistersv1.SecretLister
+	record recordFunc
+}
+
+func (l recordingSecretLister) Secrets(namespace string) corelistersv1.SecretNamespaceLister {
+	return recordingSecretNamespaceLister{l.SecretLister.Secrets(namespace), namespace, l.record}
+}
+
+type recordingSecretNamespaceLister struct {
+	corelistersv1.SecretNamespaceLister
+	namespace string
+	record    recordFunc
+}
+
+func (l recordingSecretNamespaceLister) Get(name string) (*corev1.Secret, error) {
+	l.record("", "secrets", l.namespace, name)
+	return l.SecretNamespaceLister.Get(name)
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	operatorv1 "github.com/openshift/api/operator/v1"
@@ -303,3 +304,26 @@ type endpointInfo struct {
 func withTarget(label, nodeName string) func(check *v1alpha1.PodNetworkConnectivityCheck) {
 	return WithTarget(label + "-" + nodeName)
 }
+
+// targetTypes are the labels of the targets passed to withTarget.
+var targetTypes = []string{
+	"etcd-server",
+	"kubernetes-apiserver-endpoint",
+	"kubernetes-apiserver-service",
+	"kubernetes-default-service",
+	"load-balancer",
+}
+
+// TargetType returns the type of the target of a check generated by this controller, or "unknown".
+func TargetType(check *v1alpha1.PodNetworkConnectivityCheck) string {
+	_, target, ok := strings.Cut(check.Name, "-to-")
+	if !ok {
+		return "unknown"
+	}
+	for _, targetType := range targetTypes {
+		if strings.HasPrefix(target, targetType+"-") {
+			return targetType
+		}
+	}
+	return "unknown"
+}
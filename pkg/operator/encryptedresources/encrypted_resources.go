@@ -0,0 +1,228 @@
+package encryptedresources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/encryption/controllers"
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// ConfigMapName is the configmap in the operator namespace listing additional resources to encrypt.
+	ConfigMapName = "encrypted-resources"
+	// ResourcesKey holds one <resource>.<group> per line, e.g. templateinstances.template.openshift.io.
+	ResourcesKey = "resources"
+
+	// encryptionConfigName is the encryption configuration the state controller maintains for openshift-apiserver.
+	encryptionConfigName = encryptiondata.EncryptionConfSecretName + "-openshift-apiserver"
+
+	conditionType = "EncryptedResourcesDegraded"
+)
+
+// DefaultResources are always encrypted.
+var DefaultResources = []schema.GroupResource{
+	{Group: "route.openshift.io", Resource: "routes"}, // routes can contain embedded TLS private keys
+}
+
+// Provider returns the resources the encryption controllers encrypt: the default ones, the valid ones of the
+// encrypted-resources configmap and the ones that are already in the encryption configuration. The latter are never
+// dropped, because the encryption controllers remove resources missing from the list from the encryption configuration
+// without decrypting them first.
+type Provider struct {
+	configMapLister corev1listers.ConfigMapLister
+	secretLister    corev1listers.SecretLister
+	groups          sets.Set[string]
+	hasSynced       []cache.InformerSynced
+
+	lock sync.Mutex
+	last []schema.GroupResource
+}
+
+var _ controllers.Provider = &Provider{}
+
+// NewProvider returns a Provider that accepts resources of the given groups, i.e. the ones openshift-apiserver serves.
+func NewProvider(kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces, groups []string) *Provider {
+	configMapInformer := kubeInformersForNamespaces.InformersFor(operatorclient.OperatorNamespace).Core().V1().ConfigMaps()
+	secretInformer := kubeInformersForNamespaces.InformersFor(operatorclient.GlobalMachineSpecifiedConfigNamespace).Core().V1().Secrets()
+	return &Provider{
+		configMapLister: configMapInformer.Lister(),
+		secretLister:    secretInformer.Lister(),
+		groups:          sets.New(groups...),
+		hasSynced:       []cache.InformerSynced{configMapInformer.Informer().HasSynced, secretInformer.Informer().HasSynced},
+		last:            DefaultResources,
+	}
+}
+
+// EncryptedGRs returns the default resources first, followed by the other ones in order. Failing to read the encryption
+// configuration returns the previous resources, so that nothing is dropped from it.
+func (p *Provider) EncryptedGRs() []schema.GroupResource {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	configured, _, err := p.configuredResources()
+	if err != nil {
+		klog.Warningf("failed to get the resources to encrypt, keeping %v: %v", p.last, err)
+		return p.last
+	}
+	encrypted, err := p.encryptedResources()
+	if err != nil {
+		klog.Warningf("failed to get the encrypted resources, keeping %v: %v", p.last, err)
+		return p.last
+	}
+	p.last = merge(configured, encrypted)
+	return p.last
+}
+
+// ShouldRunEncryptionControllers returns true once the configmap and the encryption configuration are cached, so that
+// EncryptedGRs never misses an encrypted resource.
+func (p *Provider) ShouldRunEncryptionControllers() (bool, error) {
+	for _, hasSynced := range p.hasSynced {
+		if !hasSynced() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// configuredResources returns the valid resources of the configmap and the entries that were rejected.
+func (p *Provider) configuredResources() ([]schema.GroupResource, []string, error) {
+	configMap, err := p.configMapLister.ConfigMaps(operatorclient.OperatorNamespace).Get(ConfigMapName)
+	if apierrors.IsNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	resources, invalid := parseResources(configMap.Data[ResourcesKey], p.groups)
+	return resources, invalid, nil
+}
+
+// encryptedResources returns the resources in the encryption configuration of openshift-apiserver.
+func (p *Provider) encryptedResources() ([]schema.GroupResource, error) {
+	secret, err := p.secretLister.Secrets(operatorclient.GlobalMachineSpecifiedConfigNamespace).Get(encryptionConfigName)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	config, err := encryptiondata.FromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.Encryption == nil {
+		return nil, nil
+	}
+	resources := []schema.GroupResource{}
+	for _, resourceConfig := range config.Encryption.Resources {
+		for _, resource := range resourceConfig.Resources {
+			resources = append(resources, schema.ParseGroupResource(resource))
+		}
+	}
+	return resources, nil
+}
+
+// parseResources returns the resources of the given groups, one <resource>.<group> per line, and the lines that are
+// not. Empty lines and lines starting with # are skipped.
+func parseResources(data string, groups sets.Set[string]) ([]schema.GroupResource, []string) {
+	resources := []schema.GroupResource{}
+	invalid := []string{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		resource := schema.ParseGroupResource(line)
+		if len(resource.Resource) == 0 || !groups.Has(resource.Group) {
+			invalid = append(invalid, line)
+			continue
+		}
+		resources = append(resources, resource)
+	}
+	return resources, invalid
+}
+
+// merge returns the default resources followed by the sorted and deduplicated other resources.
+func merge(resourceLists ...[]schema.GroupResource) []schema.GroupResource {
+	seen := sets.New(DefaultResources...)
+	others := []schema.GroupResource{}
+	for _, resources := range resourceLists {
+		for _, resource := range resources {
+			if !seen.Has(resource) {
+				seen.Insert(resource)
+				others = append(others, resource)
+			}
+		}
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].String() < others[j].String() })
+	return append(append([]schema.GroupResource{}, DefaultResources...), others...)
+}
+
+type encryptedResourcesController struct {
+	operatorClient v1helpers.OperatorClient
+	provider       *Provider
+}
+
+// NewEncryptedResourcesController reports the entries of the encrypted-resources configmap that aren't resources
+// served by openshift-apiserver, and therefore aren't encrypted, in the EncryptedResourcesDegraded condition.
+func NewEncryptedResourcesController(
+	operatorClient v1helpers.OperatorClient,
+	provider *Provider,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	eventRecorder events.Recorder,
+) factory.Controller {
+	c := &encryptedResourcesController{
+		operatorClient: operatorClient,
+		provider:       provider,
+	}
+	return factory.New().
+		WithInformers(
+			operatorClient.Informer(),
+			kubeInformersForNamespaces.InformersFor(operatorclient.OperatorNamespace).Core().V1().ConfigMaps().Informer(),
+		).
+		ResyncEvery(10*time.Minute).
+		WithSync(c.sync).
+		ToController("EncryptedResourcesController", eventRecorder.WithComponentSuffix("encrypted-resources-controller"))
+}
+
+func (c *encryptedResourcesController) sync(ctx context.Context, _ factory.SyncContext) error {
+	condition := operatorv1.OperatorCondition{
+		Type:   conditionType,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+	_, invalid, err := c.provider.configuredResources()
+	switch {
+	case err != nil:
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "Error"
+		condition.Message = err.Error()
+	case len(invalid) > 0:
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "InvalidResources"
+		condition.Message = fmt.Sprintf("%s/%s lists resources that openshift-apiserver doesn't serve: %s",
+			operatorclient.OperatorNamespace, ConfigMapName, strings.Join(invalid, ", "))
+	}
+	if _, _, updateErr := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(condition)); updateErr != nil {
+		return updateErr
+	}
+	return err
+}
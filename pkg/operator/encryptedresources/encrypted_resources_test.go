@@ -0,0 +1,142 @@
+package encryptedresources
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+var groups = []string{"build.openshift.io", "image.openshift.io", "route.openshift.io", "template.openshift.io"}
+
+func TestEncryptedGRs(t *testing.T) {
+	encryptionConfig := func(resources ...string) *corev1.Secret {
+		config := &encryptiondata.Config{Encryption: &apiserverv1.EncryptionConfiguration{
+			Resources: []apiserverv1.ResourceConfiguration{{Resources: resources}},
+		}}
+		secret, err := encryptiondata.ToSecret("openshift-config-managed", encryptionConfigName, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return secret
+	}
+
+	tests := []struct {
+		name      string
+		resources *string
+		secret    *corev1.Secret
+		expected  []schema.GroupResource
+	}{
+		{
+			name:     "defaults",
+			expected: DefaultResources,
+		},
+		{
+			name:      "configured",
+			resources: ptr.To("# sensitive parameters\ntemplateinstances.template.openshift.io\n\nbuildconfigs.build.openshift.io\nroutes.route.openshift.io\n"),
+			expected: []schema.GroupResource{
+				{Group: "route.openshift.io", Resource: "routes"},
+				{Group: "build.openshift.io", Resource: "buildconfigs"},
+				{Group: "template.openshift.io", Resource: "templateinstances"},
+			},
+		},
+		{
+			name:      "invalid entries are skipped",
+			resources: ptr.To("secrets\ndeployments.apps\nimagestreams.image.openshift.io"),
+			expected: []schema.GroupResource{
+				{Group: "route.openshift.io", Resource: "routes"},
+				{Group: "image.openshift.io", Resource: "imagestreams"},
+			},
+		},
+		{
+			name:      "encrypted resources are kept",
+			resources: ptr.To(""),
+			secret:    encryptionConfig("routes.route.openshift.io", "imagestreams.image.openshift.io"),
+			expected: []schema.GroupResource{
+				{Group: "route.openshift.io", Resource: "routes"},
+				{Group: "image.openshift.io", Resource: "imagestreams"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := newTestProvider(t, tc.resources, tc.secret)
+			if actual := provider.EncryptedGRs(); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestEncryptedResourcesController(t *testing.T) {
+	tests := []struct {
+		name          string
+		resources     *string
+		expectStatus  operatorv1.ConditionStatus
+		expectMessage string
+	}{
+		{name: "no configmap", expectStatus: operatorv1.ConditionFalse},
+		{name: "valid", resources: ptr.To("templateinstances.template.openshift.io"), expectStatus: operatorv1.ConditionFalse},
+		{
+			name:          "invalid",
+			resources:     ptr.To("templateinstances.template.openshift.io\nsecrets\ndeployments.apps"),
+			expectStatus:  operatorv1.ConditionTrue,
+			expectMessage: "openshift-apiserver-operator/encrypted-resources lists resources that openshift-apiserver doesn't serve: secrets, deployments.apps",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			operatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{}, nil)
+			c := &encryptedResourcesController{operatorClient: operatorClient, provider: newTestProvider(t, tc.resources, nil)}
+			if err := c.sync(context.Background(), factory.NewSyncContext("test", events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(time.Now())))); err != nil {
+				t.Fatal(err)
+			}
+			_, status, _, _ := operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, conditionType)
+			if condition == nil || condition.Status != tc.expectStatus || !strings.Contains(condition.Message, tc.expectMessage) {
+				t.Errorf("expected %s %q, got %#v", tc.expectStatus, tc.expectMessage, condition)
+			}
+		})
+	}
+}
+
+func newTestProvider(t *testing.T, resources *string, secret *corev1.Secret) *Provider {
+	configMapIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if resources != nil {
+		if err := configMapIndexer.Add(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver-operator", Name: ConfigMapName},
+			Data:       map[string]string{ResourcesKey: *resources},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if secret != nil {
+		if err := secretIndexer.Add(secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Provider{
+		configMapLister: corev1listers.NewConfigMapLister(configMapIndexer),
+		secretLister:    corev1listers.NewSecretLister(secretIndexer),
+		groups:          sets.New(groups...),
+		last:            DefaultResources,
+	}
+}
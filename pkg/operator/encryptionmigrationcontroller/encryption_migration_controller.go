@@ -0,0 +1,344 @@
+package encryptionmigrationcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	migrationv1alpha1 "sigs.k8s.io/kube-storage-version-migrator/pkg/apis/migration/v1alpha1"
+	migrationv1alpha1informer "sigs.k8s.io/kube-storage-version-migrator/pkg/clients/informer/migration/v1alpha1"
+	migrationv1alpha1lister "sigs.k8s.io/kube-storage-version-migrator/pkg/clients/lister/migration/v1alpha1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/encryption/controllers"
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
+	"github.com/openshift/library-go/pkg/operator/encryption/secrets"
+	"github.com/openshift/library-go/pkg/operator/encryption/state"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	operatormetrics "github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/metrics"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// StatusConfigMapName is the configmap in the operator namespace holding the migration status of every encrypted
+	// resource.
+	StatusConfigMapName = "encryption-migration-status"
+	statusKey           = "status.json"
+
+	conditionType = "EncryptionMigrationStatus"
+
+	// the component the encryption controllers of this operator label their key secrets with
+	component = "openshift-apiserver"
+	// encryptionConfigName is the encryption configuration the state controller maintains for openshift-apiserver.
+	encryptionConfigName = encryptiondata.EncryptionConfSecretName + "-" + component
+
+	// writeKeyAnnotation is set by the KubeStorageVersionMigrator on the migrations it creates.
+	writeKeyAnnotation = "encryption.apiserver.operator.openshift.io/write-key"
+)
+
+// ResourceStatus is the migration status of an encrypted resource.
+type ResourceStatus struct {
+	Resource string `json:"resource"`
+	// WriteKey is the ID of the key new objects are encrypted with, empty until the resource has one.
+	WriteKey     string `json:"writeKey,omitempty"`
+	WriteKeyMode string `json:"writeKeyMode,omitempty"`
+	// MigratedKey is the ID of the most recent key all objects were migrated to.
+	MigratedKey string       `json:"migratedKey,omitempty"`
+	MigratedAt  *metav1.Time `json:"migratedAt,omitempty"`
+	// StorageVersionMigration migrates the resource to the write key, when there is one for the write key.
+	StorageVersionMigration string       `json:"storageVersionMigration,omitempty"`
+	MigrationStarted        *metav1.Time `json:"migrationStarted,omitempty"`
+	MigrationFinished       *metav1.Time `json:"migrationFinished,omitempty"`
+	MigrationFailure        string       `json:"migrationFailure,omitempty"`
+}
+
+// migrated is true once all objects of the resource were migrated to its write key.
+func (s ResourceStatus) migrated() bool {
+	return len(s.WriteKey) > 0 && s.MigratedKey == s.WriteKey
+}
+
+func (s ResourceStatus) message() string {
+	switch {
+	case len(s.WriteKey) == 0:
+		return fmt.Sprintf("%s: waiting for a write key", s.Resource)
+	case s.migrated():
+		return fmt.Sprintf("%s: migrated to %s key %s", s.Resource, s.WriteKeyMode, s.WriteKey)
+	case len(s.MigrationFailure) > 0:
+		return fmt.Sprintf("%s: migration to %s key %s failed: %s", s.Resource, s.WriteKeyMode, s.WriteKey, s.MigrationFailure)
+	}
+	from := "unencrypted storage"
+	if len(s.MigratedKey) > 0 {
+		from = "key " + s.MigratedKey
+	}
+	if s.MigrationStarted == nil {
+		return fmt.Sprintf("%s: migrating from %s to %s key %s", s.Resource, from, s.WriteKeyMode, s.WriteKey)
+	}
+	return fmt.Sprintf("%s: migrating from %s to %s key %s since %s (%s)", s.Resource, from, s.WriteKeyMode, s.WriteKey,
+		s.MigrationStarted.UTC().Format(time.RFC3339), s.StorageVersionMigration)
+}
+
+type encryptionMigrationController struct {
+	operatorClient   v1helpers.OperatorClient
+	provider         controllers.Provider
+	secretLister     corev1listers.SecretLister
+	migrationLister  migrationv1alpha1lister.StorageVersionMigrationLister
+	configMapsGetter corev1client.ConfigMapsGetter
+
+	lock     sync.RWMutex
+	statuses []ResourceStatus
+}
+
+// NewEncryptionMigrationController publishes the migration status of every resource the encryption controllers
+// encrypt: the write key, the key the resource was last migrated to and the StorageVersionMigration moving it to the
+// write key. The status is kept in the encryption-migration-status configmap, summarized in the
+// EncryptionMigrationStatus condition and served by the returned debug handler.
+func NewEncryptionMigrationController(
+	operatorClient v1helpers.OperatorClient,
+	provider controllers.Provider,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	migrationInformer migrationv1alpha1informer.Interface,
+	configMapsGetter corev1client.ConfigMapsGetter,
+	eventRecorder events.Recorder,
+) (factory.Controller, http.Handler) {
+	secretInformer := kubeInformersForNamespaces.InformersFor(operatorclient.GlobalMachineSpecifiedConfigNamespace).Core().V1().Secrets()
+	c := &encryptionMigrationController{
+		operatorClient:   operatorClient,
+		provider:         provider,
+		secretLister:     secretInformer.Lister(),
+		migrationLister:  migrationInformer.StorageVersionMigrations().Lister(),
+		configMapsGetter: configMapsGetter,
+	}
+	return factory.New().
+		WithInformers(
+			operatorClient.Informer(),
+			secretInformer.Informer(),
+			migrationInformer.StorageVersionMigrations().Informer(),
+		).
+		ResyncEvery(time.Minute).
+		WithSync(c.sync).
+		ToController("EncryptionMigrationController", eventRecorder.WithComponentSuffix("encryption-migration-controller")), &debugHandler{controller: c}
+}
+
+func (c *encryptionMigrationController) sync(ctx context.Context, syncCtx factory.SyncContext) error {
+	if ready, err := c.provider.ShouldRunEncryptionControllers(); err != nil || !ready {
+		return err
+	}
+	statuses, err := c.resourceStatuses()
+	if err != nil {
+		_, _, updateErr := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:    conditionType,
+			Status:  operatorv1.ConditionUnknown,
+			Reason:  "Error",
+			Message: err.Error(),
+		}))
+		if updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+
+	c.lock.Lock()
+	c.statuses = statuses
+	c.lock.Unlock()
+	operatormetrics.SetEncryptionMigrations(migrationMetrics(statuses, time.Now()))
+
+	encodedStatuses, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, _, err := resourceapply.ApplyConfigMap(ctx, c.configMapsGetter, syncCtx.Recorder(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.OperatorNamespace, Name: StatusConfigMapName},
+		Data:       map[string]string{statusKey: string(encodedStatuses)},
+	}); err != nil {
+		return err
+	}
+
+	_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(statusCondition(statuses)))
+	return err
+}
+
+// statusCondition is True once every resource was migrated to its write key, False while one is waiting for a key or
+// being migrated, and lists the status of every resource. Without any write key encryption was never turned on.
+func statusCondition(statuses []ResourceStatus) operatorv1.OperatorCondition {
+	condition := operatorv1.OperatorCondition{
+		Type:   conditionType,
+		Status: operatorv1.ConditionTrue,
+		Reason: "Migrated",
+	}
+	hasWriteKey := false
+	for _, status := range statuses {
+		hasWriteKey = hasWriteKey || len(status.WriteKey) > 0
+	}
+	if !hasWriteKey {
+		condition.Reason = "EncryptionOff"
+		condition.Message = "no resource has a write key"
+		return condition
+	}
+	messages := []string{}
+	for _, status := range statuses {
+		messages = append(messages, status.message())
+		if !status.migrated() {
+			condition.Status = operatorv1.ConditionFalse
+			condition.Reason = "Migrating"
+		}
+	}
+	condition.Message = strings.Join(messages, "\n")
+	return condition
+}
+
+// migrationMetrics returns the migrations to the write keys, with how long they took or have been running for.
+func migrationMetrics(statuses []ResourceStatus, now time.Time) []operatormetrics.EncryptionMigration {
+	migrations := []operatormetrics.EncryptionMigration{}
+	for _, status := range statuses {
+		if status.MigrationStarted == nil {
+			continue
+		}
+		migration := operatormetrics.EncryptionMigration{Resource: status.Resource, State: operatormetrics.MigrationRunning, Duration: now.Sub(status.MigrationStarted.Time)}
+		if status.MigrationFinished != nil {
+			migration.State = operatormetrics.MigrationSucceeded
+			if len(status.MigrationFailure) > 0 {
+				migration.State = operatormetrics.MigrationFailed
+			}
+			migration.Duration = status.MigrationFinished.Sub(status.MigrationStarted.Time)
+		}
+		migrations = append(migrations, migration)
+	}
+	return migrations
+}
+
+// resourceStatuses returns the status of the resources to encrypt, in the order of the provider.
+func (c *encryptionMigrationController) resourceStatuses() ([]ResourceStatus, error) {
+	var config *encryptiondata.Config
+	configSecret, err := c.secretLister.Secrets(operatorclient.GlobalMachineSpecifiedConfigNamespace).Get(encryptionConfigName)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return nil, err
+	default:
+		if config, err = encryptiondata.FromSecret(configSecret); err != nil {
+			return nil, err
+		}
+	}
+	selector, err := labels.Parse(secrets.EncryptionKeySecretsLabel + "=" + component)
+	if err != nil {
+		return nil, err
+	}
+	keySecrets, err := c.secretLister.Secrets(operatorclient.GlobalMachineSpecifiedConfigNamespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	grStates, _ := encryptiondata.ToEncryptionState(config, keySecrets)
+
+	statuses := []ResourceStatus{}
+	for _, gr := range c.provider.EncryptedGRs() {
+		status := ResourceStatus{Resource: gr.String()}
+		grState, ok := grStates[gr]
+		if !ok || !grState.HasWriteKey() {
+			statuses = append(statuses, status)
+			continue
+		}
+		status.WriteKey = grState.WriteKey.Key.Name
+		status.WriteKeyMode = string(grState.WriteKey.Mode)
+		if migratedKey := lastMigratedKey(gr, append([]state.KeyState{grState.WriteKey}, grState.ReadKeys...)); migratedKey != nil {
+			status.MigratedKey = migratedKey.Key.Name
+			status.MigratedAt = &metav1.Time{Time: migratedKey.Migrated.Timestamp}
+		}
+		if err := c.addMigration(gr, &status); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// addMigration adds the StorageVersionMigration of the resource to its status, if it migrates to the write key.
+func (c *encryptionMigrationController) addMigration(gr schema.GroupResource, status *ResourceStatus) error {
+	migration, err := c.migrationLister.Get(migrationName(gr))
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if migration.Annotations[writeKeyAnnotation] != status.WriteKey {
+		return nil
+	}
+	status.StorageVersionMigration = migration.Name
+	status.MigrationStarted = migration.CreationTimestamp.DeepCopy()
+	for _, condition := range migration.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case migrationv1alpha1.MigrationSucceeded:
+			status.MigrationFinished = condition.LastUpdateTime.DeepCopy()
+		case migrationv1alpha1.MigrationFailed:
+			status.MigrationFinished = condition.LastUpdateTime.DeepCopy()
+			status.MigrationFailure = condition.Message
+		}
+	}
+	return nil
+}
+
+// lastMigratedKey returns the key with the highest ID the resource was migrated to.
+func lastMigratedKey(gr schema.GroupResource, keys []state.KeyState) *state.KeyState {
+	var last *state.KeyState
+	lastID := uint64(0)
+	for i := range keys {
+		if migrated, _, _ := state.MigratedFor([]schema.GroupResource{gr}, keys[i]); !migrated {
+			continue
+		}
+		id, err := strconv.ParseUint(keys[i].Key.Name, 10, 64)
+		if err != nil {
+			continue
+		}
+		if last == nil || id > lastID {
+			last, lastID = &keys[i], id
+		}
+	}
+	return last
+}
+
+// migrationName is the name of the StorageVersionMigration the KubeStorageVersionMigrator creates for the resource.
+func migrationName(gr schema.GroupResource) string {
+	group := gr.Group
+	if len(group) == 0 {
+		group = "core"
+	}
+	return fmt.Sprintf("encryption-migration-%s-%s", group, gr.Resource)
+}
+
+type debugHandler struct {
+	controller *encryptionMigrationController
+}
+
+// ServeHTTP writes the migration status of the last sync.
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h.controller.lock.RLock()
+	defer h.controller.lock.RUnlock()
+
+	data, err := json.Marshal(h.controller.statuses)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,182 @@
+package encryptionmigrationcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+	migrationv1alpha1 "sigs.k8s.io/kube-storage-version-migrator/pkg/apis/migration/v1alpha1"
+	migrationv1alpha1lister "sigs.k8s.io/kube-storage-version-migrator/pkg/clients/lister/migration/v1alpha1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/encryption"
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
+	"github.com/openshift/library-go/pkg/operator/encryption/secrets"
+	"github.com/openshift/library-go/pkg/operator/encryption/state"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	operatormetrics "github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/metrics"
+)
+
+func TestEncryptionMigrationController(t *testing.T) {
+	routes := schema.GroupResource{Group: "route.openshift.io", Resource: "routes"}
+	templateInstances := schema.GroupResource{Group: "template.openshift.io", Resource: "templateinstances"}
+	migratedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	startedAt := metav1.NewTime(migratedAt.Add(time.Hour))
+
+	key := func(id string, migrated ...schema.GroupResource) state.KeyState {
+		ks := state.KeyState{
+			Key:    apiserverv1.Key{Name: id, Secret: "NzFlYTdjOTE0MTlhNjhmZDEyMjRmODhkNTAzMTZiNGU="},
+			Mode:   state.AESCBC,
+			Backed: true,
+		}
+		if len(migrated) > 0 {
+			ks.Migrated = state.MigrationState{Timestamp: migratedAt, Resources: migrated}
+		}
+		return ks
+	}
+	key1, key2 := key("1", routes, templateInstances), key("2", templateInstances)
+
+	secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, ks := range []state.KeyState{key1, key2} {
+		secret, err := secrets.FromKeyState("openshift-apiserver", ks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secretIndexer.Add(secret)
+	}
+	// routes are still read with key 1 and migrated to key 2
+	config, err := encryptiondata.FromEncryptionState(map[schema.GroupResource]state.GroupResourceState{
+		routes:            {WriteKey: key2, ReadKeys: []state.KeyState{key2, key1}},
+		templateInstances: {WriteKey: key2, ReadKeys: []state.KeyState{key2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configSecret, err := encryptiondata.ToSecret("openshift-config-managed", encryptionConfigName, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretIndexer.Add(configSecret)
+
+	migrationIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	migrationIndexer.Add(&migrationv1alpha1.StorageVersionMigration{ObjectMeta: metav1.ObjectMeta{
+		Name:              "encryption-migration-route.openshift.io-routes",
+		Annotations:       map[string]string{writeKeyAnnotation: "2"},
+		CreationTimestamp: startedAt,
+	}})
+
+	kubeClient := fake.NewSimpleClientset()
+	operatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{}, nil)
+	c := &encryptionMigrationController{
+		operatorClient:   operatorClient,
+		provider:         encryption.StaticEncryptionProvider{routes, templateInstances, {Group: "build.openshift.io", Resource: "buildconfigs"}},
+		secretLister:     corev1listers.NewSecretLister(secretIndexer),
+		migrationLister:  migrationv1alpha1lister.NewStorageVersionMigrationLister(migrationIndexer),
+		configMapsGetter: kubeClient.CoreV1(),
+	}
+	if err := c.sync(context.Background(), factory.NewSyncContext("test", events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(migratedAt)))); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ResourceStatus{
+		{
+			Resource:                "routes.route.openshift.io",
+			WriteKey:                "2",
+			WriteKeyMode:            "aescbc",
+			MigratedKey:             "1",
+			MigratedAt:              &metav1.Time{Time: migratedAt},
+			StorageVersionMigration: "encryption-migration-route.openshift.io-routes",
+			MigrationStarted:        &startedAt,
+		},
+		{
+			Resource:     "templateinstances.template.openshift.io",
+			WriteKey:     "2",
+			WriteKeyMode: "aescbc",
+			MigratedKey:  "2",
+			MigratedAt:   &metav1.Time{Time: migratedAt},
+		},
+		{Resource: "buildconfigs.build.openshift.io"},
+	}
+	expectedJSON, _ := json.MarshalIndent(expected, "", "  ")
+
+	configMap, err := kubeClient.CoreV1().ConfigMaps("openshift-apiserver-operator").Get(context.Background(), StatusConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configMap.Data[statusKey] != string(expectedJSON) {
+		t.Errorf("expected status\n%s\ngot\n%s", expectedJSON, configMap.Data[statusKey])
+	}
+
+	_, status, _, _ := operatorClient.GetOperatorState()
+	condition := v1helpers.FindOperatorCondition(status.Conditions, conditionType)
+	expectedMessage := strings.Join([]string{
+		"routes.route.openshift.io: migrating from key 1 to aescbc key 2 since 2024-01-01T13:00:00Z (encryption-migration-route.openshift.io-routes)",
+		"templateinstances.template.openshift.io: migrated to aescbc key 2",
+		"buildconfigs.build.openshift.io: waiting for a write key",
+	}, "\n")
+	if condition == nil || condition.Status != operatorv1.ConditionFalse || condition.Reason != "Migrating" || condition.Message != expectedMessage {
+		t.Errorf("unexpected condition %#v", condition)
+	}
+
+	recorder := httptest.NewRecorder()
+	(&debugHandler{controller: c}).ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/controllers/encryptionmigration", nil))
+	served := []ResourceStatus{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if len(served) != 3 || served[0].StorageVersionMigration != "encryption-migration-route.openshift.io-routes" {
+		t.Errorf("unexpected debug status %s", recorder.Body.String())
+	}
+}
+
+func TestStatusCondition(t *testing.T) {
+	condition := statusCondition([]ResourceStatus{{Resource: "routes.route.openshift.io"}})
+	if condition.Status != operatorv1.ConditionTrue || condition.Reason != "EncryptionOff" {
+		t.Errorf("expected encryption to be off, got %#v", condition)
+	}
+
+	condition = statusCondition([]ResourceStatus{{Resource: "routes.route.openshift.io", WriteKey: "2", WriteKeyMode: "aescbc", MigratedKey: "2"}})
+	if condition.Status != operatorv1.ConditionTrue || condition.Reason != "Migrated" {
+		t.Errorf("expected the resources to be migrated, got %#v", condition)
+	}
+
+	condition = statusCondition([]ResourceStatus{{Resource: "routes.route.openshift.io", WriteKey: "2", WriteKeyMode: "aescbc", MigratedKey: "1", MigrationFailure: "timeout"}})
+	if condition.Status != operatorv1.ConditionFalse || condition.Message != "routes.route.openshift.io: migration to aescbc key 2 failed: timeout" {
+		t.Errorf("expected a failed migration, got %#v", condition)
+	}
+}
+
+func TestMigrationMetrics(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutesAgo int) *metav1.Time {
+		return &metav1.Time{Time: now.Add(-time.Duration(minutesAgo) * time.Minute)}
+	}
+	migrations := migrationMetrics([]ResourceStatus{
+		{Resource: "routes.route.openshift.io", WriteKey: "2", MigrationStarted: at(10)},
+		{Resource: "oauthaccesstokens.oauth.openshift.io", WriteKey: "2", MigrationStarted: at(10), MigrationFinished: at(7)},
+		{Resource: "oauthauthorizetokens.oauth.openshift.io", WriteKey: "2", MigrationStarted: at(10), MigrationFinished: at(9), MigrationFailure: "timeout"},
+		{Resource: "templates.template.openshift.io"},
+	}, now)
+	expected := []operatormetrics.EncryptionMigration{
+		{Resource: "routes.route.openshift.io", State: operatormetrics.MigrationRunning, Duration: 10 * time.Minute},
+		{Resource: "oauthaccesstokens.oauth.openshift.io", State: operatormetrics.MigrationSucceeded, Duration: 3 * time.Minute},
+		{Resource: "oauthauthorizetokens.oauth.openshift.io", State: operatormetrics.MigrationFailed, Duration: time.Minute},
+	}
+	if !reflect.DeepEqual(migrations, expected) {
+		t.Errorf("expected %#v, got %#v", expected, migrations)
+	}
+}
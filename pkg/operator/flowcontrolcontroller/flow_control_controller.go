@@ -0,0 +1,400 @@
+package flowcontrolcontroller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	flowcontrolv1 "k8s.io/api/flowcontrol/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	flowcontrolclientv1 "k8s.io/client-go/kubernetes/typed/flowcontrol/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	flowcontrollistersv1 "k8s.io/client-go/listers/flowcontrol/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcemerge"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/v311_00_assets"
+)
+
+const (
+	conditionType = "FlowControlDegraded"
+
+	priorityLevelAsset = "v3.11.0/openshift-apiserver/apf-prioritylevel.yaml"
+
+	// PriorityLevelName is the priority level of the loopback requests openshift-apiserver sends to its own APIs through
+	// kube-apiserver.
+	PriorityLevelName = "openshift-apiserver"
+
+	// dispatchedRequestsMetric counts the requests kube-apiserver dispatched, by priority level.
+	dispatchedRequestsMetric = "apiserver_flowcontrol_dispatched_requests_total"
+	// minSampleInterval keeps syncs triggered in quick succession from sampling a rate over a few milliseconds.
+	minSampleInterval = 30 * time.Second
+
+	// Every openshift-apiserver replica gets sharesPerReplica concurrency shares and every requestsPerShare requests
+	// per second dispatched by a kube-apiserver one more. The result is rounded up to sharesStep, so that the priority
+	// level isn't updated for every small change of the rate, and bounded by minShares and maxShares.
+	sharesPerReplica = 10
+	requestsPerShare = 5
+	sharesStep       = 5
+	minShares        = 20
+	maxShares        = 100
+
+	// deletionReportPeriod is how long FlowControlDegraded reports a deleted resource after it was recreated.
+	deletionReportPeriod = 10 * time.Minute
+)
+
+var (
+	flowSchemaAssets = []string{
+		"v3.11.0/openshift-apiserver/apf-flowschema-loopback.yaml",
+	}
+
+	flowSchemasResource     = flowcontrolv1.SchemeGroupVersion.WithResource("flowschemas").GroupResource()
+	priorityLevelsResource  = flowcontrolv1.SchemeGroupVersion.WithResource("prioritylevelconfigurations").GroupResource()
+	flowControlScheme       = runtime.NewScheme()
+	flowControlCodecs       = serializer.NewCodecFactory(flowControlScheme)
+	flowControlResourceKind = map[schema.GroupResource]string{
+		flowSchemasResource:    "FlowSchema",
+		priorityLevelsResource: "PriorityLevelConfiguration",
+	}
+)
+
+func init() {
+	if err := flowcontrolv1.AddToScheme(flowControlScheme); err != nil {
+		panic(err)
+	}
+}
+
+// requestCountFunc returns the number of requests of the openshift-apiserver priority level dispatched so far.
+type requestCountFunc func(ctx context.Context) (float64, error)
+
+type flowControlController struct {
+	operatorClient      v1helpers.OperatorClient
+	deploymentLister    appsv1listers.DeploymentLister
+	flowSchemaLister    flowcontrollistersv1.FlowSchemaLister
+	priorityLevelLister flowcontrollistersv1.PriorityLevelConfigurationLister
+	flowControlClient   flowcontrolclientv1.FlowcontrolV1Interface
+	requestCount        requestCountFunc
+	now                 func() time.Time
+
+	// the last sample of the dispatched requests and the rate derived from it. The controller runs a single worker.
+	lastCount   float64
+	lastSampled time.Time
+	rate        float64
+}
+
+// NewFlowControlController manages the FlowSchema classifying the loopback requests of openshift-apiserver and their
+// PriorityLevelConfiguration. The SubjectAccessReviews, TokenReviews and other requests of openshift-apiserver keep the
+// FlowSchemas of the release manifests. The concurrency shares of the priority level are sized from the
+// openshift-apiserver replicas and the rate of requests kube-apiserver dispatched for it. Deleted resources are
+// recreated and reported in the FlowControlDegraded condition.
+func NewFlowControlController(
+	operatorClient v1helpers.OperatorClient,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	kubeClient kubernetes.Interface,
+	eventRecorder events.Recorder,
+) factory.Controller {
+	flowControlInformers := kubeInformersForNamespaces.InformersFor("").Flowcontrol().V1()
+	c := &flowControlController{
+		operatorClient:      operatorClient,
+		deploymentLister:    kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace).Apps().V1().Deployments().Lister(),
+		flowSchemaLister:    flowControlInformers.FlowSchemas().Lister(),
+		priorityLevelLister: flowControlInformers.PriorityLevelConfigurations().Lister(),
+		flowControlClient:   kubeClient.FlowcontrolV1(),
+		requestCount:        dispatchedRequestsFunc(kubeClient.Discovery().RESTClient()),
+		now:                 time.Now,
+	}
+
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace).Apps().V1().Deployments().Informer(),
+		flowControlInformers.FlowSchemas().Informer(),
+		flowControlInformers.PriorityLevelConfigurations().Informer(),
+	).ResyncEvery(time.Minute).WithSync(c.sync).ToController("FlowControlController", eventRecorder.WithComponentSuffix("flow-control-controller"))
+}
+
+func (c *flowControlController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	operatorSpec, operatorStatus, _, err := c.operatorClient.GetOperatorState()
+	if err != nil {
+		return err
+	}
+	if operatorSpec.ManagementState != operatorv1.Managed {
+		return nil
+	}
+
+	replicas := int32(0)
+	deployment, err := c.deploymentLister.Deployments(operatorclient.TargetNamespace).Get("apiserver")
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	c.sampleRate(ctx)
+	shares := concurrencyShares(replicas, c.rate)
+
+	generations := []operatorv1.GenerationStatus{}
+	deleted := []string{}
+	errs := []error{}
+
+	requiredPriorityLevel, err := readPriorityLevel(shares)
+	if err != nil {
+		return err
+	}
+	priorityLevel, recreated, err := c.applyPriorityLevel(ctx, syncContext.Recorder(), requiredPriorityLevel, operatorStatus.Generations)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		generations = append(generations, generationFor(priorityLevelsResource, &priorityLevel.ObjectMeta))
+	}
+	if recreated {
+		deleted = append(deleted, resourceName(priorityLevelsResource, requiredPriorityLevel.Name))
+	}
+
+	for _, asset := range flowSchemaAssets {
+		requiredFlowSchema, err := readFlowSchema(asset)
+		if err != nil {
+			return err
+		}
+		flowSchema, recreated, err := c.applyFlowSchema(ctx, syncContext.Recorder(), requiredFlowSchema, operatorStatus.Generations)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			generations = append(generations, generationFor(flowSchemasResource, &flowSchema.ObjectMeta))
+		}
+		if recreated {
+			deleted = append(deleted, resourceName(flowSchemasResource, requiredFlowSchema.Name))
+		}
+	}
+
+	condition := operatorv1.OperatorCondition{
+		Type:    conditionType,
+		Status:  operatorv1.ConditionFalse,
+		Reason:  "AsExpected",
+		Message: fmt.Sprintf("%d concurrency shares for %d replicas and %.1f requests/s", shares, replicas, c.rate),
+	}
+	previous := v1helpers.FindOperatorCondition(operatorStatus.Conditions, conditionType)
+	switch {
+	case len(errs) > 0:
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "SyncError"
+		condition.Message = utilerrors.NewAggregate(errs).Error()
+	case len(deleted) > 0:
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "ResourcesDeleted"
+		condition.Message = fmt.Sprintf("%s deleted and recreated", strings.Join(deleted, ", "))
+	case previous != nil && previous.Status == operatorv1.ConditionTrue && previous.Reason == "ResourcesDeleted":
+		if remaining := deletionReportPeriod - c.now().Sub(previous.LastTransitionTime.Time); remaining > 0 {
+			condition = *previous
+			syncContext.Queue().AddAfter(syncContext.QueueKey(), remaining)
+		}
+	}
+
+	updateFuncs := []v1helpers.UpdateStatusFunc{v1helpers.UpdateConditionFn(condition)}
+	for _, generation := range generations {
+		generation := generation
+		updateFuncs = append(updateFuncs, func(status *operatorv1.OperatorStatus) error {
+			resourcemerge.SetGeneration(&status.Generations, generation)
+			return nil
+		})
+	}
+	if _, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, updateFuncs...); err != nil {
+		return err
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// sampleRate updates the request rate of the priority level from the dispatched requests counter. A counter lower
+// than the last sample means kube-apiserver restarted or the request reached another instance, the rate is kept
+// until the next sample.
+func (c *flowControlController) sampleRate(ctx context.Context) {
+	now := c.now()
+	if !c.lastSampled.IsZero() && now.Sub(c.lastSampled) < minSampleInterval {
+		return
+	}
+	count, err := c.requestCount(ctx)
+	if err != nil {
+		klog.Warningf("Unable to sample the requests of priority level %s: %v", PriorityLevelName, err)
+		return
+	}
+	if !c.lastSampled.IsZero() && count >= c.lastCount {
+		c.rate = (count - c.lastCount) / now.Sub(c.lastSampled).Seconds()
+	}
+	c.lastCount, c.lastSampled = count, now
+}
+
+// concurrencyShares returns the nominal concurrency shares of the priority level.
+func concurrencyShares(replicas int32, rate float64) int32 {
+	shares := sharesPerReplica*replicas + int32(math.Ceil(rate/requestsPerShare))
+	shares = (shares + sharesStep - 1) / sharesStep * sharesStep
+	if shares < minShares {
+		return minShares
+	}
+	if shares > maxShares {
+		return maxShares
+	}
+	return shares
+}
+
+func (c *flowControlController) applyPriorityLevel(ctx context.Context, recorder events.Recorder, required *flowcontrolv1.PriorityLevelConfiguration, generations []operatorv1.GenerationStatus) (*flowcontrolv1.PriorityLevelConfiguration, bool, error) {
+	existing, err := c.priorityLevelLister.Get(required.Name)
+	if apierrors.IsNotFound(err) {
+		actual, err := c.flowControlClient.PriorityLevelConfigurations().Create(ctx, required, metav1.CreateOptions{})
+		reportEvent(recorder, priorityLevelsResource, required.Name, "Created", err)
+		return actual, wasDeleted(generations, priorityLevelsResource, required.Name), err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	modified := false
+	existingCopy := existing.DeepCopy()
+	resourcemerge.EnsureObjectMeta(&modified, &existingCopy.ObjectMeta, required.ObjectMeta)
+	if !modified && equality.Semantic.DeepEqual(existingCopy.Spec, required.Spec) {
+		return existing, false, nil
+	}
+	existingCopy.Spec = required.Spec
+	actual, err := c.flowControlClient.PriorityLevelConfigurations().Update(ctx, existingCopy, metav1.UpdateOptions{})
+	reportEvent(recorder, priorityLevelsResource, required.Name, "Updated", err)
+	return actual, false, err
+}
+
+func (c *flowControlController) applyFlowSchema(ctx context.Context, recorder events.Recorder, required *flowcontrolv1.FlowSchema, generations []operatorv1.GenerationStatus) (*flowcontrolv1.FlowSchema, bool, error) {
+	existing, err := c.flowSchemaLister.Get(required.Name)
+	if apierrors.IsNotFound(err) {
+		actual, err := c.flowControlClient.FlowSchemas().Create(ctx, required, metav1.CreateOptions{})
+		reportEvent(recorder, flowSchemasResource, required.Name, "Created", err)
+		return actual, wasDeleted(generations, flowSchemasResource, required.Name), err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	modified := false
+	existingCopy := existing.DeepCopy()
+	resourcemerge.EnsureObjectMeta(&modified, &existingCopy.ObjectMeta, required.ObjectMeta)
+	if !modified && equality.Semantic.DeepEqual(existingCopy.Spec, required.Spec) {
+		return existing, false, nil
+	}
+	existingCopy.Spec = required.Spec
+	actual, err := c.flowControlClient.FlowSchemas().Update(ctx, existingCopy, metav1.UpdateOptions{})
+	reportEvent(recorder, flowSchemasResource, required.Name, "Updated", err)
+	return actual, false, err
+}
+
+// wasDeleted tells whether a missing resource was applied before, which the generations of the operator status
+// record.
+func wasDeleted(generations []operatorv1.GenerationStatus, resource schema.GroupResource, name string) bool {
+	return resourcemerge.GenerationFor(generations, resource, "", name) != nil
+}
+
+func generationFor(resource schema.GroupResource, meta *metav1.ObjectMeta) operatorv1.GenerationStatus {
+	return operatorv1.GenerationStatus{
+		Group:          resource.Group,
+		Resource:       resource.Resource,
+		Name:           meta.Name,
+		LastGeneration: meta.Generation,
+	}
+}
+
+func resourceName(resource schema.GroupResource, name string) string {
+	return fmt.Sprintf("%s/%s", resource.String(), name)
+}
+
+func reportEvent(recorder events.Recorder, resource schema.GroupResource, name, verb string, err error) {
+	kind := flowControlResourceKind[resource]
+	if err != nil {
+		recorder.Warningf(kind+verb+"Failed", "Failed to apply %s %s: %v", kind, name, err)
+		return
+	}
+	recorder.Eventf(kind+verb, "%s %s %s", verb, kind, name)
+}
+
+func readPriorityLevel(shares int32) (*flowcontrolv1.PriorityLevelConfiguration, error) {
+	obj, err := readAsset(priorityLevelAsset)
+	if err != nil {
+		return nil, err
+	}
+	priorityLevel, ok := obj.(*flowcontrolv1.PriorityLevelConfiguration)
+	if !ok || priorityLevel.Spec.Limited == nil {
+		return nil, fmt.Errorf("%s is not a limited PriorityLevelConfiguration", priorityLevelAsset)
+	}
+	priorityLevel.Spec.Limited.NominalConcurrencyShares = &shares
+	return priorityLevel, nil
+}
+
+func readFlowSchema(asset string) (*flowcontrolv1.FlowSchema, error) {
+	obj, err := readAsset(asset)
+	if err != nil {
+		return nil, err
+	}
+	flowSchema, ok := obj.(*flowcontrolv1.FlowSchema)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a FlowSchema", asset)
+	}
+	return flowSchema, nil
+}
+
+func readAsset(asset string) (runtime.Object, error) {
+	raw, err := v311_00_assets.Asset(asset)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := runtime.Decode(flowControlCodecs.UniversalDecoder(flowcontrolv1.SchemeGroupVersion), raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", asset, err)
+	}
+	return obj, nil
+}
+
+// dispatchedRequestsFunc reads the dispatched requests of the priority level from the metrics of the kube-apiserver
+// instance serving the client. The concurrency limits of API Priority and Fairness apply to every instance separately.
+func dispatchedRequestsFunc(client rest.Interface) requestCountFunc {
+	return func(ctx context.Context) (float64, error) {
+		raw, err := client.Get().AbsPath("/metrics").DoRaw(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return dispatchedRequests(raw)
+	}
+}
+
+func dispatchedRequests(raw []byte) (float64, error) {
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(raw))
+	if err != nil {
+		return 0, err
+	}
+	family, ok := families[dispatchedRequestsMetric]
+	if !ok {
+		return 0, fmt.Errorf("metric %s not found", dispatchedRequestsMetric)
+	}
+	count := float64(0)
+	for _, metric := range family.GetMetric() {
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "priority_level" && label.GetValue() == PriorityLevelName {
+				count += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,198 @@
+package flowcontrolcontroller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	flowcontrollistersv1 "k8s.io/client-go/listers/flowcontrol/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+func TestConcurrencyShares(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas int32
+		rate     float64
+		expected int32
+	}{
+		{name: "no replicas", expected: minShares},
+		{name: "three idle replicas", replicas: 3, expected: 30},
+		{name: "three busy replicas", replicas: 3, rate: 52, expected: 45},
+		{name: "rounded up", replicas: 3, rate: 1, expected: 35},
+		{name: "bounded", replicas: 3, rate: 1000, expected: maxShares},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if shares := concurrencyShares(tc.replicas, tc.rate); shares != tc.expected {
+				t.Errorf("expected %d shares, got %d", tc.expected, shares)
+			}
+		})
+	}
+}
+
+func TestDispatchedRequests(t *testing.T) {
+	metrics := `# HELP apiserver_flowcontrol_dispatched_requests_total [BETA] Number of requests executed by API Priority and Fairness subsystem
+# TYPE apiserver_flowcontrol_dispatched_requests_total counter
+apiserver_flowcontrol_dispatched_requests_total{flow_schema="openshift-apiserver-loopback",priority_level="openshift-apiserver"} 150
+apiserver_flowcontrol_dispatched_requests_total{flow_schema="openshift-apiserver",priority_level="workload-high"} 120
+apiserver_flowcontrol_dispatched_requests_total{flow_schema="global-default",priority_level="global-default"} 1000
+`
+	count, err := dispatchedRequests([]byte(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 150 {
+		t.Errorf("expected 150 requests, got %v", count)
+	}
+
+	if _, err := dispatchedRequests([]byte("# TYPE other counter\nother 1\n")); err == nil {
+		t.Errorf("expected a missing metric to fail")
+	}
+}
+
+func TestFlowControlControllerSync(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	deploymentIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	deploymentIndexer.Add(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "apiserver"},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.To[int32](3)},
+	})
+
+	newController := func(status *operatorv1.OperatorStatus) (*flowControlController, *fake.Clientset, v1helpers.OperatorClient) {
+		kubeClient := fake.NewSimpleClientset()
+		operatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, status, nil)
+		count := float64(0)
+		return &flowControlController{
+			operatorClient:      operatorClient,
+			deploymentLister:    appsv1listers.NewDeploymentLister(deploymentIndexer),
+			flowSchemaLister:    flowcontrollistersv1.NewFlowSchemaLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+			priorityLevelLister: flowcontrollistersv1.NewPriorityLevelConfigurationLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+			flowControlClient:   kubeClient.FlowcontrolV1(),
+			// 60 requests per minute
+			requestCount: func(context.Context) (float64, error) { count += 60; return count, nil },
+			now:          func() time.Time { return start },
+		}, kubeClient, operatorClient
+	}
+	recorder := events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(start))
+
+	t.Run("create", func(t *testing.T) {
+		c, kubeClient, operatorClient := newController(&operatorv1.OperatorStatus{})
+		if err := c.sync(context.Background(), factory.NewSyncContext("test", recorder)); err != nil {
+			t.Fatal(err)
+		}
+		priorityLevel, err := kubeClient.FlowcontrolV1().PriorityLevelConfigurations().Get(context.Background(), PriorityLevelName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shares := *priorityLevel.Spec.Limited.NominalConcurrencyShares; shares != 30 {
+			t.Errorf("expected 30 shares for 3 replicas, got %d", shares)
+		}
+		flowSchema, err := kubeClient.FlowcontrolV1().FlowSchemas().Get(context.Background(), "openshift-apiserver-loopback", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if flowSchema.Spec.PriorityLevelConfiguration.Name != PriorityLevelName {
+			t.Errorf("expected the loopback flowschema to use the %s priority level, got %s", PriorityLevelName, flowSchema.Spec.PriorityLevelConfiguration.Name)
+		}
+		// the SubjectAccessReviews, TokenReviews and other requests keep the flowschemas of the release manifests
+		flowSchemas, err := kubeClient.FlowcontrolV1().FlowSchemas().List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(flowSchemas.Items) != 1 {
+			t.Errorf("expected the loopback flowschema only, got %d flowschemas", len(flowSchemas.Items))
+		}
+
+		_, status, _, _ := operatorClient.GetOperatorState()
+		if condition := v1helpers.FindOperatorCondition(status.Conditions, conditionType); condition == nil || condition.Status != operatorv1.ConditionFalse {
+			t.Errorf("unexpected condition %#v", condition)
+		}
+		if len(status.Generations) != 2 {
+			t.Errorf("expected the generations of 2 resources, got %#v", status.Generations)
+		}
+
+		// the rate of the second sample adds a share for every 5 requests/s
+		refreshListers(t, c, kubeClient)
+		c.now = func() time.Time { return start.Add(10 * time.Second) }
+		if err := c.sync(context.Background(), factory.NewSyncContext("test", recorder)); err != nil {
+			t.Fatal(err)
+		}
+		if c.rate != 0 {
+			t.Errorf("expected samples closer than %v to be skipped, got a rate of %v", minSampleInterval, c.rate)
+		}
+		c.now = func() time.Time { return start.Add(time.Minute) }
+		if err := c.sync(context.Background(), factory.NewSyncContext("test", recorder)); err != nil {
+			t.Fatal(err)
+		}
+		if c.rate != 1 {
+			t.Errorf("expected a rate of 1 request/s, got %v", c.rate)
+		}
+		priorityLevel, _ = kubeClient.FlowcontrolV1().PriorityLevelConfigurations().Get(context.Background(), PriorityLevelName, metav1.GetOptions{})
+		if shares := *priorityLevel.Spec.Limited.NominalConcurrencyShares; shares != 35 {
+			t.Errorf("expected 35 shares, got %d", shares)
+		}
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		c, kubeClient, operatorClient := newController(&operatorv1.OperatorStatus{Generations: []operatorv1.GenerationStatus{
+			{Group: "flowcontrol.apiserver.k8s.io", Resource: "flowschemas", Name: "openshift-apiserver-loopback", LastGeneration: 1},
+		}})
+		if err := c.sync(context.Background(), factory.NewSyncContext("test", recorder)); err != nil {
+			t.Fatal(err)
+		}
+		_, status, _, _ := operatorClient.GetOperatorState()
+		condition := v1helpers.FindOperatorCondition(status.Conditions, conditionType)
+		if condition == nil || condition.Status != operatorv1.ConditionTrue || condition.Reason != "ResourcesDeleted" {
+			t.Fatalf("unexpected condition %#v", condition)
+		}
+		if !strings.Contains(condition.Message, "flowschemas.flowcontrol.apiserver.k8s.io/openshift-apiserver-loopback") || strings.Contains(condition.Message, "prioritylevelconfigurations") {
+			t.Errorf("expected only the flowschema to be reported, got %q", condition.Message)
+		}
+
+		// recreated resources are reported for a while
+		refreshListers(t, c, kubeClient)
+		c.now = func() time.Time { return condition.LastTransitionTime.Add(deletionReportPeriod / 2) }
+		if err := c.sync(context.Background(), factory.NewSyncContext("test", recorder)); err != nil {
+			t.Fatal(err)
+		}
+		_, status, _, _ = operatorClient.GetOperatorState()
+		if condition := v1helpers.FindOperatorCondition(status.Conditions, conditionType); condition.Reason != "ResourcesDeleted" {
+			t.Errorf("expected the deletion to still be reported, got %#v", condition)
+		}
+	})
+}
+
+// refreshListers lists the flow control resources of the client into the listers of the controller.
+func refreshListers(t *testing.T, c *flowControlController, kubeClient *fake.Clientset) {
+	flowSchemas, err := kubeClient.FlowcontrolV1().FlowSchemas().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flowSchemaIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for i := range flowSchemas.Items {
+		flowSchemaIndexer.Add(&flowSchemas.Items[i])
+	}
+	priorityLevels, err := kubeClient.FlowcontrolV1().PriorityLevelConfigurations().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	priorityLevelIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for i := range priorityLevels.Items {
+		priorityLevelIndexer.Add(&priorityLevels.Items[i])
+	}
+	c.flowSchemaLister = flowcontrollistersv1.NewFlowSchemaLister(flowSchemaIndexer)
+	c.priorityLevelLister = flowcontrollistersv1.NewPriorityLevelConfigurationLister(priorityLevelIndexer)
+}
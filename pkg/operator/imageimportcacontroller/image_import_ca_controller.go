@@ -0,0 +1,225 @@
+package imageimportcacontroller
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/api/annotations"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	configlistersv1 "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// ImageImportCAName is the configmap in the operand namespace holding the CAs trusted when importing images.
+	ImageImportCAName = "image-import-ca"
+
+	// internalRegistryCAName holds the CAs of the internal image registry, maintained by the image registry operator.
+	internalRegistryCAName = "merged-trusted-image-registry-ca"
+
+	conditionType = "ImageImportCADegraded"
+)
+
+// SourceProblems lists the image-import-ca sources that could not be merged.
+type SourceProblems struct {
+	// Missing are referenced sources that do not exist.
+	Missing []string
+	// Invalid are entries that were dropped because they are not parseable PEM certificates.
+	Invalid []string
+}
+
+func (p SourceProblems) message() string {
+	lines := []string{}
+	for _, missing := range p.Missing {
+		lines = append(lines, fmt.Sprintf("missing %s", missing))
+	}
+	for _, invalid := range p.Invalid {
+		lines = append(lines, fmt.Sprintf("dropped %s", invalid))
+	}
+	return strings.Join(lines, "\n")
+}
+
+type imageImportCAController struct {
+	operatorClient   v1helpers.OperatorClient
+	imageLister      configlistersv1.ImageLister
+	configMapLister  corev1listers.ConfigMapLister
+	configMapsGetter corev1client.ConfigMapsGetter
+}
+
+// NewImageImportCAController maintains the image-import-ca configmap in the operand namespace. It merges the CAs of
+// the internal image registry with the CAs referenced by image.config.openshift.io/cluster spec.additionalTrustedCA,
+// drops every entry that isn't a valid PEM certificate bundle and reports the sources it had to skip in the
+// ImageImportCADegraded condition.
+func NewImageImportCAController(
+	operatorClient v1helpers.OperatorClient,
+	imageInformer configv1informers.ImageInformer,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	configMapsGetter corev1client.ConfigMapsGetter,
+	eventRecorder events.Recorder,
+) factory.Controller {
+	c := &imageImportCAController{
+		operatorClient:   operatorClient,
+		imageLister:      imageInformer.Lister(),
+		configMapLister:  kubeInformersForNamespaces.ConfigMapLister(),
+		configMapsGetter: configMapsGetter,
+	}
+
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		imageInformer.Informer(),
+		kubeInformersForNamespaces.InformersFor(operatorclient.GlobalUserSpecifiedConfigNamespace).Core().V1().ConfigMaps().Informer(),
+	).WithFilteredEventsInformers(
+		factory.NamesFilter(internalRegistryCAName, ImageImportCAName),
+		kubeInformersForNamespaces.InformersFor(operatorclient.GlobalMachineSpecifiedConfigNamespace).Core().V1().ConfigMaps().Informer(),
+		kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace).Core().V1().ConfigMaps().Informer(),
+	).ResyncEvery(time.Minute*5).WithSync(c.sync).ToController("ImageImportCAController", eventRecorder.WithComponentSuffix("image-import-ca-controller"))
+}
+
+func (c *imageImportCAController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	operatorSpec, _, _, err := c.operatorClient.GetOperatorState()
+	if err != nil {
+		return err
+	}
+	if operatorSpec.ManagementState != operatorv1.Managed {
+		return nil
+	}
+
+	required, problems, err := RequiredConfigMap(c.imageLister, c.configMapLister)
+	// like before, image-import-ca is left alone until images.config.openshift.io/cluster exists
+	if err == nil && required != nil {
+		// this can leave configmaps mounted without any content, but that should not have an impact on functionality since empty and missing
+		// should logically be treated the same in the case of trust.
+		_, _, err = resourceapply.ApplyConfigMap(ctx, c.configMapsGetter, syncContext.Recorder(), required)
+	}
+
+	condition := operatorv1.OperatorCondition{
+		Type:   conditionType,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+	switch {
+	case err != nil:
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "SyncError"
+		condition.Message = err.Error()
+	case len(problems.Missing) > 0:
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "MissingSource"
+		condition.Message = problems.message()
+	case len(problems.Invalid) > 0:
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "InvalidCertificate"
+		condition.Message = problems.message()
+	}
+	if _, _, updateErr := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(condition)); updateErr != nil {
+		return updateErr
+	}
+	return err
+}
+
+// RequiredConfigMap merges two distinct ConfigMaps, both containing trusted CAs for Image Registries, into the
+// image-import-ca ConfigMap. The first one is the default CA bundle for OpenShift internal registry access, the latter
+// is a custom config map that may be configured by the user on image.config.openshift.io/cluster. Entries that are not
+// valid PEM certificates are left out and reported, as are referenced sources that don't exist. Without
+// image.config.openshift.io/cluster no ConfigMap is returned.
+func RequiredConfigMap(imageLister configlistersv1.ImageLister, configMapLister corev1listers.ConfigMapLister) (*corev1.ConfigMap, SourceProblems, error) {
+	problems := SourceProblems{}
+	cas := map[string]string{}
+
+	internalRegistryCAs, err := configMapLister.ConfigMaps(operatorclient.GlobalMachineSpecifiedConfigNamespace).Get(internalRegistryCAName)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, problems, err
+	} else if err == nil {
+		mergeValidCertificates(cas, internalRegistryCAs, &problems)
+	}
+
+	imageConfig, err := imageLister.Get("cluster")
+	switch {
+	case apierrors.IsNotFound(err):
+		problems.Missing = append(problems.Missing, "images.config.openshift.io/cluster")
+		return nil, problems, nil
+	case err != nil:
+		return nil, problems, err
+	case len(imageConfig.Spec.AdditionalTrustedCA.Name) > 0:
+		additionalImageRegistryCAs, err := configMapLister.ConfigMaps(operatorclient.GlobalUserSpecifiedConfigNamespace).Get(imageConfig.Spec.AdditionalTrustedCA.Name)
+		if apierrors.IsNotFound(err) {
+			problems.Missing = append(problems.Missing, fmt.Sprintf("configmaps/%s[%s] referenced by images.config.openshift.io/cluster spec.additionalTrustedCA", imageConfig.Spec.AdditionalTrustedCA.Name, operatorclient.GlobalUserSpecifiedConfigNamespace))
+		} else if err != nil {
+			return nil, problems, err
+		} else {
+			mergeValidCertificates(cas, additionalImageRegistryCAs, &problems)
+		}
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: operatorclient.TargetNamespace,
+			Name:      ImageImportCAName,
+			Annotations: map[string]string{
+				annotations.OpenShiftComponent: "openshift-apiserver",
+			},
+		},
+		Data: cas,
+	}, problems, nil
+}
+
+func mergeValidCertificates(cas map[string]string, source *corev1.ConfigMap, problems *SourceProblems) {
+	keys := make([]string, 0, len(source.Data))
+	for key := range source.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := validateCertificates(source.Data[key]); err != nil {
+			problems.Invalid = append(problems.Invalid, fmt.Sprintf("configmaps/%s[%s] key %q: %v", source.Name, source.Namespace, key, err))
+			continue
+		}
+		cas[key] = source.Data[key]
+	}
+}
+
+// validateCertificates checks that the bundle consists of one or more PEM encoded x509 certificates and nothing else.
+func validateCertificates(bundle string) error {
+	rest := []byte(bundle)
+	count := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return fmt.Errorf("unexpected PEM block %q", block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return err
+		}
+		count++
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return fmt.Errorf("data that is not PEM encoded")
+	}
+	if count == 0 {
+		return fmt.Errorf("no PEM encoded certificates")
+	}
+	return nil
+}
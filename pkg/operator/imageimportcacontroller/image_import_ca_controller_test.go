@@ -0,0 +1,207 @@
+package imageimportcacontroller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configlistersv1 "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+func newCertificate(t *testing.T) string {
+	ca, err := crypto.MakeSelfSignedCAConfig("registry", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, _, err := ca.GetPEMBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(certPEM)
+}
+
+func TestRequiredConfigMap(t *testing.T) {
+	validCA := newCertificate(t)
+
+	tests := []struct {
+		name            string
+		image           *configv1.Image
+		configMaps      []*corev1.ConfigMap
+		expectedData    map[string]string
+		expectedMissing []string
+		expectedInvalid []string
+		// expectNoConfigMap is set when image-import-ca is not written
+		expectNoConfigMap bool
+	}{
+		{
+			name:         "no sources",
+			image:        &configv1.Image{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}},
+			expectedData: map[string]string{},
+		},
+		{
+			name:  "internal and additional CAs are merged",
+			image: &configv1.Image{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}, Spec: configv1.ImageSpec{AdditionalTrustedCA: configv1.ConfigMapNameReference{Name: "user-ca"}}},
+			configMaps: []*corev1.ConfigMap{
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-config-managed", Name: "merged-trusted-image-registry-ca"}, Data: map[string]string{"image-registry.svc..5000": validCA}},
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-config", Name: "user-ca"}, Data: map[string]string{"registry.example.com": validCA}},
+			},
+			expectedData: map[string]string{"image-registry.svc..5000": validCA, "registry.example.com": validCA},
+		},
+		{
+			name:  "invalid entries are dropped",
+			image: &configv1.Image{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}, Spec: configv1.ImageSpec{AdditionalTrustedCA: configv1.ConfigMapNameReference{Name: "user-ca"}}},
+			configMaps: []*corev1.ConfigMap{
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-config", Name: "user-ca"}, Data: map[string]string{
+					"registry.example.com": validCA,
+					"broken.example.com":   "not a certificate",
+					"trailing.example.com": validCA + "garbage",
+				}},
+			},
+			expectedData:    map[string]string{"registry.example.com": validCA},
+			expectedInvalid: []string{`"broken.example.com"`, `"trailing.example.com"`},
+		},
+		{
+			name:            "missing additionalTrustedCA",
+			image:           &configv1.Image{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}, Spec: configv1.ImageSpec{AdditionalTrustedCA: configv1.ConfigMapNameReference{Name: "user-ca"}}},
+			expectedData:    map[string]string{},
+			expectedMissing: []string{"configmaps/user-ca[openshift-config]"},
+		},
+		{
+			name: "missing image config",
+			configMaps: []*corev1.ConfigMap{
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-config-managed", Name: "merged-trusted-image-registry-ca"}, Data: map[string]string{"image-registry.svc..5000": validCA}},
+			},
+			expectedMissing:   []string{"images.config.openshift.io/cluster"},
+			expectNoConfigMap: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			imageLister, configMapLister := newListers(t, tc.image, tc.configMaps)
+
+			configMap, problems, err := RequiredConfigMap(imageLister, configMapLister)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertProblems(t, "missing", problems.Missing, tc.expectedMissing)
+			assertProblems(t, "invalid", problems.Invalid, tc.expectedInvalid)
+			if tc.expectNoConfigMap {
+				if configMap != nil {
+					t.Errorf("expected no configmap, got %v", configMap)
+				}
+				return
+			}
+			if len(configMap.Data) != len(tc.expectedData) {
+				t.Errorf("expected %d entries, got %v", len(tc.expectedData), configMap.Data)
+			}
+			for key, value := range tc.expectedData {
+				if configMap.Data[key] != value {
+					t.Errorf("unexpected value for %q", key)
+				}
+			}
+		})
+	}
+}
+
+func TestSync(t *testing.T) {
+	imageLister, configMapLister := newListers(t,
+		&configv1.Image{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}, Spec: configv1.ImageSpec{AdditionalTrustedCA: configv1.ConfigMapNameReference{Name: "user-ca"}}},
+		[]*corev1.ConfigMap{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-config", Name: "user-ca"}, Data: map[string]string{"broken.example.com": "not a certificate"}},
+		},
+	)
+	kubeClient := fake.NewSimpleClientset()
+	operatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{}, nil)
+	c := &imageImportCAController{
+		operatorClient:   operatorClient,
+		imageLister:      imageLister,
+		configMapLister:  configMapLister,
+		configMapsGetter: kubeClient.CoreV1(),
+	}
+
+	recorder := events.NewInMemoryRecorder("test", clocktesting.NewFakePassiveClock(time.Now()))
+	if err := c.sync(context.TODO(), factory.NewSyncContext("test", recorder)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := kubeClient.CoreV1().ConfigMaps("openshift-apiserver").Get(context.TODO(), ImageImportCAName, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected image-import-ca to be applied: %v", err)
+	}
+	_, status, _, _ := operatorClient.GetOperatorState()
+	condition := v1helpers.FindOperatorCondition(status.Conditions, conditionType)
+	if condition == nil || condition.Status != operatorv1.ConditionTrue || condition.Reason != "InvalidCertificate" {
+		t.Fatalf("expected %s=True with reason InvalidCertificate, got %#v", conditionType, condition)
+	}
+	if !strings.Contains(condition.Message, `configmaps/user-ca[openshift-config] key "broken.example.com"`) {
+		t.Errorf("expected the invalid entry in the message, got %q", condition.Message)
+	}
+}
+
+func TestSyncWithoutImageConfig(t *testing.T) {
+	imageLister, configMapLister := newListers(t, nil, nil)
+	kubeClient := fake.NewSimpleClientset()
+	operatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{}, nil)
+	c := &imageImportCAController{
+		operatorClient:   operatorClient,
+		imageLister:      imageLister,
+		configMapLister:  configMapLister,
+		configMapsGetter: kubeClient.CoreV1(),
+	}
+
+	recorder := events.NewInMemoryRecorder("test", clocktesting.NewFakePassiveClock(time.Now()))
+	if err := c.sync(context.TODO(), factory.NewSyncContext("test", recorder)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := kubeClient.CoreV1().ConfigMaps("openshift-apiserver").Get(context.TODO(), ImageImportCAName, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected image-import-ca not to be written, got %v", err)
+	}
+	_, status, _, _ := operatorClient.GetOperatorState()
+	condition := v1helpers.FindOperatorCondition(status.Conditions, conditionType)
+	if condition == nil || condition.Status != operatorv1.ConditionTrue || condition.Reason != "MissingSource" {
+		t.Fatalf("expected %s=True with reason MissingSource, got %#v", conditionType, condition)
+	}
+}
+
+func newListers(t *testing.T, image *configv1.Image, configMaps []*corev1.ConfigMap) (configlistersv1.ImageLister, corev1listers.ConfigMapLister) {
+	imageIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if image != nil {
+		if err := imageIndexer.Add(image); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configMapIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, configMap := range configMaps {
+		if err := configMapIndexer.Add(configMap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return configlistersv1.NewImageLister(imageIndexer), corev1listers.NewConfigMapLister(configMapIndexer)
+}
+
+func assertProblems(t *testing.T, kind string, actual, expected []string) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d %s sources, got %v", len(expected), kind, actual)
+	}
+	for i := range expected {
+		if !strings.Contains(actual[i], expected[i]) {
+			t.Errorf("expected %s source %d to mention %s, got %q", kind, i, expected[i], actual[i])
+		}
+	}
+}
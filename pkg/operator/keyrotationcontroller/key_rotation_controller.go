@@ -0,0 +1,318 @@
+package keyrotationcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/encryption/secrets"
+	"github.com/openshift/library-go/pkg/operator/encryption/state"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// ConfigMapName is the configmap in the operator namespace requesting key rotations of openshift-apiserver.
+	ConfigMapName = "encryption-key-rotation"
+	// RotationRequestKey requests a rotation whenever it is set to a new value.
+	RotationRequestKey = "rotationRequest"
+	// RotationPeriodKey sets how long after its migration a key is rotated, e.g. 72h.
+	RotationPeriodKey = "rotationPeriod"
+	// CompletedRotationRequestAnnotation is set on the configmap to the rotation request a key was created for.
+	CompletedRotationRequestAnnotation = "encryption.apiserver.operator.openshift.io/completed-rotation-request"
+
+	// library-go rotates keys a week after their migration on its own, so shorter periods are the only useful ones.
+	// Migrating every resource takes a while, hence the lower bound.
+	minRotationPeriod = time.Hour
+	maxRotationPeriod = 7 * 24 * time.Hour
+
+	// the component the encryption controllers of this operator label their key secrets with
+	component = "openshift-apiserver"
+
+	conditionType         = "EncryptionKeyRotationPending"
+	degradedConditionType = "EncryptionKeyRotationDegraded"
+)
+
+// rotation is the external reason the key controller should create the next key for.
+type rotation struct {
+	// reason is passed to the key controller as encryption.reason. A key is created when it differs from the reason of
+	// the latest key.
+	reason string
+	// kind is the reason of the EncryptionKeyRotationPending condition for a pending rotation, and empty otherwise.
+	kind string
+	// latest is the most recent key, nil without keys.
+	latest *state.KeyState
+	// due is when the latest key is rotated on schedule, zero without a rotation period or a migrated key.
+	due time.Time
+	// configErr reports an invalid rotation period, which is ignored.
+	configErr error
+}
+
+// rotationSchedule decides on rotations from the encryption-key-rotation configmap and the key secrets of
+// openshift-apiserver.
+type rotationSchedule struct {
+	configMapLister corev1listers.ConfigMapLister
+	secretLister    corev1listers.SecretLister
+	now             func() time.Time
+}
+
+func newRotationSchedule(kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces) *rotationSchedule {
+	return &rotationSchedule{
+		configMapLister: kubeInformersForNamespaces.InformersFor(operatorclient.OperatorNamespace).Core().V1().ConfigMaps().Lister(),
+		secretLister:    kubeInformersForNamespaces.InformersFor(operatorclient.GlobalMachineSpecifiedConfigNamespace).Core().V1().Secrets().Lister(),
+		now:             time.Now,
+	}
+}
+
+// next returns the rotation to pass on as encryption.reason. A request of the configmap comes before a rotation period
+// that has passed. Without any of them the reason of the latest key is returned, so that a reason isn't honored again
+// after a later rotation.
+func (s *rotationSchedule) next() (*rotation, error) {
+	selector, err := labels.Parse(secrets.EncryptionKeySecretsLabel + "=" + component)
+	if err != nil {
+		return nil, err
+	}
+	keySecrets, err := s.secretLister.Secrets(operatorclient.GlobalMachineSpecifiedConfigNamespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	keys := []state.KeyState{}
+	reasons := map[string]bool{}
+	for _, keySecret := range keySecrets {
+		key, err := secrets.ToKeyState(keySecret)
+		if err != nil {
+			klog.Warningf("skipping invalid key secret: %v", err)
+			continue
+		}
+		keys = append(keys, key)
+		reasons[key.ExternalReason] = true
+	}
+	keys = state.SortRecentFirst(keys)
+
+	ret := &rotation{}
+	if len(keys) > 0 {
+		ret.latest = &keys[0]
+		ret.reason = keys[0].ExternalReason
+	}
+
+	request, completed, period := "", "", time.Duration(0)
+	configMap, err := s.configMapLister.ConfigMaps(operatorclient.OperatorNamespace).Get(ConfigMapName)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return nil, err
+	default:
+		request, completed = configMap.Data[RotationRequestKey], configMap.Annotations[CompletedRotationRequestAnnotation]
+		if value := configMap.Data[RotationPeriodKey]; len(value) > 0 {
+			period, err = time.ParseDuration(value)
+			if err != nil || period < minRotationPeriod || period > maxRotationPeriod {
+				ret.configErr = fmt.Errorf("%s %q of %s/%s is not a duration between %v and %v", RotationPeriodKey, value, operatorclient.OperatorNamespace, ConfigMapName, minRotationPeriod, maxRotationPeriod)
+				period = 0
+			}
+		}
+	}
+	if ret.latest != nil && period > 0 && !ret.latest.Migrated.Timestamp.IsZero() {
+		ret.due = ret.latest.Migrated.Timestamp.Add(period)
+	}
+
+	switch {
+	case len(request) > 0 && request != completed && !reasons[request]:
+		ret.reason, ret.kind = request, "RotationRequested"
+	case !ret.due.IsZero() && s.now().After(ret.due):
+		ret.reason, ret.kind = fmt.Sprintf("scheduled-rotation-after-key-%s", ret.latest.Key.Name), "RotationPeriodPassed"
+	}
+	return ret, nil
+}
+
+type rotationOperatorClient struct {
+	v1helpers.OperatorClient
+	schedule *rotationSchedule
+}
+
+// NewRotationOperatorClient returns an operator client for the encryption controllers. It sets encryption.reason in
+// unsupportedConfigOverrides to the reason of the next rotation, so that the key controller creates a key for
+// rotations requested by the encryption-key-rotation configmap or due to its rotation period. An encryption.reason set
+// in the operator spec is replaced, rotations are only requested through the configmap.
+func NewRotationOperatorClient(operatorClient v1helpers.OperatorClient, kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces) v1helpers.OperatorClient {
+	return rotationOperatorClient{OperatorClient: operatorClient, schedule: newRotationSchedule(kubeInformersForNamespaces)}
+}
+
+func (c rotationOperatorClient) GetOperatorState() (*operatorv1.OperatorSpec, *operatorv1.OperatorStatus, string, error) {
+	spec, status, resourceVersion, err := c.OperatorClient.GetOperatorState()
+	if err != nil {
+		return spec, status, resourceVersion, err
+	}
+	spec, err = c.withRotationReason(spec)
+	return spec, status, resourceVersion, err
+}
+
+func (c rotationOperatorClient) GetOperatorStateWithQuorum(ctx context.Context) (*operatorv1.OperatorSpec, *operatorv1.OperatorStatus, string, error) {
+	spec, status, resourceVersion, err := c.OperatorClient.GetOperatorStateWithQuorum(ctx)
+	if err != nil {
+		return spec, status, resourceVersion, err
+	}
+	spec, err = c.withRotationReason(spec)
+	return spec, status, resourceVersion, err
+}
+
+func (c rotationOperatorClient) withRotationReason(spec *operatorv1.OperatorSpec) (*operatorv1.OperatorSpec, error) {
+	overrides := map[string]interface{}{}
+	if len(spec.UnsupportedConfigOverrides.Raw) > 0 {
+		if err := json.Unmarshal(spec.UnsupportedConfigOverrides.Raw, &overrides); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal unsupportedConfigOverrides: %v", err)
+		}
+	}
+	encryption, _ := overrides["encryption"].(map[string]interface{})
+	if encryption == nil {
+		encryption = map[string]interface{}{}
+	}
+
+	next, err := c.schedule.next()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := encryption["reason"]; !ok && len(next.reason) == 0 {
+		return spec, nil
+	}
+	encryption["reason"] = next.reason
+	overrides["encryption"] = encryption
+	raw, err := json.Marshal(overrides)
+	if err != nil {
+		return nil, err
+	}
+	withReason := spec.DeepCopy()
+	withReason.UnsupportedConfigOverrides = runtime.RawExtension{Raw: raw}
+	return withReason, nil
+}
+
+type keyRotationController struct {
+	operatorClient   v1helpers.OperatorClient
+	schedule         *rotationSchedule
+	configMapsGetter corev1client.ConfigMapsGetter
+
+	// the pending rotation of the last sync, to emit an event once per rotation. The controller runs a single worker.
+	lastPendingReason string
+}
+
+// NewKeyRotationController reports the pending rotation of the openshift-apiserver encryption keys in the
+// EncryptionKeyRotationPending condition and an invalid rotation period in EncryptionKeyRotationDegraded. It emits
+// an event when a rotation becomes pending and acknowledges a rotation request of the encryption-key-rotation
+// configmap once a key was created for it.
+func NewKeyRotationController(
+	operatorClient v1helpers.OperatorClient,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	configMapsGetter corev1client.ConfigMapsGetter,
+	eventRecorder events.Recorder,
+) factory.Controller {
+	c := &keyRotationController{
+		operatorClient:   operatorClient,
+		schedule:         newRotationSchedule(kubeInformersForNamespaces),
+		configMapsGetter: configMapsGetter,
+	}
+	return factory.New().
+		WithInformers(
+			operatorClient.Informer(),
+			kubeInformersForNamespaces.InformersFor(operatorclient.OperatorNamespace).Core().V1().ConfigMaps().Informer(),
+			kubeInformersForNamespaces.InformersFor(operatorclient.GlobalMachineSpecifiedConfigNamespace).Core().V1().Secrets().Informer(),
+		).
+		ResyncEvery(time.Minute).
+		WithSync(c.sync).
+		ToController("EncryptionKeyRotationController", eventRecorder.WithComponentSuffix("encryption-key-rotation-controller"))
+}
+
+func (c *keyRotationController) sync(ctx context.Context, syncCtx factory.SyncContext) error {
+	next, err := c.schedule.next()
+	if err != nil {
+		return err
+	}
+	if err := c.acknowledgeRequest(ctx, next, syncCtx.Recorder()); err != nil {
+		return err
+	}
+
+	condition := operatorv1.OperatorCondition{
+		Type:   conditionType,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+	switch {
+	case len(next.kind) > 0:
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = next.kind
+		condition.Message = fmt.Sprintf("a key is created for rotation %q once the latest key was migrated", next.reason)
+		if c.lastPendingReason != next.reason {
+			syncCtx.Recorder().Eventf("EncryptionKeyRotationPending", "Rotating the openshift-apiserver encryption key for %q (%s)", next.reason, next.kind)
+		}
+	case next.latest == nil:
+		condition.Message = "no encryption key exists"
+	case !next.due.IsZero():
+		condition.Message = fmt.Sprintf("key %s is rotated after %s", next.latest.Key.Name, next.due.UTC().Format(time.RFC3339))
+	default:
+		condition.Message = fmt.Sprintf("key %s is rotated a week after its migration", next.latest.Key.Name)
+	}
+	c.lastPendingReason = ""
+	if len(next.kind) > 0 {
+		c.lastPendingReason = next.reason
+	}
+
+	degraded := operatorv1.OperatorCondition{
+		Type:   degradedConditionType,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+	if next.configErr != nil {
+		degraded.Status = operatorv1.ConditionTrue
+		degraded.Reason = "InvalidRotationPeriod"
+		degraded.Message = next.configErr.Error()
+	}
+	_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(condition), v1helpers.UpdateConditionFn(degraded))
+	return err
+}
+
+// acknowledgeRequest annotates the configmap with its rotation request once the latest key was created for it, so
+// that the request isn't honored again after the key was pruned.
+func (c *keyRotationController) acknowledgeRequest(ctx context.Context, next *rotation, recorder events.Recorder) error {
+	if next.latest == nil || len(next.latest.ExternalReason) == 0 {
+		return nil
+	}
+	operatorSpec, _, _, err := c.operatorClient.GetOperatorState()
+	if err != nil {
+		return err
+	}
+	if operatorSpec.ManagementState != operatorv1.Managed {
+		return nil
+	}
+	configMap, err := c.schedule.configMapLister.ConfigMaps(operatorclient.OperatorNamespace).Get(ConfigMapName)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	request := configMap.Data[RotationRequestKey]
+	if request != next.latest.ExternalReason || configMap.Annotations[CompletedRotationRequestAnnotation] == request {
+		return nil
+	}
+	acknowledged := configMap.DeepCopy()
+	if acknowledged.Annotations == nil {
+		acknowledged.Annotations = map[string]string{}
+	}
+	acknowledged.Annotations[CompletedRotationRequestAnnotation] = request
+	if _, err := c.configMapsGetter.ConfigMaps(operatorclient.OperatorNamespace).Update(ctx, acknowledged, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	recorder.Eventf("EncryptionKeyRotated", "Created openshift-apiserver encryption key %s for rotation request %q", next.latest.Key.Name, request)
+	return nil
+}
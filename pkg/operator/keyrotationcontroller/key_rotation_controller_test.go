@@ -0,0 +1,275 @@
+package keyrotationcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/encryption/secrets"
+	"github.com/openshift/library-go/pkg/operator/encryption/state"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+var (
+	now        = time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	migratedAt = time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+)
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name          string
+		reasons       []string
+		configMapData map[string]string
+		completed     string
+		expectReason  string
+		expectKind    string
+		expectErr     bool
+	}{
+		{
+			name:         "no configmap",
+			reasons:      []string{"", "initial"},
+			expectReason: "initial",
+		},
+		{
+			name:          "requested",
+			reasons:       []string{""},
+			configMapData: map[string]string{RotationRequestKey: "audit-2024-01"},
+			expectReason:  "audit-2024-01",
+			expectKind:    "RotationRequested",
+		},
+		{
+			name:          "request with a key",
+			reasons:       []string{"", "audit-2024-01"},
+			configMapData: map[string]string{RotationRequestKey: "audit-2024-01"},
+			expectReason:  "audit-2024-01",
+		},
+		{
+			name:          "completed request whose key was pruned",
+			reasons:       []string{"later"},
+			configMapData: map[string]string{RotationRequestKey: "audit-2024-01"},
+			completed:     "audit-2024-01",
+			expectReason:  "later",
+		},
+		{
+			name:          "rotation period passed",
+			reasons:       []string{"", ""},
+			configMapData: map[string]string{RotationPeriodKey: "24h"},
+			expectReason:  "scheduled-rotation-after-key-2",
+			expectKind:    "RotationPeriodPassed",
+		},
+		{
+			name:          "rotation period not passed",
+			reasons:       []string{"", ""},
+			configMapData: map[string]string{RotationPeriodKey: "72h"},
+		},
+		{
+			name:          "invalid rotation period",
+			reasons:       []string{"", ""},
+			configMapData: map[string]string{RotationPeriodKey: "10m"},
+			expectErr:     true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			schedule := newTestSchedule(t, tc.reasons, tc.configMapData, tc.completed)
+			next, err := schedule.next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next.reason != tc.expectReason || next.kind != tc.expectKind {
+				t.Errorf("expected reason %q (%q), got %q (%q)", tc.expectReason, tc.expectKind, next.reason, next.kind)
+			}
+			if (next.configErr != nil) != tc.expectErr {
+				t.Errorf("expected error %v, got %v", tc.expectErr, next.configErr)
+			}
+		})
+	}
+}
+
+func TestRotationOperatorClient(t *testing.T) {
+	spec := &operatorv1.OperatorSpec{
+		ManagementState:            operatorv1.Managed,
+		UnsupportedConfigOverrides: runtime.RawExtension{Raw: []byte(`{"rollout":{"maxUnavailable":1}}`)},
+	}
+	operatorClient := v1helpers.NewFakeOperatorClient(spec, &operatorv1.OperatorStatus{}, nil)
+	c := rotationOperatorClient{
+		OperatorClient: operatorClient,
+		schedule:       newTestSchedule(t, []string{""}, map[string]string{RotationRequestKey: "audit-2024-01"}, ""),
+	}
+
+	actual, _, _, err := c.GetOperatorState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrides := map[string]interface{}{}
+	if err := json.Unmarshal(actual.UnsupportedConfigOverrides.Raw, &overrides); err != nil {
+		t.Fatal(err)
+	}
+	if reason := overrides["encryption"].(map[string]interface{})["reason"]; reason != "audit-2024-01" {
+		t.Errorf("expected encryption.reason audit-2024-01, got %v", reason)
+	}
+	if overrides["rollout"] == nil {
+		t.Errorf("expected the other overrides to be kept, got %s", actual.UnsupportedConfigOverrides.Raw)
+	}
+
+	original, _, _, _ := operatorClient.GetOperatorState()
+	if string(original.UnsupportedConfigOverrides.Raw) != `{"rollout":{"maxUnavailable":1}}` {
+		t.Errorf("expected the operator spec to be unchanged, got %s", original.UnsupportedConfigOverrides.Raw)
+	}
+}
+
+func TestRotationOperatorClientReplacesEncryptionReason(t *testing.T) {
+	spec := &operatorv1.OperatorSpec{
+		ManagementState:            operatorv1.Managed,
+		UnsupportedConfigOverrides: runtime.RawExtension{Raw: []byte(`{"encryption":{"reason":"manual"}}`)},
+	}
+	c := rotationOperatorClient{
+		OperatorClient: v1helpers.NewFakeOperatorClient(spec, &operatorv1.OperatorStatus{}, nil),
+		schedule:       newTestSchedule(t, []string{"initial"}, nil, ""),
+	}
+
+	actual, _, _, err := c.GetOperatorState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(actual.UnsupportedConfigOverrides.Raw) != `{"encryption":{"reason":"initial"}}` {
+		t.Errorf("expected encryption.reason of the latest key, got %s", actual.UnsupportedConfigOverrides.Raw)
+	}
+}
+
+func TestKeyRotationController(t *testing.T) {
+	tests := []struct {
+		name            string
+		reasons         []string
+		configMapData   map[string]string
+		unmanaged       bool
+		expectStatus    operatorv1.ConditionStatus
+		expectReason    string
+		expectDegraded  operatorv1.ConditionStatus
+		expectCompleted string
+	}{
+		{
+			name:           "pending request",
+			reasons:        []string{""},
+			configMapData:  map[string]string{RotationRequestKey: "audit-2024-01"},
+			expectStatus:   operatorv1.ConditionTrue,
+			expectReason:   "RotationRequested",
+			expectDegraded: operatorv1.ConditionFalse,
+		},
+		{
+			name:            "completed request",
+			reasons:         []string{"", "audit-2024-01"},
+			configMapData:   map[string]string{RotationRequestKey: "audit-2024-01"},
+			expectStatus:    operatorv1.ConditionFalse,
+			expectReason:    "AsExpected",
+			expectDegraded:  operatorv1.ConditionFalse,
+			expectCompleted: "audit-2024-01",
+		},
+		{
+			name:           "completed request while unmanaged",
+			reasons:        []string{"", "audit-2024-01"},
+			configMapData:  map[string]string{RotationRequestKey: "audit-2024-01"},
+			unmanaged:      true,
+			expectStatus:   operatorv1.ConditionFalse,
+			expectReason:   "AsExpected",
+			expectDegraded: operatorv1.ConditionFalse,
+		},
+		{
+			name:           "invalid rotation period",
+			reasons:        []string{""},
+			configMapData:  map[string]string{RotationPeriodKey: "30d"},
+			expectStatus:   operatorv1.ConditionFalse,
+			expectReason:   "AsExpected",
+			expectDegraded: operatorv1.ConditionTrue,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			schedule := newTestSchedule(t, tc.reasons, tc.configMapData, "")
+			configMap, err := schedule.configMapLister.ConfigMaps("openshift-apiserver-operator").Get(ConfigMapName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kubeClient := fake.NewSimpleClientset(configMap)
+			managementState := operatorv1.Managed
+			if tc.unmanaged {
+				managementState = operatorv1.Unmanaged
+			}
+			operatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: managementState}, &operatorv1.OperatorStatus{}, nil)
+			c := &keyRotationController{operatorClient: operatorClient, schedule: schedule, configMapsGetter: kubeClient.CoreV1()}
+			if err := c.sync(context.Background(), factory.NewSyncContext("test", events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(now)))); err != nil {
+				t.Fatal(err)
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, conditionType)
+			if condition == nil || condition.Status != tc.expectStatus || condition.Reason != tc.expectReason {
+				t.Errorf("expected %s %s, got %#v", tc.expectStatus, tc.expectReason, condition)
+			}
+			degraded := v1helpers.FindOperatorCondition(status.Conditions, degradedConditionType)
+			if degraded == nil || degraded.Status != tc.expectDegraded {
+				t.Errorf("expected degraded %s, got %#v", tc.expectDegraded, degraded)
+			}
+
+			actual, err := kubeClient.CoreV1().ConfigMaps("openshift-apiserver-operator").Get(context.Background(), ConfigMapName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if completed := actual.Annotations[CompletedRotationRequestAnnotation]; completed != tc.expectCompleted {
+				t.Errorf("expected completed rotation request %q, got %q", tc.expectCompleted, completed)
+			}
+		})
+	}
+}
+
+// newTestSchedule returns a schedule with a migrated key for each of the given reasons, the last one being the latest,
+// and the encryption-key-rotation configmap if data is given.
+func newTestSchedule(t *testing.T, reasons []string, data map[string]string, completed string) *rotationSchedule {
+	secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for i, reason := range reasons {
+		secret, err := secrets.FromKeyState("openshift-apiserver", state.KeyState{
+			Key:            apiserverv1.Key{Name: string(rune('1' + i)), Secret: "NzFlYTdjOTE0MTlhNjhmZDEyMjRmODhkNTAzMTZiNGU="},
+			Mode:           state.AESCBC,
+			Migrated:       state.MigrationState{Timestamp: migratedAt, Resources: []schema.GroupResource{{Group: "route.openshift.io", Resource: "routes"}}},
+			ExternalReason: reason,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := secretIndexer.Add(secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configMapIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if data != nil {
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver-operator", Name: ConfigMapName},
+			Data:       data,
+		}
+		if len(completed) > 0 {
+			configMap.Annotations = map[string]string{CompletedRotationRequestAnnotation: completed}
+		}
+		if err := configMapIndexer.Add(configMap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &rotationSchedule{
+		configMapLister: corev1listers.NewConfigMapLister(configMapIndexer),
+		secretLister:    corev1listers.NewSecretLister(secretIndexer),
+		now:             func() time.Time { return now },
+	}
+}
@@ -0,0 +1,273 @@
+package managementstatecontroller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	apiregistrationv1client "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset/typed/apiregistration/v1"
+	apiregistrationinformers "k8s.io/kube-aggregator/pkg/client/informers/externalversions"
+	apiregistrationv1listers "k8s.io/kube-aggregator/pkg/client/listers/apiregistration/v1"
+	"k8s.io/utils/ptr"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/apiserver/controller/apiservice"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// RemovalConditionType reports the progress of taking the operand down while the operator is Removed.
+	RemovalConditionType = "OperandRemovalProgressing"
+
+	reasonDeletingAPIServices = "DeletingAPIServices"
+	reasonScalingDown         = "ScalingDown"
+	reasonDeletingNamespace   = "DeletingNamespace"
+	reasonRemoved             = "Removed"
+
+	// removalPollInterval is how often the removal is checked while waiting for kube to delete something.
+	removalPollInterval = 15 * time.Second
+)
+
+// operandConfigMaps are the configmaps of the operand that are deleted after its pods are gone.
+var operandConfigMaps = []string{"config", "image-import-ca", "audit"}
+
+type removalController struct {
+	operatorClient    v1helpers.OperatorClient
+	getAPIServicesFn  apiservice.GetAPIServicesToMangeFunc
+	apiServiceLister  apiregistrationv1listers.APIServiceLister
+	apiServicesGetter apiregistrationv1client.APIServicesGetter
+	deploymentLister  appsv1listers.DeploymentLister
+	namespaceLister   corev1listers.NamespaceLister
+	kubeClient        kubernetes.Interface
+}
+
+// NewRemovalController takes the operand down in order when the operator is Removed: it deletes the APIServices first,
+// so that nothing is routed to openshift-apiserver anymore, then scales the deployment down and deletes it, the PDB,
+// the service and the config, and finally deletes the namespace. The namespace finalizer is cleared by the
+// nsfinalizercontroller. The steps are reported in the OperandRemovalProgressing condition, which the operator client
+// returned by NewRemovalGatedOperatorClient follows.
+func NewRemovalController(
+	operatorClient v1helpers.OperatorClient,
+	getAPIServicesFn apiservice.GetAPIServicesToMangeFunc,
+	apiregistrationInformers apiregistrationinformers.SharedInformerFactory,
+	apiServicesGetter apiregistrationv1client.APIServicesGetter,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	kubeClient kubernetes.Interface,
+	eventRecorder events.Recorder,
+) factory.Controller {
+	c := &removalController{
+		operatorClient:    operatorClient,
+		getAPIServicesFn:  getAPIServicesFn,
+		apiServiceLister:  apiregistrationInformers.Apiregistration().V1().APIServices().Lister(),
+		apiServicesGetter: apiServicesGetter,
+		deploymentLister:  kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace).Apps().V1().Deployments().Lister(),
+		namespaceLister:   kubeInformersForNamespaces.InformersFor("").Core().V1().Namespaces().Lister(),
+		kubeClient:        kubeClient,
+	}
+
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		apiregistrationInformers.Apiregistration().V1().APIServices().Informer(),
+		kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace).Apps().V1().Deployments().Informer(),
+		kubeInformersForNamespaces.InformersFor("").Core().V1().Namespaces().Informer(),
+	).ResyncEvery(time.Minute).WithSync(c.sync).ToController("OperandRemovalController", eventRecorder.WithComponentSuffix("operand-removal-controller"))
+}
+
+func (c *removalController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	operatorSpec, operatorStatus, _, err := c.operatorClient.GetOperatorState()
+	if err != nil {
+		return err
+	}
+	if operatorSpec.ManagementState != operatorv1.Removed {
+		// a removal that was interrupted by managing the operand again, or a removed operand that is about to come back
+		if v1helpers.FindOperatorCondition(operatorStatus.Conditions, RemovalConditionType) == nil {
+			return nil
+		}
+		_, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, func(status *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&status.Conditions, RemovalConditionType)
+			return nil
+		})
+		return err
+	}
+
+	reason, message, removeErr := c.remove(ctx, syncContext.Recorder())
+	condition := operatorv1.OperatorCondition{
+		Type:    RemovalConditionType,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	}
+	if removeErr != nil {
+		condition.Message = removeErr.Error()
+	}
+	if reason == reasonRemoved {
+		condition.Status = operatorv1.ConditionFalse
+	}
+	if _, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(condition)); err != nil {
+		return err
+	}
+	if removeErr != nil {
+		return removeErr
+	}
+	if reason != reasonRemoved {
+		syncContext.Queue().AddAfter(syncContext.QueueKey(), removalPollInterval)
+	}
+	return nil
+}
+
+// remove runs the first step of the removal that isn't done yet and returns the reason and message describing it.
+func (c *removalController) remove(ctx context.Context, recorder events.Recorder) (string, string, error) {
+	enabled, disabled, err := c.getAPIServicesFn()
+	if err != nil {
+		return reasonDeletingAPIServices, "", err
+	}
+	remaining := []string{}
+	for _, required := range append(enabled, disabled...) {
+		existing, err := c.apiServiceLister.Get(required.Name)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return reasonDeletingAPIServices, "", err
+		}
+		remaining = append(remaining, existing.Name)
+		if existing.DeletionTimestamp != nil {
+			continue
+		}
+		if err := c.apiServicesGetter.APIServices().Delete(ctx, existing.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return reasonDeletingAPIServices, "", err
+		}
+		recorder.Eventf("APIServiceDeleted", "Deleted apiservices.apiregistration.k8s.io/%s because the operator is Removed", existing.Name)
+	}
+	if len(remaining) > 0 {
+		return reasonDeletingAPIServices, fmt.Sprintf("waiting for apiservices.apiregistration.k8s.io/%s to be deleted", strings.Join(remaining, ", ")), nil
+	}
+
+	deployment, err := c.deploymentLister.Deployments(operatorclient.TargetNamespace).Get("apiserver")
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return reasonScalingDown, "", err
+	case deployment.Spec.Replicas == nil || *deployment.Spec.Replicas > 0:
+		scaledDown := deployment.DeepCopy()
+		scaledDown.Spec.Replicas = ptr.To[int32](0)
+		if _, err := c.kubeClient.AppsV1().Deployments(operatorclient.TargetNamespace).Update(ctx, scaledDown, metav1.UpdateOptions{}); err != nil {
+			return reasonScalingDown, "", err
+		}
+		recorder.Eventf("DeploymentScaledDown", "Scaled deployment.apps/apiserver -n %s down because the operator is Removed", operatorclient.TargetNamespace)
+		return reasonScalingDown, "scaling deployment.apps/apiserver down", nil
+	case deployment.Status.Replicas > 0:
+		return reasonScalingDown, fmt.Sprintf("waiting for %d pods of deployment.apps/apiserver to terminate", deployment.Status.Replicas), nil
+	}
+	namespace, err := c.namespaceLister.Get(operatorclient.TargetNamespace)
+	if apierrors.IsNotFound(err) {
+		return reasonRemoved, "the operand was removed", nil
+	}
+	if err != nil {
+		return reasonDeletingNamespace, "", err
+	}
+
+	deleted, err := c.deleteOperand(ctx)
+	if err != nil {
+		return reasonScalingDown, "", err
+	}
+	if len(deleted) > 0 {
+		recorder.Eventf("OperandDeleted", "Deleted %s -n %s because the operator is Removed", strings.Join(deleted, ", "), operatorclient.TargetNamespace)
+	}
+
+	if namespace.DeletionTimestamp == nil {
+		if err := c.kubeClient.CoreV1().Namespaces().Delete(ctx, namespace.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return reasonDeletingNamespace, "", err
+		}
+		recorder.Eventf("NamespaceDeleted", "Deleted namespace %s because the operator is Removed", namespace.Name)
+	}
+	return reasonDeletingNamespace, fmt.Sprintf("waiting for namespace %s to be deleted", namespace.Name), nil
+}
+
+// deleteOperand deletes the scaled down deployment and the resources its pods used, and returns those that existed.
+func (c *removalController) deleteOperand(ctx context.Context) ([]string, error) {
+	namespace := operatorclient.TargetNamespace
+	deletes := map[string]func() error{
+		"deployment.apps/apiserver": func() error {
+			return c.kubeClient.AppsV1().Deployments(namespace).Delete(ctx, "apiserver", metav1.DeleteOptions{})
+		},
+		"poddisruptionbudget.policy/openshift-apiserver-pdb": func() error {
+			return c.kubeClient.PolicyV1().PodDisruptionBudgets(namespace).Delete(ctx, "openshift-apiserver-pdb", metav1.DeleteOptions{})
+		},
+		"service/api": func() error {
+			return c.kubeClient.CoreV1().Services(namespace).Delete(ctx, "api", metav1.DeleteOptions{})
+		},
+	}
+	for _, name := range operandConfigMaps {
+		name := name
+		deletes["configmap/"+name] = func() error {
+			return c.kubeClient.CoreV1().ConfigMaps(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		}
+	}
+
+	deleted := []string{}
+	for _, resource := range sets.StringKeySet(deletes).List() {
+		err := deletes[resource]()
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, resource)
+	}
+	return deleted, nil
+}
+
+type removalGatedOperatorClient struct {
+	v1helpers.OperatorClient
+}
+
+// NewRemovalGatedOperatorClient returns an operator client for the library-go controllers that delete the operand
+// namespace or its resources on their own when the operator is Removed. It reports Removed as Unmanaged until the
+// removal controller deleted the APIServices and the workload, so that the namespace isn't deleted while an
+// aggregated API still points to it.
+func NewRemovalGatedOperatorClient(operatorClient v1helpers.OperatorClient) v1helpers.OperatorClient {
+	return removalGatedOperatorClient{OperatorClient: operatorClient}
+}
+
+func (c removalGatedOperatorClient) GetOperatorState() (*operatorv1.OperatorSpec, *operatorv1.OperatorStatus, string, error) {
+	spec, status, resourceVersion, err := c.OperatorClient.GetOperatorState()
+	if err != nil {
+		return spec, status, resourceVersion, err
+	}
+	return gatedSpec(spec, status), status, resourceVersion, nil
+}
+
+func (c removalGatedOperatorClient) GetOperatorStateWithQuorum(ctx context.Context) (*operatorv1.OperatorSpec, *operatorv1.OperatorStatus, string, error) {
+	spec, status, resourceVersion, err := c.OperatorClient.GetOperatorStateWithQuorum(ctx)
+	if err != nil {
+		return spec, status, resourceVersion, err
+	}
+	return gatedSpec(spec, status), status, resourceVersion, nil
+}
+
+func gatedSpec(spec *operatorv1.OperatorSpec, status *operatorv1.OperatorStatus) *operatorv1.OperatorSpec {
+	if spec.ManagementState != operatorv1.Removed {
+		return spec
+	}
+	if condition := v1helpers.FindOperatorCondition(status.Conditions, RemovalConditionType); condition != nil {
+		if condition.Reason == reasonDeletingNamespace || condition.Reason == reasonRemoved {
+			return spec
+		}
+	}
+	gated := spec.DeepCopy()
+	gated.ManagementState = operatorv1.Unmanaged
+	return gated
+}
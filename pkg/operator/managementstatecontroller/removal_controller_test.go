@@ -0,0 +1,197 @@
+package managementstatecontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	apiregistrationv1listers "k8s.io/kube-aggregator/pkg/client/listers/apiregistration/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+func TestRemovalController(t *testing.T) {
+	now := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	apiService := &apiregistrationv1.APIService{ObjectMeta: metav1.ObjectMeta{Name: "v1.route.openshift.io"}}
+	deployment := func(replicas, podReplicas int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "apiserver"},
+			Spec:       appsv1.DeploymentSpec{Replicas: ptr.To(replicas)},
+			Status:     appsv1.DeploymentStatus{Replicas: podReplicas},
+		}
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "openshift-apiserver"}}
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "config"}}
+
+	tests := []struct {
+		name          string
+		apiService    *apiregistrationv1.APIService
+		deployment    *appsv1.Deployment
+		namespace     *corev1.Namespace
+		expectReason  string
+		expectStatus  operatorv1.ConditionStatus
+		expectActions []string
+	}{
+		{
+			name:         "apiservice being deleted",
+			apiService:   func() *apiregistrationv1.APIService { a := apiService.DeepCopy(); a.DeletionTimestamp = &now; return a }(),
+			deployment:   deployment(3, 3),
+			namespace:    namespace,
+			expectReason: reasonDeletingAPIServices,
+			expectStatus: operatorv1.ConditionTrue,
+		},
+		{
+			name:          "scale down",
+			deployment:    deployment(3, 3),
+			namespace:     namespace,
+			expectReason:  reasonScalingDown,
+			expectStatus:  operatorv1.ConditionTrue,
+			expectActions: []string{"update deployments"},
+		},
+		{
+			name:         "pods terminating",
+			deployment:   deployment(0, 2),
+			namespace:    namespace,
+			expectReason: reasonScalingDown,
+			expectStatus: operatorv1.ConditionTrue,
+		},
+		{
+			name:       "scaled down",
+			deployment: deployment(0, 0),
+			namespace:  namespace,
+			// the deletes of the resources that don't exist aren't reported, but still made
+			expectReason: reasonDeletingNamespace,
+			expectStatus: operatorv1.ConditionTrue,
+			expectActions: []string{
+				"delete configmaps", "delete configmaps", "delete configmaps",
+				"delete deployments", "delete poddisruptionbudgets", "delete services", "delete namespaces",
+			},
+		},
+		{
+			name:         "removed",
+			expectReason: reasonRemoved,
+			expectStatus: operatorv1.ConditionFalse,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			apiServiceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tc.apiService != nil {
+				apiServiceIndexer.Add(tc.apiService)
+			}
+			deploymentIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			namespaceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			kubeClient := fake.NewSimpleClientset(configMap)
+			if tc.deployment != nil {
+				deploymentIndexer.Add(tc.deployment)
+				kubeClient.Tracker().Add(tc.deployment)
+			}
+			if tc.namespace != nil {
+				namespaceIndexer.Add(tc.namespace)
+				kubeClient.Tracker().Add(tc.namespace)
+			}
+			kubeClient.ClearActions()
+
+			operatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Removed}, &operatorv1.OperatorStatus{}, nil)
+			c := &removalController{
+				operatorClient: operatorClient,
+				getAPIServicesFn: func() ([]*apiregistrationv1.APIService, []*apiregistrationv1.APIService, error) {
+					return []*apiregistrationv1.APIService{apiService}, nil, nil
+				},
+				apiServiceLister: apiregistrationv1listers.NewAPIServiceLister(apiServiceIndexer),
+				deploymentLister: appsv1listers.NewDeploymentLister(deploymentIndexer),
+				namespaceLister:  corev1listers.NewNamespaceLister(namespaceIndexer),
+				kubeClient:       kubeClient,
+			}
+			recorder := events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(now.Time))
+			if err := c.sync(context.Background(), factory.NewSyncContext("test", recorder)); err != nil {
+				t.Fatal(err)
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, RemovalConditionType)
+			if condition == nil || condition.Reason != tc.expectReason || condition.Status != tc.expectStatus {
+				t.Errorf("expected %s %s, got %#v", tc.expectStatus, tc.expectReason, condition)
+			}
+			actions := []string{}
+			for _, action := range kubeClient.Actions() {
+				actions = append(actions, action.GetVerb()+" "+action.GetResource().Resource)
+			}
+			if len(actions) != len(tc.expectActions) {
+				t.Fatalf("expected actions %v, got %v", tc.expectActions, actions)
+			}
+			for i := range actions {
+				if actions[i] != tc.expectActions[i] {
+					t.Errorf("expected actions %v, got %v", tc.expectActions, actions)
+					break
+				}
+			}
+		})
+	}
+
+	t.Run("managed again", func(t *testing.T) {
+		operatorClient := v1helpers.NewFakeOperatorClient(
+			&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+			&operatorv1.OperatorStatus{Conditions: []operatorv1.OperatorCondition{{Type: RemovalConditionType, Status: operatorv1.ConditionTrue, Reason: reasonScalingDown}}},
+			nil,
+		)
+		c := &removalController{operatorClient: operatorClient}
+		if err := c.sync(context.Background(), factory.NewSyncContext("test", events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(now.Time)))); err != nil {
+			t.Fatal(err)
+		}
+		_, status, _, _ := operatorClient.GetOperatorState()
+		if condition := v1helpers.FindOperatorCondition(status.Conditions, RemovalConditionType); condition != nil {
+			t.Errorf("expected the removal condition to be removed, got %#v", condition)
+		}
+	})
+}
+
+func TestRemovalGatedOperatorClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       operatorv1.ManagementState
+		reason      string
+		expectState operatorv1.ManagementState
+	}{
+		{name: "managed", state: operatorv1.Managed, expectState: operatorv1.Managed},
+		{name: "unmanaged", state: operatorv1.Unmanaged, expectState: operatorv1.Unmanaged},
+		{name: "removal not started", state: operatorv1.Removed, expectState: operatorv1.Unmanaged},
+		{name: "scaling down", state: operatorv1.Removed, reason: reasonScalingDown, expectState: operatorv1.Unmanaged},
+		{name: "deleting the namespace", state: operatorv1.Removed, reason: reasonDeletingNamespace, expectState: operatorv1.Removed},
+		{name: "removed", state: operatorv1.Removed, reason: reasonRemoved, expectState: operatorv1.Removed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status := &operatorv1.OperatorStatus{}
+			if len(tc.reason) > 0 {
+				status.Conditions = []operatorv1.OperatorCondition{{Type: RemovalConditionType, Status: operatorv1.ConditionTrue, Reason: tc.reason}}
+			}
+			operatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: tc.state}, status, nil)
+			gated := NewRemovalGatedOperatorClient(operatorClient)
+
+			spec, _, _, err := gated.GetOperatorState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spec.ManagementState != tc.expectState {
+				t.Errorf("expected %s, got %s", tc.expectState, spec.ManagementState)
+			}
+			if original, _, _, _ := operatorClient.GetOperatorState(); original.ManagementState != tc.state {
+				t.Errorf("expected the spec of the operator client to be left alone, got %s", original.ManagementState)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8smetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+
+	operatorcontrolplanev1alpha1 "github.com/openshift/api/operatorcontrolplane/v1alpha1"
+	operatorcontrolplanelisters "github.com/openshift/client-go/operatorcontrolplane/listers/operatorcontrolplane/v1alpha1"
+)
+
+var failingConnectivityChecksDesc = k8smetrics.NewDesc(
+	namespace+"_connectivity_checks_failing",
+	"The number of PodNetworkConnectivityChecks whose target is not reachable, labeled with the type of the target",
+	[]string{"target_type"},
+	nil,
+	k8smetrics.ALPHA,
+	"",
+)
+
+// targetTypeFunc returns the type of the target of a check.
+type targetTypeFunc func(check *operatorcontrolplanev1alpha1.PodNetworkConnectivityCheck) string
+
+// connectivityCheckCollector counts the failing PodNetworkConnectivityChecks when scraped.
+type connectivityCheckCollector struct {
+	k8smetrics.BaseStableCollector
+
+	lister     operatorcontrolplanelisters.PodNetworkConnectivityCheckNamespaceLister
+	targetType targetTypeFunc
+}
+
+// RegisterConnectivityCheckCollector reports the failing PodNetworkConnectivityChecks of the lister by the type of
+// their target, as returned by targetType.
+func RegisterConnectivityCheckCollector(lister operatorcontrolplanelisters.PodNetworkConnectivityCheckNamespaceLister, targetType targetTypeFunc) {
+	legacyregistry.CustomMustRegister(newConnectivityCheckCollector(lister, targetType))
+}
+
+func newConnectivityCheckCollector(lister operatorcontrolplanelisters.PodNetworkConnectivityCheckNamespaceLister, targetType targetTypeFunc) k8smetrics.StableCollector {
+	return &connectivityCheckCollector{lister: lister, targetType: targetType}
+}
+
+func (c *connectivityCheckCollector) DescribeWithStability(ch chan<- *k8smetrics.Desc) {
+	ch <- failingConnectivityChecksDesc
+}
+
+func (c *connectivityCheckCollector) CollectWithStability(ch chan<- k8smetrics.Metric) {
+	checks, err := c.lister.List(labels.Everything())
+	if err != nil {
+		klog.Warningf("failed to list the PodNetworkConnectivityChecks: %v", err)
+		return
+	}
+	// every target type with a check is reported, so that a recovered target goes back to 0
+	failing := map[string]int{}
+	for _, check := range checks {
+		targetType := c.targetType(check)
+		if _, ok := failing[targetType]; !ok {
+			failing[targetType] = 0
+		}
+		for _, condition := range check.Status.Conditions {
+			if condition.Type == operatorcontrolplanev1alpha1.Reachable && condition.Status == metav1.ConditionFalse {
+				failing[targetType]++
+			}
+		}
+	}
+	for targetType, count := range failing {
+		ch <- k8smetrics.NewLazyConstMetric(failingConnectivityChecksDesc, k8smetrics.GaugeValue, float64(count), targetType)
+	}
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	k8smetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const namespace = "openshift_apiserver_operator"
+
+// States of an encryption migration.
+const (
+	MigrationRunning   = "Running"
+	MigrationSucceeded = "Succeeded"
+	MigrationFailed    = "Failed"
+)
+
+// metrics provides access to the metrics of the operator, they are served on the metrics endpoint of the operator.
+var metrics *operatorMetrics
+
+func init() {
+	metrics = newOperatorMetrics(legacyregistry.Register)
+}
+
+// operatorMetrics instruments the operator specific parts of the operator, the generic controller metrics come from
+// library-go.
+type operatorMetrics struct {
+	syncStepDuration            *k8smetrics.HistogramVec
+	syncStepErrors              *k8smetrics.CounterVec
+	observedConfigChanges       *k8smetrics.CounterVec
+	rolloutDuration             *k8smetrics.Histogram
+	lastRolloutDuration         *k8smetrics.GaugeVec
+	encryptionMigrationDuration *k8smetrics.GaugeVec
+}
+
+// newOperatorMetrics creates the metrics of the operator and registers them with registerFunc.
+func newOperatorMetrics(registerFunc func(k8smetrics.Registerable) error) *operatorMetrics {
+	syncStepDuration := k8smetrics.NewHistogramVec(
+		&k8smetrics.HistogramOpts{
+			Namespace: namespace,
+			Name:      "workload_sync_step_duration_seconds",
+			Help:      "How long a step of the workload sync takes in seconds, labeled with the step",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"step"})
+	registerFunc(syncStepDuration)
+
+	syncStepErrors := k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: namespace,
+			Name:      "workload_sync_step_errors_total",
+			Help:      "The total number of failed steps of the workload sync, labeled with the step",
+		}, []string{"step"})
+	registerFunc(syncStepErrors)
+
+	observedConfigChanges := k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: namespace,
+			Name:      "observed_config_changes_total",
+			Help:      "The total number of changes of the observedConfig, labeled with the config observer that changed it",
+		}, []string{"observer"})
+	registerFunc(observedConfigChanges)
+
+	rolloutDuration := k8smetrics.NewHistogram(
+		&k8smetrics.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rollout_duration_seconds",
+			Help:      "How long it takes in seconds until the pod template of a revision is available",
+			Buckets:   prometheus.ExponentialBuckets(15, 2, 10),
+		})
+	registerFunc(rolloutDuration)
+
+	lastRolloutDuration := k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_rollout_duration_seconds",
+			Help:      "How long it took in seconds until the pod template of the last rolled out revision was available, labeled with the revision",
+		}, []string{"revision"})
+	registerFunc(lastRolloutDuration)
+
+	encryptionMigrationDuration := k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: namespace,
+			Name:      "encryption_migration_duration_seconds",
+			Help:      "How long the migration of a resource to its write key took in seconds, or is running for, labeled with the resource and the state of the migration (Running, Succeeded or Failed)",
+		}, []string{"resource", "state"})
+	registerFunc(encryptionMigrationDuration)
+
+	return &operatorMetrics{
+		syncStepDuration:            syncStepDuration,
+		syncStepErrors:              syncStepErrors,
+		observedConfigChanges:       observedConfigChanges,
+		rolloutDuration:             rolloutDuration,
+		lastRolloutDuration:         lastRolloutDuration,
+		encryptionMigrationDuration: encryptionMigrationDuration,
+	}
+}
+
+// ObserveSyncStep records the duration of a step of the workload sync, and counts it as failed when err is set.
+func ObserveSyncStep(step string, started time.Time, err error) {
+	metrics.syncStepDuration.WithLabelValues(step).Observe(time.Since(started).Seconds())
+	if err != nil {
+		metrics.syncStepErrors.WithLabelValues(step).Inc()
+	}
+}
+
+// ObserveObservedConfigChange counts a change of the observedConfig made by the given config observer.
+func ObserveObservedConfigChange(observer string) {
+	metrics.observedConfigChanges.WithLabelValues(observer).Inc()
+}
+
+// ObserveRollout records how long the rollout of a revision took. Only the last revision is reported by revision,
+// the previous ones are in the histogram.
+func ObserveRollout(revision int32, duration time.Duration) {
+	metrics.rolloutDuration.Observe(duration.Seconds())
+	metrics.lastRolloutDuration.Reset()
+	metrics.lastRolloutDuration.WithLabelValues(strconv.Itoa(int(revision))).Set(duration.Seconds())
+}
+
+// EncryptionMigration is the migration of a resource to its write key.
+type EncryptionMigration struct {
+	Resource string
+	State    string
+	Duration time.Duration
+}
+
+// SetEncryptionMigrations replaces the reported encryption migrations, resources without a migration to their write
+// key are not reported.
+func SetEncryptionMigrations(migrations []EncryptionMigration) {
+	metrics.encryptionMigrationDuration.Reset()
+	for _, migration := range migrations {
+		metrics.encryptionMigrationDuration.WithLabelValues(migration.Resource, migration.State).Set(migration.Duration.Seconds())
+	}
+}
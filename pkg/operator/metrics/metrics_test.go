@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/component-base/metrics/testutil"
+
+	operatorcontrolplanev1alpha1 "github.com/openshift/api/operatorcontrolplane/v1alpha1"
+	operatorcontrolplanelisters "github.com/openshift/client-go/operatorcontrolplane/listers/operatorcontrolplane/v1alpha1"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/connectivitycheckcontroller"
+)
+
+func TestOperatorMetrics(t *testing.T) {
+	registry := testutil.NewFakeKubeRegistry("1.33.0")
+	backup := metrics
+	metrics = newOperatorMetrics(registry.Register)
+	defer func() { metrics = backup }()
+
+	ObserveSyncStep("configmap", time.Now(), nil)
+	ObserveSyncStep("deployments", time.Now(), errors.New("failed"))
+	ObserveSyncStep("deployments", time.Now(), nil)
+	ObserveObservedConfigChange("Proxy")
+	ObserveObservedConfigChange("Proxy")
+	ObserveRollout(7, 2*time.Minute)
+	ObserveRollout(8, 3*time.Minute)
+	SetEncryptionMigrations([]EncryptionMigration{{Resource: "routes.route.openshift.io", State: MigrationRunning, Duration: time.Minute}})
+	SetEncryptionMigrations([]EncryptionMigration{{Resource: "routes.route.openshift.io", State: MigrationSucceeded, Duration: 5 * time.Minute}})
+
+	expected := `
+# HELP openshift_apiserver_operator_encryption_migration_duration_seconds [ALPHA] How long the migration of a resource to its write key took in seconds, or is running for, labeled with the resource and the state of the migration (Running, Succeeded or Failed)
+# TYPE openshift_apiserver_operator_encryption_migration_duration_seconds gauge
+openshift_apiserver_operator_encryption_migration_duration_seconds{resource="routes.route.openshift.io",state="Succeeded"} 300
+# HELP openshift_apiserver_operator_last_rollout_duration_seconds [ALPHA] How long it took in seconds until the pod template of the last rolled out revision was available, labeled with the revision
+# TYPE openshift_apiserver_operator_last_rollout_duration_seconds gauge
+openshift_apiserver_operator_last_rollout_duration_seconds{revision="8"} 180
+# HELP openshift_apiserver_operator_observed_config_changes_total [ALPHA] The total number of changes of the observedConfig, labeled with the config observer that changed it
+# TYPE openshift_apiserver_operator_observed_config_changes_total counter
+openshift_apiserver_operator_observed_config_changes_total{observer="Proxy"} 2
+# HELP openshift_apiserver_operator_workload_sync_step_errors_total [ALPHA] The total number of failed steps of the workload sync, labeled with the step
+# TYPE openshift_apiserver_operator_workload_sync_step_errors_total counter
+openshift_apiserver_operator_workload_sync_step_errors_total{step="deployments"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"openshift_apiserver_operator_encryption_migration_duration_seconds",
+		"openshift_apiserver_operator_last_rollout_duration_seconds",
+		"openshift_apiserver_operator_observed_config_changes_total",
+		"openshift_apiserver_operator_workload_sync_step_errors_total",
+	); err != nil {
+		t.Error(err)
+	}
+	for name, expectCount := range map[string]uint64{
+		"openshift_apiserver_operator_rollout_duration_seconds":            2,
+		"openshift_apiserver_operator_workload_sync_step_duration_seconds": 3,
+	} {
+		histograms, err := testutil.GetHistogramVecFromGatherer(registry, name, map[string]string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count := histograms.GetAggregatedSampleCount(); count != expectCount {
+			t.Errorf("expected %d observations of %s, got %d", expectCount, name, count)
+		}
+	}
+}
+
+func TestConnectivityCheckCollector(t *testing.T) {
+	check := func(name string, reachable metav1.ConditionStatus) *operatorcontrolplanev1alpha1.PodNetworkConnectivityCheck {
+		return &operatorcontrolplanev1alpha1.PodNetworkConnectivityCheck{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: name},
+			Status: operatorcontrolplanev1alpha1.PodNetworkConnectivityCheckStatus{
+				Conditions: []operatorcontrolplanev1alpha1.PodNetworkConnectivityCheckCondition{{Type: operatorcontrolplanev1alpha1.Reachable, Status: reachable}},
+			},
+		}
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, c := range []*operatorcontrolplanev1alpha1.PodNetworkConnectivityCheck{
+		check("apiserver-master-0-to-etcd-server-master-1", metav1.ConditionFalse),
+		check("apiserver-master-0-to-etcd-server-master-2", metav1.ConditionFalse),
+		check("apiserver-master-1-to-etcd-server-master-2", metav1.ConditionTrue),
+		check("apiserver-master-0-to-kubernetes-apiserver-endpoint-master-1", metav1.ConditionFalse),
+		check("apiserver-master-0-to-load-balancer-api-internal", metav1.ConditionTrue),
+		check("apiserver-master-0-to-kubernetes-default-service-cluster", metav1.ConditionUnknown),
+	} {
+		if err := indexer.Add(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lister := operatorcontrolplanelisters.NewPodNetworkConnectivityCheckLister(indexer).PodNetworkConnectivityChecks("openshift-apiserver")
+
+	expected := `
+# HELP openshift_apiserver_operator_connectivity_checks_failing [ALPHA] The number of PodNetworkConnectivityChecks whose target is not reachable, labeled with the type of the target
+# TYPE openshift_apiserver_operator_connectivity_checks_failing gauge
+openshift_apiserver_operator_connectivity_checks_failing{target_type="etcd-server"} 2
+openshift_apiserver_operator_connectivity_checks_failing{target_type="kubernetes-apiserver-endpoint"} 1
+openshift_apiserver_operator_connectivity_checks_failing{target_type="kubernetes-default-service"} 0
+openshift_apiserver_operator_connectivity_checks_failing{target_type="load-balancer"} 0
+`
+	if err := testutil.CustomCollectAndCompare(newConnectivityCheckCollector(lister, connectivitycheckcontroller.TargetType), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,248 @@
+package prometheusrulecontroller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// PrometheusRuleName is the PrometheusRule in the operator namespace holding the alerts of the operator.
+	PrometheusRuleName = "openshift-apiserver-operator"
+
+	// ThresholdsConfigMapName is the configmap in the operator namespace holding the thresholds of the alerts.
+	ThresholdsConfigMapName = "alerting-thresholds"
+	// APIServiceUnavailableKey is how long an APIService is unavailable before it is alerted on, e.g. 5m.
+	APIServiceUnavailableKey = "apiServiceUnavailable"
+	// ConnectivityCheckOutageKey is how long a PodNetworkConnectivityCheck fails before it is alerted on, e.g. 10m.
+	ConnectivityCheckOutageKey = "connectivityCheckOutage"
+	// EncryptionMigrationStuckKey is how long an encryption migration runs before it is alerted on, e.g. 1h.
+	EncryptionMigrationStuckKey = "encryptionMigrationStuck"
+
+	conditionType = "PrometheusRuleDegraded"
+)
+
+// thresholds are the durations after which the alerts fire.
+type thresholds struct {
+	apiServiceUnavailable    time.Duration
+	connectivityCheckOutage  time.Duration
+	encryptionMigrationStuck time.Duration
+}
+
+var defaultThresholds = thresholds{
+	apiServiceUnavailable:    5 * time.Minute,
+	connectivityCheckOutage:  10 * time.Minute,
+	encryptionMigrationStuck: time.Hour,
+}
+
+// apiServicesFunc returns the enabled and the disabled APIServices.
+type apiServicesFunc func() ([]*apiregistrationv1.APIService, []*apiregistrationv1.APIService, error)
+
+type prometheusRuleController struct {
+	operatorClient  v1helpers.OperatorClient
+	apiServices     apiServicesFunc
+	configMapLister corev1listers.ConfigMapLister
+	dynamicClient   dynamic.Interface
+}
+
+// NewPrometheusRuleController reconciles the openshift-apiserver-operator PrometheusRule. Its alerts follow the
+// runtime state: only the enabled APIServices are alerted on, so the rules are regenerated whenever the capabilities
+// of the ClusterVersion change. The thresholds of the alerts are read from the alerting-thresholds configmap.
+func NewPrometheusRuleController(
+	operatorClient v1helpers.OperatorClient,
+	apiServices apiServicesFunc,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	clusterVersionInformer factory.Informer,
+	dynamicClient dynamic.Interface,
+	eventRecorder events.Recorder,
+) factory.Controller {
+	configMapInformer := kubeInformersForNamespaces.InformersFor(operatorclient.OperatorNamespace).Core().V1().ConfigMaps()
+	c := &prometheusRuleController{
+		operatorClient:  operatorClient,
+		apiServices:     apiServices,
+		configMapLister: configMapInformer.Lister(),
+		dynamicClient:   dynamicClient,
+	}
+	return factory.New().
+		WithInformers(
+			operatorClient.Informer(),
+			configMapInformer.Informer(),
+			clusterVersionInformer,
+		).
+		ResyncEvery(10*time.Minute).
+		WithSync(c.sync).
+		ToController("PrometheusRuleController", eventRecorder.WithComponentSuffix("prometheus-rule-controller"))
+}
+
+func (c *prometheusRuleController) sync(ctx context.Context, syncCtx factory.SyncContext) error {
+	operatorSpec, _, _, err := c.operatorClient.GetOperatorState()
+	if err != nil {
+		return err
+	}
+	if operatorSpec.ManagementState != operatorv1.Managed {
+		return nil
+	}
+
+	condition := operatorv1.OperatorCondition{
+		Type:   conditionType,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+	thresholds, thresholdsErr := c.thresholds()
+	if thresholdsErr != nil {
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "InvalidThresholds"
+		condition.Message = fmt.Sprintf("%v, the default thresholds are used", thresholdsErr)
+	}
+
+	enabled, _, err := c.apiServices()
+	if err != nil {
+		return err
+	}
+	_, _, applyErr := resourceapply.ApplyPrometheusRule(ctx, c.dynamicClient, syncCtx.Recorder(), prometheusRule(enabled, thresholds))
+	if applyErr != nil {
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "Error"
+		condition.Message = applyErr.Error()
+	}
+
+	if _, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(condition)); err != nil {
+		return err
+	}
+	return applyErr
+}
+
+// thresholds reads the alerting-thresholds configmap. Without it, and for invalid ones, the default thresholds are
+// used.
+func (c *prometheusRuleController) thresholds() (thresholds, error) {
+	configMap, err := c.configMapLister.ConfigMaps(operatorclient.OperatorNamespace).Get(ThresholdsConfigMapName)
+	if apierrors.IsNotFound(err) {
+		return defaultThresholds, nil
+	}
+	if err != nil {
+		return defaultThresholds, err
+	}
+	parsed := defaultThresholds
+	for key, threshold := range map[string]*time.Duration{
+		APIServiceUnavailableKey:    &parsed.apiServiceUnavailable,
+		ConnectivityCheckOutageKey:  &parsed.connectivityCheckOutage,
+		EncryptionMigrationStuckKey: &parsed.encryptionMigrationStuck,
+	} {
+		value, ok := configMap.Data[key]
+		if !ok {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < time.Minute {
+			return defaultThresholds, fmt.Errorf("%s %q of %s/%s is not a duration of at least 1m", key, value, operatorclient.OperatorNamespace, ThresholdsConfigMapName)
+		}
+		*threshold = duration
+	}
+	return parsed, nil
+}
+
+// prometheusRule returns the PrometheusRule alerting on the enabled APIServices, the failing connectivity checks and
+// the stuck encryption migrations.
+func prometheusRule(enabled []*apiregistrationv1.APIService, thresholds thresholds) *unstructured.Unstructured {
+	rules := []interface{}{}
+	if len(enabled) > 0 {
+		names := []string{}
+		for _, apiService := range enabled {
+			names = append(names, regexp.QuoteMeta(apiService.Name))
+		}
+		sort.Strings(names)
+		rules = append(rules, alert(
+			"OpenShiftAPIServerAPIServiceUnavailable",
+			fmt.Sprintf("max by (name) (aggregator_unavailable_apiservice{name=~%q}) > 0", strings.Join(names, "|")),
+			thresholds.apiServiceUnavailable,
+			"critical",
+			"An APIService served by openshift-apiserver is unavailable.",
+			fmt.Sprintf("The APIService {{ $labels.name }} has been unavailable for more than %s, its API is not served.", prometheusDuration(thresholds.apiServiceUnavailable)),
+		))
+	}
+	rules = append(rules,
+		alert(
+			"OpenShiftAPIServerConnectivityCheckFailing",
+			"max by (target_type) (openshift_apiserver_operator_connectivity_checks_failing) > 0",
+			thresholds.connectivityCheckOutage,
+			"warning",
+			"openshift-apiserver pods can't reach their dependencies.",
+			fmt.Sprintf("{{ $value }} PodNetworkConnectivityChecks of openshift-apiserver to a {{ $labels.target_type }} target have been failing for more than %s.", prometheusDuration(thresholds.connectivityCheckOutage)),
+		),
+		alert(
+			"OpenShiftAPIServerEncryptionMigrationStuck",
+			fmt.Sprintf(`max by (resource) (openshift_apiserver_operator_encryption_migration_duration_seconds{state="Running"}) > %d`, int64(thresholds.encryptionMigrationStuck.Seconds())),
+			0,
+			"warning",
+			"The encryption migration of an openshift-apiserver resource is stuck.",
+			fmt.Sprintf("The migration of {{ $labels.resource }} to its encryption write key has been running for more than %s, the previous keys can't be removed until it completes.", prometheusDuration(thresholds.encryptionMigrationStuck)),
+		),
+	)
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       "PrometheusRule",
+		"metadata": map[string]interface{}{
+			"namespace": operatorclient.OperatorNamespace,
+			"name":      PrometheusRuleName,
+		},
+		"spec": map[string]interface{}{
+			"groups": []interface{}{
+				map[string]interface{}{
+					"name":  "openshift-apiserver-operator",
+					"rules": rules,
+				},
+			},
+		},
+	}}
+}
+
+// alert returns an alerting rule, without a for duration it fires as soon as expr holds.
+func alert(name, expr string, forDuration time.Duration, severity, summary, description string) map[string]interface{} {
+	rule := map[string]interface{}{
+		"alert": name,
+		"expr":  expr,
+		"labels": map[string]interface{}{
+			"namespace": operatorclient.OperatorNamespace,
+			"severity":  severity,
+		},
+		"annotations": map[string]interface{}{
+			"summary":     summary,
+			"description": description,
+		},
+	}
+	if forDuration > 0 {
+		rule["for"] = prometheusDuration(forDuration)
+	}
+	return rule
+}
+
+// prometheusDuration formats a duration the way Prometheus parses it, in whole seconds and without zero minutes and
+// seconds, e.g. 1h instead of 1h0m0s.
+func prometheusDuration(d time.Duration) string {
+	formatted := d.Truncate(time.Second).String()
+	if strings.HasSuffix(formatted, "m0s") {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if strings.HasSuffix(formatted, "h0m") {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
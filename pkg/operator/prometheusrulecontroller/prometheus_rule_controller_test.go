@@ -0,0 +1,238 @@
+package prometheusrulecontroller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+var prometheusRuleResource = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "prometheusrules"}
+
+func TestPrometheusRuleController(t *testing.T) {
+	apiService := func(name string) *apiregistrationv1.APIService {
+		return &apiregistrationv1.APIService{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+
+	tests := []struct {
+		name             string
+		enabled          []*apiregistrationv1.APIService
+		thresholds       map[string]string
+		expectExprs      map[string]string
+		expectFor        map[string]string
+		expectStatus     operatorv1.ConditionStatus
+		expectReason     string
+		expectNoAPIAlert bool
+	}{
+		{
+			name:    "build enabled",
+			enabled: []*apiregistrationv1.APIService{apiService("v1.build.openshift.io"), apiService("v1.apps.openshift.io")},
+			expectExprs: map[string]string{
+				"OpenShiftAPIServerAPIServiceUnavailable":    `max by (name) (aggregator_unavailable_apiservice{name=~"v1\\.apps\\.openshift\\.io|v1\\.build\\.openshift\\.io"}) > 0`,
+				"OpenShiftAPIServerConnectivityCheckFailing": "max by (target_type) (openshift_apiserver_operator_connectivity_checks_failing) > 0",
+				"OpenShiftAPIServerEncryptionMigrationStuck": `max by (resource) (openshift_apiserver_operator_encryption_migration_duration_seconds{state="Running"}) > 3600`,
+			},
+			expectFor: map[string]string{
+				"OpenShiftAPIServerAPIServiceUnavailable":    "5m",
+				"OpenShiftAPIServerConnectivityCheckFailing": "10m",
+			},
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:    "build disabled",
+			enabled: []*apiregistrationv1.APIService{apiService("v1.apps.openshift.io")},
+			expectExprs: map[string]string{
+				"OpenShiftAPIServerAPIServiceUnavailable": `max by (name) (aggregator_unavailable_apiservice{name=~"v1\\.apps\\.openshift\\.io"}) > 0`,
+			},
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:       "thresholds",
+			enabled:    []*apiregistrationv1.APIService{apiService("v1.apps.openshift.io")},
+			thresholds: map[string]string{ConnectivityCheckOutageKey: "1h30m", EncryptionMigrationStuckKey: "2h"},
+			expectExprs: map[string]string{
+				"OpenShiftAPIServerEncryptionMigrationStuck": `max by (resource) (openshift_apiserver_operator_encryption_migration_duration_seconds{state="Running"}) > 7200`,
+			},
+			expectFor: map[string]string{
+				"OpenShiftAPIServerAPIServiceUnavailable":    "5m",
+				"OpenShiftAPIServerConnectivityCheckFailing": "1h30m",
+			},
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:       "invalid thresholds",
+			enabled:    []*apiregistrationv1.APIService{apiService("v1.apps.openshift.io")},
+			thresholds: map[string]string{ConnectivityCheckOutageKey: "30s"},
+			expectFor: map[string]string{
+				"OpenShiftAPIServerConnectivityCheckFailing": "10m",
+			},
+			expectStatus: operatorv1.ConditionTrue,
+			expectReason: "InvalidThresholds",
+		},
+		{
+			name:             "no apiservices",
+			expectStatus:     operatorv1.ConditionFalse,
+			expectReason:     "AsExpected",
+			expectNoAPIAlert: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if tc.thresholds != nil {
+				if err := indexer.Add(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver-operator", Name: ThresholdsConfigMapName},
+					Data:       tc.thresholds,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{prometheusRuleResource: "PrometheusRuleList"})
+			operatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{}, nil)
+			c := &prometheusRuleController{
+				operatorClient: operatorClient,
+				apiServices: func() ([]*apiregistrationv1.APIService, []*apiregistrationv1.APIService, error) {
+					return tc.enabled, nil, nil
+				},
+				configMapLister: corev1listers.NewConfigMapLister(indexer),
+				dynamicClient:   dynamicClient,
+			}
+
+			recorder := events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(time.Now()))
+			if err := c.sync(context.Background(), factory.NewSyncContext("test", recorder)); err != nil {
+				t.Fatal(err)
+			}
+
+			rule, err := dynamicClient.Resource(prometheusRuleResource).Namespace("openshift-apiserver-operator").Get(context.Background(), PrometheusRuleName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			alerts := alertsOf(t, rule)
+			for name, expr := range tc.expectExprs {
+				if alerts[name]["expr"] != expr {
+					t.Errorf("expected %s to alert on %s, got %v", name, expr, alerts[name]["expr"])
+				}
+			}
+			for name, forDuration := range tc.expectFor {
+				if alerts[name]["for"] != forDuration {
+					t.Errorf("expected %s to fire after %s, got %v", name, forDuration, alerts[name]["for"])
+				}
+			}
+			if _, ok := alerts["OpenShiftAPIServerAPIServiceUnavailable"]; ok == tc.expectNoAPIAlert {
+				t.Errorf("expected the APIService alert %v, got %v", !tc.expectNoAPIAlert, ok)
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, conditionType)
+			if condition == nil || condition.Status != tc.expectStatus || condition.Reason != tc.expectReason {
+				t.Errorf("expected %s %s, got %#v", tc.expectStatus, tc.expectReason, condition)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesChange(t *testing.T) {
+	enabled := []*apiregistrationv1.APIService{
+		{ObjectMeta: metav1.ObjectMeta{Name: "v1.apps.openshift.io"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "v1.build.openshift.io"}},
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{prometheusRuleResource: "PrometheusRuleList"})
+	c := &prometheusRuleController{
+		operatorClient: v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{}, nil),
+		apiServices: func() ([]*apiregistrationv1.APIService, []*apiregistrationv1.APIService, error) {
+			return enabled, nil, nil
+		},
+		configMapLister: corev1listers.NewConfigMapLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+		dynamicClient:   dynamicClient,
+	}
+	syncCtx := factory.NewSyncContext("test", events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(time.Now())))
+
+	for _, expectBuild := range []bool{true, false} {
+		if err := c.sync(context.Background(), syncCtx); err != nil {
+			t.Fatal(err)
+		}
+		rule, err := dynamicClient.Resource(prometheusRuleResource).Namespace("openshift-apiserver-operator").Get(context.Background(), PrometheusRuleName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr := alertsOf(t, rule)["OpenShiftAPIServerAPIServiceUnavailable"]["expr"].(string)
+		if strings.Contains(expr, "build") != expectBuild {
+			t.Errorf("expected the build APIService to be alerted on %v, got %s", expectBuild, expr)
+		}
+		// the Build capability is disabled
+		enabled = enabled[:1]
+	}
+}
+
+func TestPrometheusRuleControllerUnmanaged(t *testing.T) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{prometheusRuleResource: "PrometheusRuleList"})
+	c := &prometheusRuleController{
+		operatorClient: v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Unmanaged}, &operatorv1.OperatorStatus{}, nil),
+		apiServices: func() ([]*apiregistrationv1.APIService, []*apiregistrationv1.APIService, error) {
+			return []*apiregistrationv1.APIService{{ObjectMeta: metav1.ObjectMeta{Name: "v1.apps.openshift.io"}}}, nil, nil
+		},
+		configMapLister: corev1listers.NewConfigMapLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+		dynamicClient:   dynamicClient,
+	}
+
+	if err := c.sync(context.Background(), factory.NewSyncContext("test", events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(time.Now())))); err != nil {
+		t.Fatal(err)
+	}
+	if len(dynamicClient.Actions()) > 0 {
+		t.Errorf("expected the PrometheusRule to be left alone, got %v", dynamicClient.Actions())
+	}
+}
+
+func TestPrometheusDuration(t *testing.T) {
+	for duration, expected := range map[time.Duration]string{
+		time.Minute:                    "1m",
+		90 * time.Minute:               "1h30m",
+		2 * time.Hour:                  "2h",
+		time.Hour + 30*time.Second:     "1h0m30s",
+		90*time.Second + time.Second/2: "1m30s",
+	} {
+		if formatted := prometheusDuration(duration); formatted != expected {
+			t.Errorf("expected %v to be formatted as %s, got %s", duration, expected, formatted)
+		}
+	}
+}
+
+// alertsOf returns the alerting rules of the PrometheusRule by their name.
+func alertsOf(t *testing.T, rule *unstructured.Unstructured) map[string]map[string]interface{} {
+	groups, _, err := unstructured.NestedSlice(rule.Object, "spec", "groups")
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("expected one group, got %v: %v", groups, err)
+	}
+	rules, _, err := unstructured.NestedSlice(groups[0].(map[string]interface{}), "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts := map[string]map[string]interface{}{}
+	for _, r := range rules {
+		alert := r.(map[string]interface{})
+		if !strings.HasPrefix(alert["alert"].(string), "OpenShiftAPIServer") {
+			t.Errorf("unexpected alert %v", alert["alert"])
+		}
+		alerts[alert["alert"].(string)] = alert
+	}
+	return alerts
+}
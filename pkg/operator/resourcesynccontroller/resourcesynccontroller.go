@@ -12,6 +12,32 @@ import (
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
 )
 
+// SyncMapping copies the resource at Source to Destination.
+type SyncMapping struct {
+	Destination resourcesynccontroller.ResourceLocation
+	Source      resourcesynccontroller.ResourceLocation
+	// Producer is the operator writing the resource at Source, it is shown in the resource graph.
+	Producer string
+}
+
+// ConfigMapSyncs are the configmaps copied into the operand namespace.
+var ConfigMapSyncs = []SyncMapping{
+	{
+		Destination: resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-serving-ca"},
+		Source:      resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-serving-ca"},
+		Producer:    "etcd",
+	},
+}
+
+// SecretSyncs are the secrets copied into the operand namespace.
+var SecretSyncs = []SyncMapping{
+	{
+		Destination: resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
+		Source:      resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-client"},
+		Producer:    "etcd",
+	},
+}
+
 func NewResourceSyncController(
 	operatorConfigClient v1helpers.OperatorClient,
 	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
@@ -27,17 +53,15 @@ func NewResourceSyncController(
 		configMapsGetter,
 		eventRecorder,
 	)
-	if err := resourceSyncController.SyncConfigMap(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-serving-ca"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-serving-ca"},
-	); err != nil {
-		return nil, nil, err
+	for _, mapping := range ConfigMapSyncs {
+		if err := resourceSyncController.SyncConfigMap(mapping.Destination, mapping.Source); err != nil {
+			return nil, nil, err
+		}
 	}
-	if err := resourceSyncController.SyncSecret(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-client"},
-	); err != nil {
-		return nil, nil, err
+	for _, mapping := range SecretSyncs {
+		if err := resourceSyncController.SyncSecret(mapping.Destination, mapping.Source); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	return resourceSyncController, resourcesynccontroller.NewDebugHandler(resourceSyncController), nil
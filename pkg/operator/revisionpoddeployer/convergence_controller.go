@@ -0,0 +1,137 @@
+package revisionpoddeployer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/klog/v2"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+// Operand is an apiserver whose encryption rollout is reported by the convergence controller.
+type Operand struct {
+	// Name is the namespace of the operand, used in condition messages.
+	Name string
+	// ConditionPrefix prefixes the EncryptionProgressing condition of the operand, e.g. OAuthAPIServer.
+	ConditionPrefix string
+	Deployer        MaybeDisabledDeployer
+}
+
+func (o Operand) conditionType() string {
+	return o.ConditionPrefix + "EncryptionProgressing"
+}
+
+type convergenceController struct {
+	operatorClient v1helpers.OperatorClient
+	operands       []Operand
+}
+
+// NewConvergenceController reports for every enabled operand whether all of its instances run the same encryption
+// configuration, and whether it is the configuration of the first operand, in a <prefix>EncryptionProgressing
+// condition. The conditions of disabled operands are removed.
+func NewConvergenceController(operatorClient v1helpers.OperatorClient, operands []Operand, eventRecorder events.Recorder) factory.Controller {
+	c := &convergenceController{
+		operatorClient: operatorClient,
+		operands:       operands,
+	}
+	informers := []factory.Informer{operatorClient.Informer()}
+	for _, operand := range operands {
+		informers = append(informers, operand.Deployer)
+	}
+	return factory.New().
+		WithInformers(informers...).
+		ResyncEvery(time.Minute).
+		WithSync(c.sync).
+		ToController("EncryptionConvergenceController", eventRecorder.WithComponentSuffix("encryption-convergence-controller"))
+}
+
+func (c *convergenceController) sync(ctx context.Context, _ factory.SyncContext) error {
+	var golden *encryptiondata.Config
+	goldenName := ""
+	updates := []v1helpers.UpdateStatusFunc{}
+	for _, operand := range c.operands {
+		if operand.Deployer.Disabled() {
+			conditionType := operand.conditionType()
+			updates = append(updates, func(status *operatorv1.OperatorStatus) error {
+				v1helpers.RemoveOperatorCondition(&status.Conditions, conditionType)
+				return nil
+			})
+			continue
+		}
+
+		condition := operatorv1.OperatorCondition{
+			Type:   operand.conditionType(),
+			Status: operatorv1.ConditionFalse,
+			Reason: "AsExpected",
+		}
+		secret, converged, err := operand.Deployer.DeployedEncryptionConfigSecret(ctx)
+		switch {
+		case err != nil:
+			condition.Status = operatorv1.ConditionUnknown
+			condition.Reason = "Error"
+			condition.Message = err.Error()
+		case !converged:
+			condition.Status = operatorv1.ConditionTrue
+			condition.Reason = "RollingOut"
+			condition.Message = fmt.Sprintf("not all instances of %s run the same encryption configuration yet", operand.Name)
+		case secret == nil:
+			condition.Message = fmt.Sprintf("all instances of %s run without encryption", operand.Name)
+		default:
+			config, err := encryptiondata.FromSecret(secret)
+			if err != nil {
+				condition.Status = operatorv1.ConditionUnknown
+				condition.Reason = "Error"
+				condition.Message = err.Error()
+				break
+			}
+			condition.Message = fmt.Sprintf("all instances of %s run %s", operand.Name, secret.Name)
+			if golden == nil {
+				golden, goldenName = config, operand.Name
+				break
+			}
+			if !reflect.DeepEqual(golden.Encryption.Resources, config.Encryption.Resources) {
+				condition.Status = operatorv1.ConditionTrue
+				condition.Reason = "ConfigurationMismatch"
+				condition.Message = fmt.Sprintf("all instances of %s run %s, which differs from the encryption configuration of %s", operand.Name, secret.Name, goldenName)
+			}
+		}
+		updates = append(updates, v1helpers.UpdateConditionFn(condition))
+	}
+
+	_, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, updates...)
+	return err
+}
+
+// CoordinateOAuthAPIServerFunc returns whether encryption.coordinateOAuthAPIServer is set in the
+// unsupportedConfigOverrides of the operator, i.e. whether encryption only counts as converged once
+// openshift-oauth-apiserver runs the same encryption configuration as openshift-apiserver.
+func CoordinateOAuthAPIServerFunc(operatorClient v1helpers.OperatorClient) func() bool {
+	return func() bool {
+		spec, _, _, err := operatorClient.GetOperatorState()
+		if err != nil {
+			klog.Warningf("failed to get the operator state: %v", err)
+			return false
+		}
+		if len(spec.UnsupportedConfigOverrides.Raw) == 0 {
+			return false
+		}
+		overrides := struct {
+			Encryption struct {
+				CoordinateOAuthAPIServer bool `json:"coordinateOAuthAPIServer"`
+			} `json:"encryption"`
+		}{}
+		if err := yaml.Unmarshal(spec.UnsupportedConfigOverrides.Raw, &overrides); err != nil {
+			klog.Warningf("failed to unmarshal encryption.coordinateOAuthAPIServer from unsupportedConfigOverrides: %v", err)
+			return false
+		}
+		return overrides.Encryption.CoordinateOAuthAPIServer
+	}
+}
@@ -0,0 +1,160 @@
+package revisionpoddeployer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+func TestConvergenceController(t *testing.T) {
+	secretFor := func(resources ...string) *corev1.Secret {
+		config := &encryptiondata.Config{Encryption: &apiserverv1.EncryptionConfiguration{}}
+		for _, resource := range resources {
+			config.Encryption.Resources = append(config.Encryption.Resources, apiserverv1.ResourceConfiguration{
+				Resources: []string{resource},
+				Providers: []apiserverv1.ProviderConfiguration{{Identity: &apiserverv1.IdentityConfiguration{}}},
+			})
+		}
+		secret, err := encryptiondata.ToSecret("ns", "encryption-config-1", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return secret
+	}
+
+	tests := []struct {
+		name          string
+		openshift     *convergenceFakeDeployer
+		oauth         *convergenceFakeDeployer
+		expectOAuth   *operatorv1.OperatorCondition
+		expectMessage string
+	}{
+		{
+			name:        "disabled",
+			openshift:   &convergenceFakeDeployer{secret: secretFor("routes.route.openshift.io"), converged: true},
+			oauth:       &convergenceFakeDeployer{disabled: true},
+			expectOAuth: nil,
+		},
+		{
+			name:          "converged",
+			openshift:     &convergenceFakeDeployer{secret: secretFor("routes.route.openshift.io"), converged: true},
+			oauth:         &convergenceFakeDeployer{secret: secretFor("routes.route.openshift.io"), converged: true},
+			expectOAuth:   &operatorv1.OperatorCondition{Status: operatorv1.ConditionFalse, Reason: "AsExpected"},
+			expectMessage: "all instances of openshift-oauth-apiserver run encryption-config-1",
+		},
+		{
+			name:        "rolling out",
+			openshift:   &convergenceFakeDeployer{secret: secretFor("routes.route.openshift.io"), converged: true},
+			oauth:       &convergenceFakeDeployer{},
+			expectOAuth: &operatorv1.OperatorCondition{Status: operatorv1.ConditionTrue, Reason: "RollingOut"},
+		},
+		{
+			name:          "lagging behind",
+			openshift:     &convergenceFakeDeployer{secret: secretFor("routes.route.openshift.io", "oauthaccesstokens.oauth.openshift.io"), converged: true},
+			oauth:         &convergenceFakeDeployer{secret: secretFor("routes.route.openshift.io"), converged: true},
+			expectOAuth:   &operatorv1.OperatorCondition{Status: operatorv1.ConditionTrue, Reason: "ConfigurationMismatch"},
+			expectMessage: "differs from the encryption configuration of openshift-apiserver",
+		},
+		{
+			name:        "error",
+			openshift:   &convergenceFakeDeployer{secret: secretFor("routes.route.openshift.io"), converged: true},
+			oauth:       &convergenceFakeDeployer{err: fmt.Errorf("nasty error")},
+			expectOAuth: &operatorv1.OperatorCondition{Status: operatorv1.ConditionUnknown, Reason: "Error"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			operatorClient := v1helpers.NewFakeOperatorClient(
+				&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+				&operatorv1.OperatorStatus{Conditions: []operatorv1.OperatorCondition{{Type: "OAuthAPIServerEncryptionProgressing", Status: operatorv1.ConditionTrue}}},
+				nil,
+			)
+			c := &convergenceController{
+				operatorClient: operatorClient,
+				operands: []Operand{
+					{Name: "openshift-apiserver", ConditionPrefix: "OpenShiftAPIServer", Deployer: tc.openshift},
+					{Name: "openshift-oauth-apiserver", ConditionPrefix: "OAuthAPIServer", Deployer: tc.oauth},
+				},
+			}
+			if err := c.sync(context.Background(), factory.NewSyncContext("test", events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(time.Now())))); err != nil {
+				t.Fatal(err)
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			if condition := v1helpers.FindOperatorCondition(status.Conditions, "OpenShiftAPIServerEncryptionProgressing"); condition == nil || condition.Status != operatorv1.ConditionFalse {
+				t.Errorf("expected openshift-apiserver to be converged, got %#v", condition)
+			}
+			condition := v1helpers.FindOperatorCondition(status.Conditions, "OAuthAPIServerEncryptionProgressing")
+			switch {
+			case tc.expectOAuth == nil && condition != nil:
+				t.Errorf("expected the condition of a disabled operand to be removed, got %#v", condition)
+			case tc.expectOAuth != nil && (condition == nil || condition.Status != tc.expectOAuth.Status || condition.Reason != tc.expectOAuth.Reason):
+				t.Errorf("expected %s %s, got %#v", tc.expectOAuth.Status, tc.expectOAuth.Reason, condition)
+			case condition != nil && !strings.Contains(condition.Message, tc.expectMessage):
+				t.Errorf("expected the message to contain %q, got %q", tc.expectMessage, condition.Message)
+			}
+		})
+	}
+}
+
+func TestCoordinateOAuthAPIServerFunc(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides string
+		expected  bool
+	}{
+		{name: "no overrides"},
+		{name: "other overrides", overrides: `{"encryption":{"reason":"rotate"}}`},
+		{name: "opted in", overrides: `{"encryption":{"coordinateOAuthAPIServer":true}}`, expected: true},
+		{name: "invalid", overrides: `{"encryption":{"coordinateOAuthAPIServer":"yes"}}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			operatorClient := v1helpers.NewFakeOperatorClient(
+				&operatorv1.OperatorSpec{UnsupportedConfigOverrides: runtime.RawExtension{Raw: []byte(tc.overrides)}},
+				&operatorv1.OperatorStatus{},
+				nil,
+			)
+			if enabled := CoordinateOAuthAPIServerFunc(operatorClient)(); enabled != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, enabled)
+			}
+		})
+	}
+}
+
+type convergenceFakeDeployer struct {
+	secret    *corev1.Secret
+	converged bool
+	disabled  bool
+	err       error
+}
+
+func (d *convergenceFakeDeployer) DeployedEncryptionConfigSecret(context.Context) (*corev1.Secret, bool, error) {
+	return d.secret, d.converged, d.err
+}
+
+func (d *convergenceFakeDeployer) AddEventHandler(cache.ResourceEventHandler) (cache.ResourceEventHandlerRegistration, error) {
+	return nil, nil
+}
+
+func (d *convergenceFakeDeployer) HasSynced() bool {
+	return true
+}
+
+func (d *convergenceFakeDeployer) Disabled() bool {
+	return d.disabled
+}
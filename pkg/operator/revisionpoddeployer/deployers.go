@@ -126,7 +126,6 @@ var _ MaybeDisabledDeployer = &disabledByPredicateDeployer{}
 
 // NewDisabledByPredicateDeployer returns a deployer used by the encryption controllers.
 // Whether this deployer is on/off is determined by enabled
-// TODO: remove this deployer in 4.8
 func NewDisabledByPredicateDeployer(
 	enabled func() bool,
 	delegate statemachine.Deployer) *disabledByPredicateDeployer {
@@ -0,0 +1,503 @@
+package revisionprunecontroller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	encryptionsecrets "github.com/openshift/library-go/pkg/operator/encryption/secrets"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/workload"
+)
+
+const (
+	// RetentionConfigMapName is the configmap in the operator namespace holding the retention policy of revisions.
+	RetentionConfigMapName = "revision-retention"
+	// RetainedRevisionsKey is the number of most recent revisions that are kept, at least 1.
+	RetainedRevisionsKey = "retainedRevisions"
+	// RetainForKey is how long revisions are kept after their creation, e.g. 168h.
+	RetainForKey = "retainFor"
+
+	// InventoryConfigMapName is the configmap in the operator namespace listing the revisions in the operand namespace.
+	InventoryConfigMapName = "revision-inventory"
+	inventoryKey           = "inventory.json"
+
+	// the library-go pruner of encryption-config secrets kept as many revisions
+	defaultRetainedRevisions = 5
+
+	// revisionStatusName is the configmap the revision controller creates first for every revision, the revisioned
+	// resources are owned by it.
+	revisionStatusName      = "revision-status"
+	revisionReadyAnnotation = "operator.openshift.io/revision-ready"
+
+	deploymentName = "apiserver"
+
+	conditionType = "RevisionPruneDegraded"
+)
+
+// Reasons a revision is retained.
+const (
+	// InUse revisions are run by a pod.
+	InUse = "InUse"
+	// Deployment is the revision of the deployment, its pods may not exist yet.
+	Deployment = "Deployment"
+	// Latest is the latest available revision, or a newer one that is still being created.
+	Latest = "Latest"
+	// KnownGood is the revision an automatic rollback returns to.
+	KnownGood = "KnownGood"
+	// Pinned is the revision pinned on the operator config.
+	Pinned = "Pinned"
+	// Recent revisions are among the retained number of most recent revisions.
+	Recent = "Recent"
+	// Young revisions were created within the retention period.
+	Young = "Young"
+)
+
+// Revision describes a revision in the operand namespace.
+type Revision struct {
+	Revision int32       `json:"revision"`
+	Created  metav1.Time `json:"created"`
+	// Ready is false while the revision controller copies the revisioned resources.
+	Ready bool `json:"ready"`
+	// Reason is why the revision controller created the revision.
+	Reason string `json:"reason,omitempty"`
+	// Resources are the revisioned configmaps and secrets, e.g. configmaps/audit-3.
+	Resources []string `json:"resources"`
+	// ContentsHash is the sha256 of the data of the revisioned resources.
+	ContentsHash string `json:"contentsHash"`
+	// Pods are the pods running the revision.
+	Pods  []string `json:"pods,omitempty"`
+	InUse bool     `json:"inUse"`
+	// Retained lists why the revision isn't pruned.
+	Retained []string `json:"retained,omitempty"`
+}
+
+// retentionPolicy decides which revisions are pruned.
+type retentionPolicy struct {
+	retainedRevisions int
+	retainFor         time.Duration
+}
+
+type revisionPruneController struct {
+	operatorClient   v1helpers.OperatorClient
+	configMapNames   []string
+	secretNames      []string
+	configMapLister  corev1listers.ConfigMapLister
+	secretLister     corev1listers.SecretLister
+	podLister        corev1listers.PodLister
+	deploymentLister appsv1listers.DeploymentLister
+	// retentionLister lists configmaps in the operator namespace.
+	retentionLister  corev1listers.ConfigMapLister
+	configMapsGetter corev1client.ConfigMapsGetter
+	secretsGetter    corev1client.SecretsGetter
+	now              func() time.Time
+
+	lock      sync.RWMutex
+	inventory []Revision
+}
+
+// NewRevisionPruneController prunes the revisions of openshift-apiserver by the retention policy of the
+// revision-retention configmap: the revision-status-N configmap and the revisioned configmaps and secrets of the given
+// names. Revisions that are run by a pod, are the revision of the deployment, the latest one or the known-good one are
+// never pruned. The remaining revisions are kept in the revision-inventory configmap and served by the returned debug
+// handler.
+func NewRevisionPruneController(
+	operatorClient v1helpers.OperatorClient,
+	configMapNames, secretNames []string,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	configMapsGetter corev1client.ConfigMapsGetter,
+	secretsGetter corev1client.SecretsGetter,
+	eventRecorder events.Recorder,
+) (factory.Controller, http.Handler) {
+	targetInformers := kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace)
+	retentionInformer := kubeInformersForNamespaces.InformersFor(operatorclient.OperatorNamespace).Core().V1().ConfigMaps()
+	c := &revisionPruneController{
+		operatorClient:   operatorClient,
+		configMapNames:   configMapNames,
+		secretNames:      secretNames,
+		configMapLister:  targetInformers.Core().V1().ConfigMaps().Lister(),
+		secretLister:     targetInformers.Core().V1().Secrets().Lister(),
+		podLister:        targetInformers.Core().V1().Pods().Lister(),
+		deploymentLister: targetInformers.Apps().V1().Deployments().Lister(),
+		retentionLister:  retentionInformer.Lister(),
+		configMapsGetter: configMapsGetter,
+		secretsGetter:    secretsGetter,
+		now:              time.Now,
+	}
+	return factory.New().
+		WithInformers(
+			operatorClient.Informer(),
+			targetInformers.Core().V1().ConfigMaps().Informer(),
+			targetInformers.Core().V1().Secrets().Informer(),
+			targetInformers.Core().V1().Pods().Informer(),
+			targetInformers.Apps().V1().Deployments().Informer(),
+			retentionInformer.Informer(),
+		).
+		ResyncEvery(10*time.Minute).
+		WithSync(c.sync).
+		ToController("RevisionPruneController", eventRecorder.WithComponentSuffix("revision-prune-controller")), &debugHandler{controller: c}
+}
+
+func (c *revisionPruneController) sync(ctx context.Context, syncCtx factory.SyncContext) error {
+	condition := operatorv1.OperatorCondition{
+		Type:   conditionType,
+		Status: operatorv1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+	policy, policyErr := c.retentionPolicy()
+	if policyErr != nil {
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "InvalidRetention"
+		condition.Message = fmt.Sprintf("%v, no revision is pruned", policyErr)
+	}
+
+	operatorSpec, _, _, err := c.operatorClient.GetOperatorState()
+	if err != nil {
+		return err
+	}
+	revisions, err := c.revisions(policy)
+	if err != nil {
+		return err
+	}
+	// nothing is pruned while the operand isn't managed
+	var pruneErr error
+	if policyErr == nil && operatorSpec.ManagementState == operatorv1.Managed {
+		revisions, pruneErr = c.prune(ctx, revisions, syncCtx.Recorder())
+		if pruneErr != nil {
+			condition.Status = operatorv1.ConditionTrue
+			condition.Reason = "Error"
+			condition.Message = pruneErr.Error()
+		}
+	}
+
+	c.lock.Lock()
+	c.inventory = revisions
+	c.lock.Unlock()
+
+	encodedInventory, err := json.MarshalIndent(revisions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if operatorSpec.ManagementState == operatorv1.Managed {
+		if _, _, err := resourceapply.ApplyConfigMap(ctx, c.configMapsGetter, syncCtx.Recorder(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.OperatorNamespace, Name: InventoryConfigMapName},
+			Data:       map[string]string{inventoryKey: string(encodedInventory)},
+		}); err != nil {
+			return err
+		}
+	}
+
+	if _, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(condition)); err != nil {
+		return err
+	}
+	return pruneErr
+}
+
+// retentionPolicy reads the revision-retention configmap. Without it the default number of revisions is kept.
+func (c *revisionPruneController) retentionPolicy() (retentionPolicy, error) {
+	policy := retentionPolicy{retainedRevisions: defaultRetainedRevisions}
+	configMap, err := c.retentionLister.ConfigMaps(operatorclient.OperatorNamespace).Get(RetentionConfigMapName)
+	if apierrors.IsNotFound(err) {
+		return policy, nil
+	}
+	if err != nil {
+		return policy, err
+	}
+	if value, ok := configMap.Data[RetainedRevisionsKey]; ok {
+		retained, err := strconv.Atoi(value)
+		if err != nil || retained < 1 {
+			return policy, fmt.Errorf("%s %q of %s/%s is not a positive number", RetainedRevisionsKey, value, operatorclient.OperatorNamespace, RetentionConfigMapName)
+		}
+		policy.retainedRevisions = retained
+	}
+	if value, ok := configMap.Data[RetainForKey]; ok {
+		retainFor, err := time.ParseDuration(value)
+		if err != nil || retainFor < 0 {
+			return policy, fmt.Errorf("%s %q of %s/%s is not a duration", RetainForKey, value, operatorclient.OperatorNamespace, RetentionConfigMapName)
+		}
+		policy.retainFor = retainFor
+	}
+	return policy, nil
+}
+
+// revisions returns the revisions in the operand namespace, the most recent first, with the reasons they are retained.
+func (c *revisionPruneController) revisions(policy retentionPolicy) ([]Revision, error) {
+	_, operatorStatus, _, err := c.operatorClient.GetOperatorState()
+	if err != nil {
+		return nil, err
+	}
+	protected := map[int32][]string{}
+	protect := func(revision int32, reason string) {
+		if revision > 0 {
+			protected[revision] = append(protected[revision], reason)
+		}
+	}
+
+	podsByRevision := map[int32][]string{}
+	pods, err := c.podLister.Pods(operatorclient.TargetNamespace).List(labels.SelectorFromSet(labels.Set{"apiserver": "true"}))
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		if revision, ok := parseRevision(pod.Labels["revision"]); ok {
+			podsByRevision[revision] = append(podsByRevision[revision], pod.Name)
+		}
+	}
+	for revision := range podsByRevision {
+		protect(revision, InUse)
+	}
+
+	deployment, err := c.deploymentLister.Deployments(operatorclient.TargetNamespace).Get(deploymentName)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return nil, err
+	default:
+		if revision, ok := parseRevision(deployment.Labels["revision"]); ok {
+			protect(revision, Deployment)
+		}
+	}
+
+	knownGood, ok, err := workload.KnownGoodRevision(c.configMapLister, operatorclient.TargetNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		protect(knownGood, KnownGood)
+	}
+
+	// a refused pin is protected too, it may be accepted once the encryption configuration catches up
+	operatorMeta, err := c.operatorClient.GetObjectMeta()
+	if err != nil {
+		return nil, err
+	}
+	if pinned, ok, err := workload.PinnedRevision(operatorMeta); ok && err == nil {
+		protect(pinned, Pinned)
+	}
+
+	statusConfigMaps, err := c.configMapLister.ConfigMaps(operatorclient.TargetNamespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	revisions := []Revision{}
+	for _, statusConfigMap := range statusConfigMaps {
+		if !strings.HasPrefix(statusConfigMap.Name, revisionStatusName+"-") {
+			continue
+		}
+		revision, ok := parseRevision(statusConfigMap.Data["revision"])
+		if !ok {
+			klog.Warningf("skipping %s without a valid revision", statusConfigMap.Name)
+			continue
+		}
+		r := Revision{
+			Revision: revision,
+			Created:  statusConfigMap.CreationTimestamp,
+			Ready:    statusConfigMap.Annotations[revisionReadyAnnotation] == "true",
+			Reason:   statusConfigMap.Data["reason"],
+			Pods:     podsByRevision[revision],
+			InUse:    len(podsByRevision[revision]) > 0,
+		}
+		r.Resources, r.ContentsHash, err = c.contents(revision)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision > revisions[j].Revision })
+
+	for i := range revisions {
+		r := &revisions[i]
+		r.Retained = append(r.Retained, protected[r.Revision]...)
+		if r.Revision >= operatorStatus.LatestAvailableRevision {
+			r.Retained = append(r.Retained, Latest)
+		}
+		if i < policy.retainedRevisions {
+			r.Retained = append(r.Retained, Recent)
+		}
+		if policy.retainFor > 0 && c.now().Sub(r.Created.Time) < policy.retainFor {
+			r.Retained = append(r.Retained, Young)
+		}
+	}
+	return revisions, nil
+}
+
+// contents returns the revisioned resources of the revision and the hash of their data.
+func (c *revisionPruneController) contents(revision int32) ([]string, string, error) {
+	resources := []string{}
+	contentsHash := sha256.New()
+	for _, name := range c.configMapNames {
+		configMap, err := c.configMapLister.ConfigMaps(operatorclient.TargetNamespace).Get(nameFor(name, revision))
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		resources = append(resources, "configmaps/"+configMap.Name)
+		data := map[string][]byte{}
+		for key, value := range configMap.Data {
+			data[key] = []byte(value)
+		}
+		for key, value := range configMap.BinaryData {
+			data[key] = value
+		}
+		hashData(contentsHash, "configmaps/"+name, data)
+	}
+	for _, name := range c.secretNames {
+		secret, err := c.secretLister.Secrets(operatorclient.TargetNamespace).Get(nameFor(name, revision))
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		resources = append(resources, "secrets/"+secret.Name)
+		hashData(contentsHash, "secrets/"+name, secret.Data)
+	}
+	return resources, hex.EncodeToString(contentsHash.Sum(nil)), nil
+}
+
+// hashData adds the data of a resource to the hash, independent of the order of its keys and of the revision.
+func hashData(h hash.Hash, resource string, data map[string][]byte) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(h, "%s\x00", resource)
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s\x00%d\x00", key, len(data[key]))
+		h.Write(data[key])
+	}
+}
+
+// prune deletes the revisions that aren't retained and returns the remaining ones.
+func (c *revisionPruneController) prune(ctx context.Context, revisions []Revision, recorder events.Recorder) ([]Revision, error) {
+	remaining := []Revision{}
+	errs := []error{}
+	for _, r := range revisions {
+		if len(r.Retained) > 0 {
+			remaining = append(remaining, r)
+			continue
+		}
+		if err := c.deleteRevision(ctx, r.Revision); err != nil {
+			errs = append(errs, fmt.Errorf("failed to prune revision %d: %v", r.Revision, err))
+			remaining = append(remaining, r)
+			continue
+		}
+		recorder.Eventf("RevisionPruned", "Pruned revision %d created at %s: %s", r.Revision, r.Created.UTC().Format(time.RFC3339), strings.Join(r.Resources, ", "))
+	}
+	return remaining, utilerrors.NewAggregate(errs)
+}
+
+// deleteRevision deletes the revisioned resources, and the revision-status configmap owning them last, so that a
+// failed attempt is retried.
+func (c *revisionPruneController) deleteRevision(ctx context.Context, revision int32) error {
+	for _, name := range c.configMapNames {
+		err := c.configMapsGetter.ConfigMaps(operatorclient.TargetNamespace).Delete(ctx, nameFor(name, revision), metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	for _, name := range c.secretNames {
+		if err := c.deleteSecret(ctx, nameFor(name, revision)); err != nil {
+			return err
+		}
+	}
+	err := c.configMapsGetter.ConfigMaps(operatorclient.TargetNamespace).Delete(ctx, nameFor(revisionStatusName, revision), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// deleteSecret deletes a revisioned secret in the operand namespace.
+func (c *revisionPruneController) deleteSecret(ctx context.Context, name string) error {
+	// the copies of encryption-config carry the finalizer of the encryption controllers
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		secret, err := c.secretsGetter.Secrets(operatorclient.TargetNamespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		finalizers := []string{}
+		for _, finalizer := range secret.Finalizers {
+			if finalizer != encryptionsecrets.EncryptionSecretFinalizer {
+				finalizers = append(finalizers, finalizer)
+			}
+		}
+		if len(finalizers) == len(secret.Finalizers) {
+			return nil
+		}
+		secret.Finalizers = finalizers
+		_, err = c.secretsGetter.Secrets(operatorclient.TargetNamespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = c.secretsGetter.Secrets(operatorclient.TargetNamespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func nameFor(name string, revision int32) string {
+	return fmt.Sprintf("%s-%d", name, revision)
+}
+
+func parseRevision(value string) (int32, bool) {
+	revision, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || revision <= 0 {
+		return 0, false
+	}
+	return int32(revision), true
+}
+
+type debugHandler struct {
+	controller *revisionPruneController
+}
+
+// ServeHTTP writes the revision inventory of the last sync.
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h.controller.lock.RLock()
+	defer h.controller.lock.RUnlock()
+
+	data, err := json.Marshal(h.controller.inventory)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,321 @@
+package revisionprunecontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	encryptionsecrets "github.com/openshift/library-go/pkg/operator/encryption/secrets"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+var now = time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+func TestRevisionPruneController(t *testing.T) {
+	tests := []struct {
+		name            string
+		managementState operatorv1.ManagementState
+		retention       map[string]string
+		pinned          string
+		expectRetained  map[int32][]string
+		expectStatus    operatorv1.ConditionStatus
+		expectReason    string
+	}{
+		{
+			name:      "retained revisions",
+			retention: map[string]string{RetainedRevisionsKey: "3"},
+			expectRetained: map[int32][]string{
+				9: {InUse, Deployment, Latest, Recent},
+				8: {InUse, Recent},
+				7: {Recent},
+				2: {KnownGood},
+			},
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:      "retained for",
+			retention: map[string]string{RetainedRevisionsKey: "1", RetainForKey: "4h30m"},
+			expectRetained: map[int32][]string{
+				9: {InUse, Deployment, Latest, Recent, Young},
+				8: {InUse, Young},
+				7: {Young},
+				6: {Young},
+				2: {KnownGood},
+			},
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:      "pinned",
+			retention: map[string]string{RetainedRevisionsKey: "3"},
+			pinned:    "4",
+			expectRetained: map[int32][]string{
+				9: {InUse, Deployment, Latest, Recent},
+				8: {InUse, Recent},
+				7: {Recent},
+				4: {Pinned},
+				2: {KnownGood},
+			},
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:            "unmanaged",
+			managementState: operatorv1.Unmanaged,
+			retention:       map[string]string{RetainedRevisionsKey: "3"},
+			expectRetained: map[int32][]string{
+				9: {InUse, Deployment, Latest, Recent},
+				8: {InUse, Recent},
+				7: {Recent},
+				6: nil,
+				5: nil,
+				4: nil,
+				3: nil,
+				2: {KnownGood},
+				1: nil,
+			},
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name: "default",
+			expectRetained: map[int32][]string{
+				9: {InUse, Deployment, Latest, Recent},
+				8: {InUse, Recent},
+				7: {Recent},
+				6: {Recent},
+				5: {Recent},
+				2: {KnownGood},
+			},
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:      "invalid retention",
+			retention: map[string]string{RetainedRevisionsKey: "0"},
+			expectRetained: map[int32][]string{
+				9: {InUse, Deployment, Latest, Recent},
+				8: {InUse, Recent},
+				7: {Recent},
+				6: {Recent},
+				5: {Recent},
+				4: nil,
+				3: nil,
+				2: {KnownGood},
+				1: nil,
+			},
+			expectStatus: operatorv1.ConditionTrue,
+			expectReason: "InvalidRetention",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			objects := []runtime.Object{}
+			for revision := int32(1); revision <= 9; revision++ {
+				created := metav1.NewTime(now.Add(-time.Duration(10-revision) * time.Hour))
+				objects = append(objects,
+					&corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{
+							Namespace:         "openshift-apiserver",
+							Name:              fmt.Sprintf("revision-status-%d", revision),
+							CreationTimestamp: created,
+							Annotations:       map[string]string{revisionReadyAnnotation: "true"},
+						},
+						Data: map[string]string{"revision": fmt.Sprint(revision), "reason": "configmap/audit has changed"},
+					},
+					&corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: fmt.Sprintf("audit-%d", revision)},
+						Data:       map[string]string{"policy.yaml": fmt.Sprintf("rules: %d", revision/2)},
+					},
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Namespace:  "openshift-apiserver",
+							Name:       fmt.Sprintf("encryption-config-%d", revision),
+							Finalizers: []string{encryptionsecrets.EncryptionSecretFinalizer},
+						},
+						Data: map[string][]byte{"encryption-config": []byte("config")},
+					},
+				)
+			}
+			objects = append(objects,
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+					Namespace: "openshift-apiserver",
+					Name:      "config-known-good",
+					Annotations: map[string]string{
+						"openshiftapiservers.operator.openshift.io/known-good-revision":     "2",
+						"openshiftapiservers.operator.openshift.io/known-good-input-hashes": "{}",
+					},
+				}},
+				&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "apiserver-a", Labels: map[string]string{"apiserver": "true", "revision": "8"}}},
+				&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "apiserver-b", Labels: map[string]string{"apiserver": "true", "revision": "9"}}},
+				&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "other", Labels: map[string]string{"revision": "1"}}},
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "apiserver", Labels: map[string]string{"revision": "9"}}},
+			)
+			if tc.retention != nil {
+				objects = append(objects, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver-operator", Name: RetentionConfigMapName},
+					Data:       tc.retention,
+				})
+			}
+
+			indexers := map[string]cache.Indexer{}
+			for _, kind := range []string{"ConfigMap", "Secret", "Pod", "Deployment"} {
+				indexers[kind] = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			}
+			for _, object := range objects {
+				kind := reflect.TypeOf(object).Elem().Name()
+				if err := indexers[kind].Add(object); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			kubeClient := fake.NewSimpleClientset(objects...)
+			operatorMeta := &metav1.ObjectMeta{Name: "cluster"}
+			if len(tc.pinned) > 0 {
+				operatorMeta.Annotations = map[string]string{"openshiftapiservers.operator.openshift.io/pinned-revision": tc.pinned}
+			}
+			managementState := operatorv1.Managed
+			if len(tc.managementState) > 0 {
+				managementState = tc.managementState
+			}
+			operatorClient := v1helpers.NewFakeOperatorClientWithObjectMeta(
+				operatorMeta,
+				&operatorv1.OperatorSpec{ManagementState: managementState},
+				&operatorv1.OperatorStatus{LatestAvailableRevision: 9},
+				nil,
+			)
+			c := &revisionPruneController{
+				operatorClient:   operatorClient,
+				configMapNames:   []string{"audit"},
+				secretNames:      []string{"encryption-config"},
+				configMapLister:  corev1listers.NewConfigMapLister(indexers["ConfigMap"]),
+				secretLister:     corev1listers.NewSecretLister(indexers["Secret"]),
+				podLister:        corev1listers.NewPodLister(indexers["Pod"]),
+				deploymentLister: appsv1listers.NewDeploymentLister(indexers["Deployment"]),
+				retentionLister:  corev1listers.NewConfigMapLister(indexers["ConfigMap"]),
+				configMapsGetter: kubeClient.CoreV1(),
+				secretsGetter:    kubeClient.CoreV1(),
+				now:              func() time.Time { return now },
+			}
+			if err := c.sync(context.Background(), factory.NewSyncContext("test", events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(now)))); err != nil {
+				t.Fatal(err)
+			}
+
+			for revision := int32(1); revision <= 9; revision++ {
+				_, retained := tc.expectRetained[revision]
+				for _, name := range []string{"revision-status", "audit"} {
+					_, err := kubeClient.CoreV1().ConfigMaps("openshift-apiserver").Get(context.Background(), nameFor(name, revision), metav1.GetOptions{})
+					if retained == apierrors.IsNotFound(err) {
+						t.Errorf("expected configmap %s to be retained: %v, got %v", nameFor(name, revision), retained, err)
+					}
+				}
+				_, err := kubeClient.CoreV1().Secrets("openshift-apiserver").Get(context.Background(), nameFor("encryption-config", revision), metav1.GetOptions{})
+				if retained == apierrors.IsNotFound(err) {
+					t.Errorf("expected secret %s to be retained: %v, got %v", nameFor("encryption-config", revision), retained, err)
+				}
+			}
+
+			recorder := httptest.NewRecorder()
+			(&debugHandler{controller: c}).ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/controllers/revisions", nil))
+			inventory := []Revision{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &inventory); err != nil {
+				t.Fatal(err)
+			}
+			actualRetained := map[int32][]string{}
+			for _, r := range inventory {
+				actualRetained[r.Revision] = r.Retained
+			}
+			if !reflect.DeepEqual(actualRetained, tc.expectRetained) {
+				t.Errorf("expected retained revisions %v, got %v", tc.expectRetained, actualRetained)
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, conditionType)
+			if condition == nil || condition.Status != tc.expectStatus || condition.Reason != tc.expectReason {
+				t.Errorf("expected %s %s, got %#v", tc.expectStatus, tc.expectReason, condition)
+			}
+
+			// the inventory configmap is only written while the operand is managed
+			configMap, err := kubeClient.CoreV1().ConfigMaps("openshift-apiserver-operator").Get(context.Background(), InventoryConfigMapName, metav1.GetOptions{})
+			if managementState != operatorv1.Managed {
+				if !apierrors.IsNotFound(err) {
+					t.Errorf("expected no inventory configmap while %s, got %v", managementState, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			written := []Revision{}
+			if err := json.Unmarshal([]byte(configMap.Data[inventoryKey]), &written); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(written, inventory) {
+				t.Errorf("expected the inventory configmap to hold the served inventory, got %s", configMap.Data[inventoryKey])
+			}
+		})
+	}
+}
+
+func TestInventory(t *testing.T) {
+	configMapIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	created := metav1.NewTime(now)
+	for revision, policy := range map[int32]string{1: "rules: a", 2: "rules: a", 3: "rules: b"} {
+		configMapIndexer.Add(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: nameFor("revision-status", revision), CreationTimestamp: created},
+			Data:       map[string]string{"revision": fmt.Sprint(revision)},
+		})
+		configMapIndexer.Add(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: nameFor("audit", revision)},
+			Data:       map[string]string{"policy.yaml": policy},
+		})
+	}
+	podIndexer.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "apiserver-a", Labels: map[string]string{"apiserver": "true", "revision": "2"}}})
+
+	c := &revisionPruneController{
+		operatorClient:   v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{}, &operatorv1.OperatorStatus{LatestAvailableRevision: 3}, nil),
+		configMapNames:   []string{"audit"},
+		secretNames:      []string{"encryption-config"},
+		configMapLister:  corev1listers.NewConfigMapLister(configMapIndexer),
+		secretLister:     corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+		podLister:        corev1listers.NewPodLister(podIndexer),
+		deploymentLister: appsv1listers.NewDeploymentLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+		now:              func() time.Time { return now },
+	}
+	revisions, err := c.revisions(retentionPolicy{retainedRevisions: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || revisions[0].Revision != 3 || revisions[2].Revision != 1 {
+		t.Fatalf("expected revisions 3, 2 and 1, got %#v", revisions)
+	}
+	if revisions[1].ContentsHash != revisions[2].ContentsHash || revisions[0].ContentsHash == revisions[1].ContentsHash {
+		t.Errorf("expected revisions with the same contents to have the same hash, got %#v", revisions)
+	}
+	if !revisions[1].InUse || !reflect.DeepEqual(revisions[1].Pods, []string{"apiserver-a"}) || revisions[2].InUse {
+		t.Errorf("expected revision 2 to be used by apiserver-a, got %#v", revisions)
+	}
+	if !reflect.DeepEqual(revisions[0].Resources, []string{"configmaps/audit-3"}) || revisions[0].Ready {
+		t.Errorf("unexpected revision 3 %#v", revisions[0])
+	}
+}
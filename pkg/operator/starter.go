@@ -17,11 +17,23 @@ import (
 	operatorv1client "github.com/openshift/client-go/operator/clientset/versioned"
 	operatorv1informers "github.com/openshift/client-go/operator/informers/externalversions"
 	operatorcontrolplaneclient "github.com/openshift/client-go/operatorcontrolplane/clientset/versioned"
+	operatorcontrolplaneinformers "github.com/openshift/client-go/operatorcontrolplane/informers/externalversions"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/configobservation/configobservercontroller"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/connectivitycheckcontroller"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/encryptedresources"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/encryptionmigrationcontroller"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/encryptionstatusprovider"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/flowcontrolcontroller"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/imageimportcacontroller"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/keyrotationcontroller"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/managementstatecontroller"
+	operatormetrics "github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/metrics"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/nsfinalizercontroller"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/prometheusrulecontroller"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/resourcesynccontroller"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/revisionpoddeployer"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/revisionprunecontroller"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/v311_00_assets"
 	operatorworkload "github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/workload"
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
@@ -29,7 +41,6 @@ import (
 	apiservercontrollerset "github.com/openshift/library-go/pkg/operator/apiserver/controllerset"
 	libgoetcd "github.com/openshift/library-go/pkg/operator/configobserver/etcd"
 	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
-	"github.com/openshift/library-go/pkg/operator/encryption"
 	encryptioncontrollers "github.com/openshift/library-go/pkg/operator/encryption/controllers"
 	"github.com/openshift/library-go/pkg/operator/encryption/controllers/migrators"
 	encryptiondeployer "github.com/openshift/library-go/pkg/operator/encryption/deployer"
@@ -47,7 +58,9 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
 	apiregistrationclient "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset"
@@ -59,8 +72,49 @@ import (
 
 const (
 	oauthAPIServerTargetNamespace = "openshift-oauth-apiserver"
+
+	// kmsPreflightCallTimeout bounds every call of the KMS preflight check to the plugin.
+	kmsPreflightCallTimeout = 10 * time.Second
 )
 
+// WatchedNamespaces are the namespaces the operator runs kube informers for. The empty namespace covers cluster-scoped
+// resources like nodes.
+var WatchedNamespaces = []string{
+	"",
+	operatorclient.GlobalUserSpecifiedConfigNamespace,
+	operatorclient.GlobalMachineSpecifiedConfigNamespace,
+	operatorclient.OperatorNamespace,
+	operatorclient.TargetNamespace,
+	libgoetcd.EtcdEndpointNamespace,
+	metav1.NamespaceSystem,
+	"openshift-kube-apiserver",
+	oauthAPIServerTargetNamespace,
+}
+
+// RevisionConfigMaps are the configmaps in the operand namespace that are copied to <name>-<revision> for every new revision.
+var RevisionConfigMaps = []revision.RevisionResource{
+	{
+		Name: "audit",
+	},
+}
+
+// RevisionSecrets are the secrets in the operand namespace that are copied to <name>-<revision> for every new revision.
+var RevisionSecrets = []revision.RevisionResource{
+	{
+		Name:     "encryption-config",
+		Optional: true,
+	},
+}
+
+// revisionResourceNames returns the names of the revisioned resources.
+func revisionResourceNames(resources []revision.RevisionResource) []string {
+	names := []string{}
+	for _, resource := range resources {
+		names = append(names, resource.Name)
+	}
+	return names
+}
+
 var apiServiceGroupVersions = []schema.GroupVersion{
 	// these are all the apigroups we manage
 	{Group: "apps.openshift.io", Version: "v1"},
@@ -95,23 +149,17 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 	if err != nil {
 		return err
 	}
+	dynamicClient, err := dynamic.NewForConfig(controllerConfig.KubeConfig)
+	if err != nil {
+		return err
+	}
 	apiextensionsClient, err := apiextensionsclient.NewForConfig(controllerConfig.KubeConfig)
 	if err != nil {
 		return err
 	}
 
 	operatorConfigInformers := operatorv1informers.NewSharedInformerFactory(operatorConfigClient, 10*time.Minute)
-	kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(kubeClient,
-		"",
-		operatorclient.GlobalUserSpecifiedConfigNamespace,
-		operatorclient.GlobalMachineSpecifiedConfigNamespace,
-		operatorclient.OperatorNamespace,
-		operatorclient.TargetNamespace,
-		libgoetcd.EtcdEndpointNamespace,
-		metav1.NamespaceSystem,
-		"openshift-kube-apiserver",
-		oauthAPIServerTargetNamespace,
-	)
+	kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(kubeClient, WatchedNamespaces...)
 	apiregistrationInformers := apiregistrationinformers.NewSharedInformerFactory(apiregistrationv1Client, 10*time.Minute)
 	configInformers := configinformers.NewSharedInformerFactory(configClient, 10*time.Minute)
 
@@ -177,23 +225,83 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 	if err != nil {
 		return err
 	}
+	// encryption only counts as converged once openshift-oauth-apiserver runs the same encryption configuration,
+	// if encryption.coordinateOAuthAPIServer is set in unsupportedConfigOverrides
+	oauthNodeProvider := encryptiondeployer.NewDeploymentNodeProvider(oauthAPIServerTargetNamespace, kubeInformersForNamespaces)
+	oauthDeployer, err := encryptiondeployer.NewRevisionLabelPodDeployer("revision", oauthAPIServerTargetNamespace, kubeInformersForNamespaces, kubeClient.CoreV1(), kubeClient.CoreV1(), oauthNodeProvider)
+	if err != nil {
+		return err
+	}
+	encryptionOperands := []revisionpoddeployer.Operand{
+		{Name: operatorclient.TargetNamespace, ConditionPrefix: "OpenShiftAPIServer", Deployer: &revisionpoddeployer.AlwaysEnabledDeployer{Deployer: openshiftDeployer}},
+		{Name: oauthAPIServerTargetNamespace, ConditionPrefix: "OAuthAPIServer", Deployer: revisionpoddeployer.NewDisabledByPredicateDeployer(revisionpoddeployer.CoordinateOAuthAPIServerFunc(operatorClient), oauthDeployer)},
+	}
+	encryptionDeployer, err := revisionpoddeployer.NewUnionDeployer(encryptionOperands[0].Deployer, encryptionOperands[1].Deployer)
+	if err != nil {
+		return err
+	}
+	encryptedResourcesGroups := []string{}
+	for _, groupVersion := range apiServiceGroupVersions {
+		encryptedResourcesGroups = append(encryptedResourcesGroups, groupVersion.Group)
+	}
+	encryptedResources := encryptedresources.NewProvider(kubeInformersForNamespaces, encryptedResourcesGroups)
+	encryptedResourcesController := encryptedresources.NewEncryptedResourcesController(operatorClient, encryptedResources, kubeInformersForNamespaces, controllerConfig.EventRecorder)
+	encryptionConvergenceController := revisionpoddeployer.NewConvergenceController(operatorClient, encryptionOperands, controllerConfig.EventRecorder)
 	migrationClient := kubemigratorclient.NewForConfigOrDie(controllerConfig.KubeConfig)
 	migrationInformer := migrationv1alpha1informer.NewSharedInformerFactory(migrationClient, time.Minute*30)
 	migrator := migrators.NewKubeStorageVersionMigrator(migrationClient, migrationInformer.Migration().V1alpha1(), kubeClient.Discovery())
+	encryptionMigrationController, encryptionMigrationDebugHandler := encryptionmigrationcontroller.NewEncryptionMigrationController(
+		operatorClient,
+		encryptedResources,
+		kubeInformersForNamespaces,
+		migrationInformer.Migration().V1alpha1(),
+		kubeClient.CoreV1(),
+		controllerConfig.EventRecorder,
+	)
+
+	operatorcontrolplaneInformers := operatorcontrolplaneinformers.NewSharedInformerFactoryWithOptions(operatorcontrolplaneClient, 10*time.Minute, operatorcontrolplaneinformers.WithNamespace(operatorclient.TargetNamespace))
+	canaryRollout := operatorworkload.NewCanaryRollout(
+		kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace),
+		operatorworkload.NewPodCanaryChecker(
+			kubeClient,
+			operatorcontrolplaneInformers.Controlplane().V1alpha1().PodNetworkConnectivityChecks().Lister(),
+			func() ([]schema.GroupVersion, error) {
+				enabled, _, err := apiServices(configInformers.Config().V1().ClusterVersions().Lister())
+				if err != nil {
+					return nil, err
+				}
+				groupVersions := []schema.GroupVersion{}
+				for _, apiService := range enabled {
+					groupVersions = append(groupVersions, schema.GroupVersion{Group: apiService.Spec.Group, Version: apiService.Spec.Version})
+				}
+				return groupVersions, nil
+			},
+		),
+	)
 
+	controlPlaneTopology := operatorworkload.NewControlPlaneTopologyFunc(configInformers.Config().V1().Infrastructures().Lister())
 	openShiftAPIServerWorkload := operatorworkload.NewOpenShiftAPIServerWorkload(
 		operatorClient,
 		operatorConfigClient.OperatorV1(),
-		configClient.ConfigV1(),
 		configInformers.Config().V1().ClusterVersions().Lister(),
-		workloadcontroller.CountNodesFuncWrapper(kubeInformersForNamespaces.InformersFor("").Core().V1().Nodes().Lister()),
+		operatorworkload.CountControlPlaneNodesFunc(kubeInformersForNamespaces.InformersFor("").Core().V1().Nodes().Lister()),
 		workloadcontroller.EnsureAtMostOnePodPerNode,
 		"openshift-apiserver",
 		os.Getenv("IMAGE"),
 		os.Getenv("OPERATOR_IMAGE"),
 		kubeClient,
 		featureGateAccessor,
-		versionRecorder)
+		versionRecorder,
+		kubeInformersForNamespaces.InformersFor(operatorclient.OperatorNamespace).Core().V1().ConfigMaps().Lister(),
+		canaryRollout,
+		operatorworkload.NewRevisionRollback(kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace), kubeClient.CoreV1()),
+		operatorworkload.NewRevisionPin(kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace)),
+		operatorworkload.NewRolloutHistory(kubeInformersForNamespaces, kubeClient.CoreV1()),
+		operatorworkload.NewRolloutCoalescer(kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace)),
+		operatorworkload.NewMaintenanceWindows(kubeInformersForNamespaces),
+		operatorworkload.NewZoneSpread(kubeInformersForNamespaces, kubeClient.CoreV1()),
+		controlPlaneTopology,
+		operatorworkload.NewResourceSizing(kubeInformersForNamespaces, dynamicClient))
 
 	infra, err := configClient.ConfigV1().Infrastructures().Get(ctx, "cluster", metav1.GetOptions{})
 	if err != nil && errors.IsNotFound(err) {
@@ -201,10 +309,11 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 	} else if err != nil {
 		return err
 	}
-	var statusControllerOptions []func(*status.StatusSyncer) *status.StatusSyncer
-	if infra == nil || infra.Status.ControlPlaneTopology != configv1.SingleReplicaTopologyMode {
-		statusControllerOptions = append(statusControllerOptions, apiservercontrollerset.WithStatusControllerPdbCompatibleHighInertia("APIServer"))
+	topology := configv1.HighlyAvailableTopologyMode
+	if infra != nil && len(infra.Status.ControlPlaneTopology) > 0 {
+		topology = infra.Status.ControlPlaneTopology
 	}
+	statusControllerOptions := statusControllerOptionsFor(topology)
 
 	oasEncryptionStatusProvider, err := encryptionstatusprovider.NewOpenShiftAPIServerEncryptionStatusProvider(operatorConfigClient)
 	if err != nil {
@@ -227,10 +336,6 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 		kubeInformersForNamespaces,
 		kubeClient,
 		configInformers.Config().V1().ClusterVersions().Informer(),
-	).WithFinalizerController(
-		operatorclient.TargetNamespace,
-		kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace),
-		kubeClient.CoreV1(),
 	).WithClusterOperatorStatusController(
 		"openshift-apiserver",
 		append(
@@ -250,6 +355,111 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 		configInformers.Config().V1().ClusterOperators(),
 		versionRecorder,
 		statusControllerOptions...,
+	).WithRevisionController(
+		operatorclient.TargetNamespace,
+		RevisionConfigMaps,
+		RevisionSecrets,
+		kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace),
+		operatorClient,
+		v1helpers.CachedConfigMapGetter(kubeClient.CoreV1(), kubeInformersForNamespaces),
+		v1helpers.CachedSecretGetter(kubeClient.CoreV1(), kubeInformersForNamespaces),
+	).
+		WithConfigUpgradableController().
+		WithLogLevelController().
+		WithoutPruneController().
+		WithoutFinalizerController().
+		WithoutWorkloadController().
+		WithoutStaticResourcesController().
+		WithoutEncryptionControllers().
+		WithoutAuditPolicyController()
+
+	runnableAPIServerControllers, err := apiServerControllers.PrepareRun()
+	if err != nil {
+		return err
+	}
+
+	// the encryption controllers see encryption.reason of rotations requested through the encryption-key-rotation
+	// configmap, which must not show up in the overrides the upgradeable controller checks
+	encryptionControllers := apiservercontrollerset.NewAPIServerControllerSet(
+		"openshift-apiserver",
+		keyrotationcontroller.NewRotationOperatorClient(operatorClient, kubeInformersForNamespaces),
+		controllerConfig.EventRecorder,
+		controllerConfig.Clock,
+	).WithEncryptionControllers(
+		operatorclient.TargetNamespace,
+		encryptedResources,
+		encryptionDeployer,
+		migrator,
+		kubeClient.CoreV1(),
+		kubeClient.CoreV1(),
+		configClient.ConfigV1().APIServers(),
+		configInformers.Config().V1().APIServers(),
+		kubeInformersForNamespaces,
+		resourceSyncController,
+		oasEncryptionStatusProvider,
+		// a candidate KMS configuration needs an encrypt/decrypt round trip through the plugin in openshift-apiserver
+		// before keys move to it
+		kmspreflight.NewPodPreflightDeployer(
+			operatorclient.TargetNamespace,
+			kubeClient.CoreV1(),
+			kubeClient.RbacV1(),
+			controllerConfig.EventRecorder,
+			os.Getenv("OPERATOR_IMAGE"),
+			[]string{"cluster-openshift-apiserver-operator", "kms-preflight"},
+			kmsPreflightCallTimeout,
+		),
+		encryptioncontrollers.NoopEncryptionConfigurationComputer{},
+	).
+		WithoutAPIServiceController().
+		WithoutFinalizerController().
+		WithoutClusterOperatorStatusController().
+		WithoutRevisionController().
+		WithoutPruneController().
+		WithoutConfigUpgradableController().
+		WithoutLogLevelController().
+		WithoutWorkloadController().
+		WithoutStaticResourcesController().
+		WithoutAuditPolicyController()
+
+	runnableEncryptionControllers, err := encryptionControllers.PrepareRun()
+	if err != nil {
+		return err
+	}
+
+	// prunes every revisioned resource, including the encryption-config secrets the library-go pruner would prune
+	revisionPruneController, revisionInventoryDebugHandler := revisionprunecontroller.NewRevisionPruneController(
+		operatorClient,
+		revisionResourceNames(RevisionConfigMaps),
+		revisionResourceNames(RevisionSecrets),
+		kubeInformersForNamespaces,
+		kubeClient.CoreV1(),
+		kubeClient.CoreV1(),
+		controllerConfig.EventRecorder,
+	)
+	keyRotationController := keyrotationcontroller.NewKeyRotationController(
+		operatorClient,
+		kubeInformersForNamespaces,
+		kubeClient.CoreV1(),
+		controllerConfig.EventRecorder,
+	)
+	prometheusRuleController := prometheusrulecontroller.NewPrometheusRuleController(
+		operatorClient,
+		func() ([]*apiregistrationv1.APIService, []*apiregistrationv1.APIService, error) {
+			return apiServices(configInformers.Config().V1().ClusterVersions().Lister())
+		},
+		kubeInformersForNamespaces,
+		configInformers.Config().V1().ClusterVersions().Informer(),
+		dynamicClient,
+		controllerConfig.EventRecorder,
+	)
+
+	// the controllers deleting the operand on their own when the operator is Removed wait for the removal controller
+	// to take the APIServices and the workload down first
+	operandControllers := apiservercontrollerset.NewAPIServerControllerSet(
+		"openshift-apiserver",
+		managementstatecontroller.NewRemovalGatedOperatorClient(operatorClient),
+		controllerConfig.EventRecorder,
+		controllerConfig.Clock,
 	).WithWorkloadController(
 		"OpenShiftAPIServer",
 		operatorclient.OperatorNamespace,
@@ -262,8 +472,9 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 		versionRecorder,
 		kubeInformersForNamespaces,
 		operatorConfigInformers.Operator().V1().OpenShiftAPIServers().Informer(),
-		configInformers.Config().V1().Images().Informer(),
 		configInformers.Config().V1().ClusterVersions().Informer(),
+		operatorcontrolplaneInformers.Controlplane().V1alpha1().PodNetworkConnectivityChecks().Informer(),
+		kubeInformersForNamespaces.InformersFor(operatorclient.OperatorNamespace).Core().V1().ConfigMaps().Informer(),
 	).WithStaticResourcesController(
 		"APIServerStaticResources",
 		v311_00_assets.Asset,
@@ -312,45 +523,6 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 		},
 		kubeInformersForNamespaces,
 		kubeClient,
-	).WithRevisionController(
-		operatorclient.TargetNamespace,
-		[]revision.RevisionResource{
-			{
-				Name: "audit",
-			},
-		},
-		[]revision.RevisionResource{
-			{
-				Name:     "encryption-config",
-				Optional: true,
-			},
-		},
-		kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace),
-		operatorClient,
-		v1helpers.CachedConfigMapGetter(kubeClient.CoreV1(), kubeInformersForNamespaces),
-		v1helpers.CachedSecretGetter(kubeClient.CoreV1(), kubeInformersForNamespaces),
-	).WithEncryptionControllers(
-		operatorclient.TargetNamespace,
-		encryption.StaticEncryptionProvider{
-			schema.GroupResource{Group: "route.openshift.io", Resource: "routes"}, // routes can contain embedded TLS private keys
-		},
-		openshiftDeployer,
-		migrator,
-		kubeClient.CoreV1(),
-		kubeClient.CoreV1(),
-		configClient.ConfigV1().APIServers(),
-		configInformers.Config().V1().APIServers(),
-		kubeInformersForNamespaces,
-		resourceSyncController,
-		oasEncryptionStatusProvider,
-		kmspreflight.NewAlwaysSucceedKMSPreflightDeployer(),
-		encryptioncontrollers.NoopEncryptionConfigurationComputer{},
-	).WithSecretRevisionPruneController(
-		operatorclient.TargetNamespace,
-		[]string{"encryption-config-"},
-		kubeClient.CoreV1(),
-		kubeClient.CoreV1(),
-		kubeInformersForNamespaces,
 	).WithAuditPolicyController(
 		operatorclient.TargetNamespace,
 		"audit",
@@ -358,14 +530,38 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 		kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace),
 		kubeClient,
 	).
-		WithConfigUpgradableController().
-		WithLogLevelController()
-
-	runnableAPIServerControllers, err := apiServerControllers.PrepareRun()
+		WithoutAPIServiceController().
+		WithoutFinalizerController().
+		WithoutClusterOperatorStatusController().
+		WithoutRevisionController().
+		WithoutEncryptionControllers().
+		WithoutPruneController().
+		WithoutConfigUpgradableController().
+		WithoutLogLevelController()
+
+	runnableOperandControllers, err := operandControllers.PrepareRun()
 	if err != nil {
 		return err
 	}
 
+	removalController := managementstatecontroller.NewRemovalController(
+		operatorClient,
+		func() ([]*apiregistrationv1.APIService, []*apiregistrationv1.APIService, error) {
+			return apiServices(configInformers.Config().V1().ClusterVersions().Lister())
+		},
+		apiregistrationInformers,
+		apiregistrationv1Client.ApiregistrationV1(),
+		kubeInformersForNamespaces,
+		kubeClient,
+		controllerConfig.EventRecorder,
+	)
+	finalizerController := nsfinalizercontroller.NewFinalizerController(
+		operatorclient.TargetNamespace,
+		kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace),
+		kubeClient.CoreV1(),
+		controllerConfig.EventRecorder,
+	)
+
 	configObserver := configobservercontroller.NewConfigObserver(
 		kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace),
 		kubeInformersForNamespaces.InformersFor(libgoetcd.EtcdEndpointNamespace),
@@ -377,6 +573,21 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 		controllerConfig.EventRecorder,
 	)
 
+	imageImportCAController := imageimportcacontroller.NewImageImportCAController(
+		operatorClient,
+		configInformers.Config().V1().Images(),
+		kubeInformersForNamespaces,
+		kubeClient.CoreV1(),
+		controllerConfig.EventRecorder,
+	)
+
+	flowControlController := flowcontrolcontroller.NewFlowControlController(
+		operatorClient,
+		kubeInformersForNamespaces,
+		kubeClient,
+		controllerConfig.EventRecorder,
+	)
+
 	staleConditions := staleconditions.NewRemoveStaleConditionsController(
 		"openshift-apiserver",
 		[]string{
@@ -398,6 +609,8 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 
 	if controllerConfig.Server != nil {
 		controllerConfig.Server.Handler.NonGoRestfulMux.Handle("/debug/controllers/resourcesync", debugHandler)
+		controllerConfig.Server.Handler.NonGoRestfulMux.Handle("/debug/controllers/encryptionmigration", encryptionMigrationDebugHandler)
+		controllerConfig.Server.Handler.NonGoRestfulMux.Handle("/debug/controllers/revisions", revisionInventoryDebugHandler)
 	}
 
 	apiextensionsInformers := apiextensionsinformers.NewSharedInformerFactory(apiextensionsClient, 10*time.Minute)
@@ -411,6 +624,10 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 		apiextensionsInformers,
 		controllerConfig.EventRecorder,
 	)
+	operatormetrics.RegisterConnectivityCheckCollector(
+		operatorcontrolplaneInformers.Controlplane().V1alpha1().PodNetworkConnectivityChecks().Lister().PodNetworkConnectivityChecks(operatorclient.TargetNamespace),
+		connectivitycheckcontroller.TargetType,
+	)
 
 	operatorConfigInformers.Start(ctx.Done())
 	kubeInformersForNamespaces.Start(ctx.Done())
@@ -419,10 +636,23 @@ func RunOperator(ctx context.Context, controllerConfig *controllercmd.Controller
 	dynamicInformers.Start(ctx.Done())
 	migrationInformer.Start(ctx.Done())
 	apiextensionsInformers.Start(ctx.Done())
+	operatorcontrolplaneInformers.Start(ctx.Done())
 
 	go configObserver.Run(ctx, 1)
 	go resourceSyncController.Run(ctx, 1)
+	go imageImportCAController.Run(ctx, 1)
+	go flowControlController.Run(ctx, 1)
+	go encryptionConvergenceController.Run(ctx, 1)
+	go encryptedResourcesController.Run(ctx, 1)
+	go encryptionMigrationController.Run(ctx, 1)
 	go runnableAPIServerControllers.Run(ctx)
+	go runnableEncryptionControllers.Run(ctx)
+	go keyRotationController.Run(ctx, 1)
+	go revisionPruneController.Run(ctx, 1)
+	go prometheusRuleController.Run(ctx, 1)
+	go runnableOperandControllers.Run(ctx)
+	go removalController.Run(ctx, 1)
+	go finalizerController.Run(ctx, 1)
 	go staleConditions.Run(ctx, 1)
 	go connectivityCheckController.Run(ctx, 1)
 
@@ -480,6 +710,16 @@ func apiServices(clusterVersionLister configlisterv1.ClusterVersionLister) ([]*a
 	return enabled, disabled, nil
 }
 
+// APIServices returns the enabled and disabled APIServices for the capabilities of the given ClusterVersion.
+// It is used by the offline render command, the operator itself goes through the ClusterVersion lister.
+func APIServices(clusterVersion *configv1.ClusterVersion) ([]*apiregistrationv1.APIService, []*apiregistrationv1.APIService, error) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(clusterVersion); err != nil {
+		return nil, nil, err
+	}
+	return apiServices(configlisterv1.NewClusterVersionLister(indexer))
+}
+
 func apiServicesReferences() []configv1.ObjectReference {
 	ret := []configv1.ObjectReference{}
 	for _, apiService := range apiServiceGroupVersions {
@@ -0,0 +1,39 @@
+package operator
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	apiservercontrollerset "github.com/openshift/library-go/pkg/operator/apiserver/controllerset"
+	"github.com/openshift/library-go/pkg/operator/status"
+)
+
+// statusControllerOptionsFor tunes how long the deployment may be degraded before the cluster operator reports it,
+// depending on the control-plane topology.
+func statusControllerOptionsFor(topology configv1.TopologyMode) []func(*status.StatusSyncer) *status.StatusSyncer {
+	switch topology {
+	case configv1.SingleReplicaTopologyMode:
+		return nil
+	case configv1.DualReplicaTopologyMode, configv1.HighlyAvailableArbiterMode:
+		// rebooting a node of a two-node control plane includes fencing it, which takes longer than a "normal" reboot
+		return []func(*status.StatusSyncer) *status.StatusSyncer{withStatusControllerDeploymentInertia("APIServer", 45*time.Minute)}
+	default:
+		return []func(*status.StatusSyncer) *status.StatusSyncer{apiservercontrollerset.WithStatusControllerPdbCompatibleHighInertia("APIServer")}
+	}
+}
+
+// withStatusControllerDeploymentInertia is WithStatusControllerPdbCompatibleHighInertia with the given inertia of the
+// deployment condition.
+func withStatusControllerDeploymentInertia(workloadConditionsPrefix string, inertia time.Duration) func(s *status.StatusSyncer) *status.StatusSyncer {
+	return func(s *status.StatusSyncer) *status.StatusSyncer {
+		return s.WithDegradedInertia(status.MustNewInertia(
+			2*time.Minute,
+			status.InertiaCondition{
+				ConditionTypeMatcher: regexp.MustCompile(fmt.Sprintf("^%sDeploymentDegraded$", workloadConditionsPrefix)),
+				Duration:             inertia,
+			}).Inertia,
+		)
+	}
+}
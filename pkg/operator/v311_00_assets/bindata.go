@@ -1,6 +1,8 @@
 // Code generated for package v311_00_assets by go-bindata DO NOT EDIT. (@generated)
 // sources:
 // bindata/v3.11.0/config/defaultconfig.yaml
+// bindata/v3.11.0/openshift-apiserver/apf-flowschema-loopback.yaml
+// bindata/v3.11.0/openshift-apiserver/apf-prioritylevel.yaml
 // bindata/v3.11.0/openshift-apiserver/apiserver-clusterrolebinding.yaml
 // bindata/v3.11.0/openshift-apiserver/cm.yaml
 // bindata/v3.11.0/openshift-apiserver/deploy.yaml
@@ -108,6 +110,92 @@ func v3110ConfigDefaultconfigYaml() (*asset, error) {
 	return a, nil
 }
 
+var _v3110OpenshiftApiserverApfFlowschemaLoopbackYaml = []byte(`apiVersion: flowcontrol.apiserver.k8s.io/v1
+kind: FlowSchema
+metadata:
+  name: openshift-apiserver-loopback
+spec:
+  distinguisherMethod:
+    type: ByUser
+  # ahead of the openshift-apiserver FlowSchema of manifests/09_flowschema.yaml, which keeps the other requests on
+  # workload-high
+  matchingPrecedence: 500
+  priorityLevelConfiguration:
+    name: openshift-apiserver
+  rules:
+  - resourceRules:
+    - apiGroups:
+      - apps.openshift.io
+      - authorization.openshift.io
+      - build.openshift.io
+      - image.openshift.io
+      - project.openshift.io
+      - quota.openshift.io
+      - route.openshift.io
+      - security.openshift.io
+      - template.openshift.io
+      clusterScope: true
+      namespaces:
+      - '*'
+      resources:
+      - '*'
+      verbs:
+      - '*'
+    subjects:
+    - kind: ServiceAccount
+      serviceAccount:
+        name: openshift-apiserver-sa
+        namespace: openshift-apiserver
+`)
+
+func v3110OpenshiftApiserverApfFlowschemaLoopbackYamlBytes() ([]byte, error) {
+	return _v3110OpenshiftApiserverApfFlowschemaLoopbackYaml, nil
+}
+
+func v3110OpenshiftApiserverApfFlowschemaLoopbackYaml() (*asset, error) {
+	bytes, err := v3110OpenshiftApiserverApfFlowschemaLoopbackYamlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "v3.11.0/openshift-apiserver/apf-flowschema-loopback.yaml", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _v3110OpenshiftApiserverApfPrioritylevelYaml = []byte(`apiVersion: flowcontrol.apiserver.k8s.io/v1
+kind: PriorityLevelConfiguration
+metadata:
+  name: openshift-apiserver
+spec:
+  type: Limited
+  limited:
+    # set by the operator from the openshift-apiserver replicas and the observed request rate
+    nominalConcurrencyShares: 40
+    lendablePercent: 50
+    limitResponse:
+      type: Queue
+      queuing:
+        queues: 64
+        handSize: 6
+        queueLengthLimit: 50
+`)
+
+func v3110OpenshiftApiserverApfPrioritylevelYamlBytes() ([]byte, error) {
+	return _v3110OpenshiftApiserverApfPrioritylevelYaml, nil
+}
+
+func v3110OpenshiftApiserverApfPrioritylevelYaml() (*asset, error) {
+	bytes, err := v3110OpenshiftApiserverApfPrioritylevelYamlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "v3.11.0/openshift-apiserver/apf-prioritylevel.yaml", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _v3110OpenshiftApiserverApiserverClusterrolebindingYaml = []byte(`apiVersion: rbac.authorization.k8s.io/v1
 kind: ClusterRoleBinding
 metadata:
@@ -208,7 +296,6 @@ spec:
       initContainers:
         - name: fix-audit-permissions
           terminationMessagePolicy: FallbackToLogsOnError
-          image: ${IMAGE}
           imagePullPolicy: IfNotPresent
           command: ['sh', '-c', 'chmod 0700 /var/log/openshift-apiserver && touch /var/log/openshift-apiserver/audit.log && chmod 0600 /var/log/openshift-apiserver/*']
           securityContext:
@@ -224,7 +311,6 @@ spec:
       containers:
       - name: openshift-apiserver
         terminationMessagePolicy: FallbackToLogsOnError
-        image: ${IMAGE}
         imagePullPolicy: IfNotPresent
         command: ["/bin/bash", "-ec"]
         args:
@@ -247,6 +333,8 @@ spec:
             valueFrom:
               fieldRef:
                 fieldPath: metadata.namespace
+          - name: VERBOSITY
+            value: '2' # set by the operator from the log level
         # we need to set this to privileged to be able to write audit to /var/log/openshift-apiserver
         securityContext:
           privileged: true
@@ -308,7 +396,6 @@ spec:
           successThreshold: 1
           failureThreshold: 30
       - name: openshift-apiserver-check-endpoints
-        image: ${KUBE_APISERVER_OPERATOR_IMAGE}
         imagePullPolicy: IfNotPresent
         terminationMessagePolicy: FallbackToLogsOnError
         command:
@@ -316,7 +403,7 @@ spec:
           - check-endpoints
         args:
           - --listen
-          - '${CHECK_ENDPOINTS_BIND_IP}:17698'
+          - '0.0.0.0:17698' # the bind address is set by the operator
           - --namespace
           - $(POD_NAMESPACE)
           - --config
@@ -354,7 +441,7 @@ spec:
           name: config
       - name: audit
         configMap:
-          name: audit-${REVISION}
+          name: audit # the revision is appended by the operator
       - name: etcd-client
         secret:
           secretName: etcd-client
@@ -379,7 +466,7 @@ spec:
             path: tls-ca-bundle.pem
       - name: encryption-config
         secret:
-          secretName: encryption-config-${REVISION}
+          secretName: encryption-config # the revision is appended by the operator
           optional: true
           defaultMode: 0600
       - hostPath:
@@ -747,6 +834,8 @@ func AssetNames() []string {
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
 	"v3.11.0/config/defaultconfig.yaml":                                  v3110ConfigDefaultconfigYaml,
+	"v3.11.0/openshift-apiserver/apf-flowschema-loopback.yaml":           v3110OpenshiftApiserverApfFlowschemaLoopbackYaml,
+	"v3.11.0/openshift-apiserver/apf-prioritylevel.yaml":                 v3110OpenshiftApiserverApfPrioritylevelYaml,
 	"v3.11.0/openshift-apiserver/apiserver-clusterrolebinding.yaml":      v3110OpenshiftApiserverApiserverClusterrolebindingYaml,
 	"v3.11.0/openshift-apiserver/cm.yaml":                                v3110OpenshiftApiserverCmYaml,
 	"v3.11.0/openshift-apiserver/deploy.yaml":                            v3110OpenshiftApiserverDeployYaml,
@@ -808,6 +897,8 @@ var _bintree = &bintree{nil, map[string]*bintree{
 			"defaultconfig.yaml": {v3110ConfigDefaultconfigYaml, map[string]*bintree{}},
 		}},
 		"openshift-apiserver": {nil, map[string]*bintree{
+			"apf-flowschema-loopback.yaml":           {v3110OpenshiftApiserverApfFlowschemaLoopbackYaml, map[string]*bintree{}},
+			"apf-prioritylevel.yaml":                 {v3110OpenshiftApiserverApfPrioritylevelYaml, map[string]*bintree{}},
 			"apiserver-clusterrolebinding.yaml":      {v3110OpenshiftApiserverApiserverClusterrolebindingYaml, map[string]*bintree{}},
 			"cm.yaml":                                {v3110OpenshiftApiserverCmYaml, map[string]*bintree{}},
 			"deploy.yaml":                            {v3110OpenshiftApiserverDeployYaml, map[string]*bintree{}},
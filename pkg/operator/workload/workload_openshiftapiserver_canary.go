@@ -0,0 +1,351 @@
+package workload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	operatorcontrolplanev1alpha1 "github.com/openshift/api/operatorcontrolplane/v1alpha1"
+	operatorcontrolplanelistersv1alpha1 "github.com/openshift/client-go/operatorcontrolplane/listers/operatorcontrolplane/v1alpha1"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// templateHashAnnotation identifies the pod template a deployment and its pods were rendered from.
+	templateHashAnnotation = "openshiftapiservers.operator.openshift.io/template-hash"
+	// canaryPassedAnnotation records the last template hash whose canary pod passed all checks.
+	canaryPassedAnnotation = "openshiftapiservers.operator.openshift.io/canary-passed"
+	// pausedAnnotation mirrors spec.paused of the deployment.
+	pausedAnnotation = "openshiftapiservers.operator.openshift.io/paused"
+
+	// RolloutConfigMapName is the configmap in the operator namespace holding the rollout settings.
+	RolloutConfigMapName = "openshift-apiserver-rollout"
+	// CanaryKey halts every rollout of a new pod template after its first pod when set to true.
+	CanaryKey = "canary"
+	// CanaryTimeoutKey is how long the canary pod may fail its checks before the rollout is reported as halted, e.g. 15m.
+	CanaryTimeoutKey = "canaryTimeout"
+	// AutomaticRollbackKey returns to the last known-good revision when a rollout stalls, when set to true.
+	AutomaticRollbackKey = "automaticRollback"
+	// RollbackWindowKey is how long a rollout may take before it is rolled back, e.g. 30m.
+	RollbackWindowKey = "rollbackWindow"
+	// CoalesceWindowKey is how long the pod template has to stay unchanged before it is rolled out, 0s turns this off.
+	CoalesceWindowKey = "coalesceWindow"
+
+	canaryConditionType  = "RevisionCanaryDegraded"
+	defaultCanaryTimeout = 10 * time.Minute
+	canaryRecheckPeriod  = 30 * time.Second
+)
+
+// rolloutConfig holds the rollout knobs of the operator.
+type rolloutConfig struct {
+	// Canary halts a rollout after the first pod of a new pod template until that pod passes the canary checks.
+	Canary bool
+	// CanaryTimeout is how long the canary pod may fail its checks before RevisionCanaryDegraded goes true.
+	CanaryTimeout metav1.Duration
+	// AutomaticRollback returns to the last known-good revision when a rollout doesn't complete within RollbackWindow.
+	AutomaticRollback bool
+	// RollbackWindow is how long a rollout may take before it is rolled back.
+	RollbackWindow metav1.Duration
+	// CoalesceWindow is how long the pod template has to stay unchanged before it is rolled out. Zero rolls out every
+	// change right away.
+	CoalesceWindow metav1.Duration
+}
+
+// rolloutConfigFor reads the rollout settings from the RolloutConfigMapName configmap. Unset knobs keep their defaults.
+func rolloutConfigFor(configMapLister corev1listers.ConfigMapLister) (rolloutConfig, error) {
+	config := rolloutConfig{
+		CanaryTimeout:  metav1.Duration{Duration: defaultCanaryTimeout},
+		RollbackWindow: metav1.Duration{Duration: defaultRollbackWindow},
+		CoalesceWindow: metav1.Duration{Duration: defaultCoalesceWindow},
+	}
+	configMap, err := configMapLister.ConfigMaps(operatorclient.OperatorNamespace).Get(RolloutConfigMapName)
+	if apierrors.IsNotFound(err) {
+		return config, nil
+	}
+	if err != nil {
+		return rolloutConfig{}, err
+	}
+	if err := boolValue(configMap, CanaryKey, &config.Canary); err != nil {
+		return rolloutConfig{}, err
+	}
+	if err := durationValue(configMap, CanaryTimeoutKey, false, &config.CanaryTimeout.Duration); err != nil {
+		return rolloutConfig{}, err
+	}
+	if err := boolValue(configMap, AutomaticRollbackKey, &config.AutomaticRollback); err != nil {
+		return rolloutConfig{}, err
+	}
+	if err := durationValue(configMap, RollbackWindowKey, false, &config.RollbackWindow.Duration); err != nil {
+		return rolloutConfig{}, err
+	}
+	if err := durationValue(configMap, CoalesceWindowKey, true, &config.CoalesceWindow.Duration); err != nil {
+		return rolloutConfig{}, err
+	}
+	return config, nil
+}
+
+// boolValue sets value to the boolean under key of the rollout configmap, when there is one.
+func boolValue(configMap *corev1.ConfigMap, key string, value *bool) error {
+	raw, ok := configMap.Data[key]
+	if !ok {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fmt.Errorf("%s %q of %s/%s is not a boolean", key, raw, operatorclient.OperatorNamespace, RolloutConfigMapName)
+	}
+	*value = parsed
+	return nil
+}
+
+// durationValue sets value to the duration under key of the rollout configmap, when there is one. Only durations
+// greater than zero, or zero as well with allowZero, are valid.
+func durationValue(configMap *corev1.ConfigMap, key string, allowZero bool, value *time.Duration) error {
+	raw, ok := configMap.Data[key]
+	if !ok {
+		return nil
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil || parsed < 0 || (parsed == 0 && !allowZero) {
+		expected := "positive"
+		if allowZero {
+			expected = "non-negative"
+		}
+		return fmt.Errorf("%s %q of %s/%s is not a %s duration", key, raw, operatorclient.OperatorNamespace, RolloutConfigMapName, expected)
+	}
+	*value = parsed
+	return nil
+}
+
+// rolloutGateFunc may adjust the required deployment right before it is applied, for instance to pause a rollout.
+type rolloutGateFunc func(ctx context.Context, required *appsv1.Deployment) error
+
+// CanaryChecker verifies that a single pod of a new pod template is healthy enough to continue the rollout.
+type CanaryChecker interface {
+	// Check returns the name of the first failing check and its error, or an empty name and nil when the pod is healthy.
+	Check(ctx context.Context, pod *corev1.Pod) (string, error)
+}
+
+// CanaryRollout halts the rollout of a new pod template after its first pod until that pod passes the CanaryChecker.
+//
+// With maxUnavailable=1 and maxSurge=0 the deployment controller replaces one pod and waits for it to become ready
+// before touching the next one. The canary pod is created long before the openshift-apiserver in it becomes ready, so
+// pausing the deployment as soon as the pod shows up holds the rollout at exactly one new pod.
+type CanaryRollout struct {
+	deploymentLister appsv1listers.DeploymentLister
+	podLister        corev1listers.PodLister
+	checker          CanaryChecker
+	now              func() time.Time
+}
+
+// NewCanaryRollout returns a CanaryRollout for the deployment in the target namespace.
+func NewCanaryRollout(kubeInformersForTargetNamespace kubeinformers.SharedInformerFactory, checker CanaryChecker) *CanaryRollout {
+	return &CanaryRollout{
+		deploymentLister: kubeInformersForTargetNamespace.Apps().V1().Deployments().Lister(),
+		podLister:        kubeInformersForTargetNamespace.Core().V1().Pods().Lister(),
+		checker:          checker,
+		now:              time.Now,
+	}
+}
+
+// rolloutGateResult is the outcome of a rollout gate for a single sync.
+type rolloutGateResult struct {
+	condition    operatorv1.OperatorCondition
+	requeueAfter time.Duration
+}
+
+// gate pauses or resumes the required deployment depending on the canary pod of its pod template.
+func (r *CanaryRollout) gate(ctx context.Context, config rolloutConfig, required *appsv1.Deployment, recorder events.Recorder) (rolloutGateResult, error) {
+	result := rolloutGateResult{condition: operatorv1.OperatorCondition{Type: canaryConditionType, Status: operatorv1.ConditionFalse, Reason: "AsExpected"}}
+	hash := required.Annotations[templateHashAnnotation]
+
+	existing, err := r.deploymentLister.Deployments(required.Namespace).Get(required.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return result, err
+	}
+	// the initial rollout and rollouts without canary never wait, and mark their template as passed so that enabling
+	// the canary later doesn't hold back what is already running. Templates cleared by an earlier gate don't wait either.
+	if !config.Canary || existing == nil || existing.Annotations[canaryPassedAnnotation] == hash || required.Annotations[canaryPassedAnnotation] == hash {
+		required.Spec.Paused = false
+		required.Annotations[canaryPassedAnnotation] = hash
+		return result, nil
+	}
+
+	canary, err := r.canaryPod(required, hash)
+	if err != nil {
+		return result, err
+	}
+	if canary == nil {
+		// let the deployment controller create the first pod of the new template
+		required.Spec.Paused = false
+		result.condition.Reason = "CanaryPending"
+		result.condition.Message = fmt.Sprintf("waiting for the first pod of pod template %s", hash)
+		return result, nil
+	}
+
+	failedCheck, checkErr := r.checker.Check(ctx, canary)
+	if checkErr == nil {
+		required.Spec.Paused = false
+		required.Annotations[canaryPassedAnnotation] = hash
+		if existing.Spec.Paused {
+			recorder.Eventf("CanaryPassed", "Canary pod %s passed all checks, continuing the rollout of pod template %s", canary.Name, hash)
+		}
+		return result, nil
+	}
+
+	required.Spec.Paused = true
+	result.requeueAfter = canaryRecheckPeriod
+	message := fmt.Sprintf("canary pod %s of pod template %s failed %s: %v", canary.Name, hash, failedCheck, checkErr)
+	if r.now().Sub(canary.CreationTimestamp.Time) < config.CanaryTimeout.Duration {
+		result.condition.Reason = "CanaryInProgress"
+		result.condition.Message = message
+		return result, nil
+	}
+	result.condition.Status = operatorv1.ConditionTrue
+	result.condition.Reason = "CanaryCheckFailed"
+	result.condition.Message = message
+	return result, nil
+}
+
+// canaryPod returns the oldest live pod of the given template, or nil when there is none yet.
+func (r *CanaryRollout) canaryPod(required *appsv1.Deployment, hash string) (*corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(required.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := r.podLister.Pods(required.Namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []*corev1.Pod{}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && pod.Annotations[templateHashAnnotation] == hash {
+			candidates = append(candidates, pod)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreationTimestamp.Before(&candidates[j].CreationTimestamp)
+	})
+	return candidates[0], nil
+}
+
+// stampTemplateHash sets templateHashAnnotation on the deployment and its pod template.
+func stampTemplateHash(required *appsv1.Deployment) error {
+	hash, err := templateHash(&required.Spec.Template)
+	if err != nil {
+		return err
+	}
+	required.Annotations[templateHashAnnotation] = hash
+	if required.Spec.Template.Annotations == nil {
+		required.Spec.Template.Annotations = map[string]string{}
+	}
+	required.Spec.Template.Annotations[templateHashAnnotation] = hash
+	return nil
+}
+
+// templateHash hashes the pod template, leaving out a template hash stamped on it before.
+func templateHash(template *corev1.PodTemplateSpec) (string, error) {
+	template = template.DeepCopy()
+	delete(template.Annotations, templateHashAnnotation)
+	hasher := fnv.New32()
+	if err := json.NewEncoder(hasher).Encode(template); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum32()), nil
+}
+
+type podCanaryChecker struct {
+	kubeClient              kubernetes.Interface
+	connectivityCheckLister operatorcontrolplanelistersv1alpha1.PodNetworkConnectivityCheckLister
+	groupVersions           func() ([]schema.GroupVersion, error)
+}
+
+// NewPodCanaryChecker checks that the canary pod is ready, that its /readyz passes, that every
+// PodNetworkConnectivityCheck originating from it is reachable and that it serves discovery for every group version
+// returned by groupVersions.
+func NewPodCanaryChecker(
+	kubeClient kubernetes.Interface,
+	connectivityCheckLister operatorcontrolplanelistersv1alpha1.PodNetworkConnectivityCheckLister,
+	groupVersions func() ([]schema.GroupVersion, error),
+) CanaryChecker {
+	return &podCanaryChecker{
+		kubeClient:              kubeClient,
+		connectivityCheckLister: connectivityCheckLister,
+		groupVersions:           groupVersions,
+	}
+}
+
+func (c *podCanaryChecker) Check(ctx context.Context, pod *corev1.Pod) (string, error) {
+	ready := false
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+			ready = true
+		}
+	}
+	if !ready {
+		return "PodReady", fmt.Errorf("pod is not ready")
+	}
+
+	if _, err := c.proxyGet(ctx, pod, "readyz"); err != nil {
+		return "readyz", err
+	}
+
+	checks, err := c.connectivityCheckLister.PodNetworkConnectivityChecks(pod.Namespace).List(labels.Everything())
+	if err != nil {
+		return "PodNetworkConnectivityCheck", err
+	}
+	found := false
+	for _, check := range checks {
+		if check.Spec.SourcePod != pod.Name {
+			continue
+		}
+		found = true
+		reachable := false
+		for _, condition := range check.Status.Conditions {
+			if condition.Type == operatorcontrolplanev1alpha1.Reachable && condition.Status == metav1.ConditionTrue {
+				reachable = true
+			}
+		}
+		if !reachable {
+			return "PodNetworkConnectivityCheck", fmt.Errorf("%s is not reachable", check.Name)
+		}
+	}
+	if !found {
+		return "PodNetworkConnectivityCheck", fmt.Errorf("no checks originating from the pod yet")
+	}
+
+	groupVersions, err := c.groupVersions()
+	if err != nil {
+		return "discovery", err
+	}
+	for _, groupVersion := range groupVersions {
+		if _, err := c.proxyGet(ctx, pod, fmt.Sprintf("apis/%s/%s", groupVersion.Group, groupVersion.Version)); err != nil {
+			return "discovery", fmt.Errorf("%s: %v", groupVersion, err)
+		}
+	}
+	return "", nil
+}
+
+func (c *podCanaryChecker) proxyGet(ctx context.Context, pod *corev1.Pod, path string) ([]byte, error) {
+	return c.kubeClient.CoreV1().Pods(pod.Namespace).ProxyGet("https", pod.Name, "8443", path, nil).DoRaw(ctx)
+}
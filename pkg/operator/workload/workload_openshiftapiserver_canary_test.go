@@ -0,0 +1,249 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+)
+
+type fakeCanaryChecker struct {
+	failedCheck string
+	err         error
+}
+
+func (f fakeCanaryChecker) Check(context.Context, *corev1.Pod) (string, error) {
+	return f.failedCheck, f.err
+}
+
+func TestCanaryRolloutGate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	newRequired := func() *appsv1.Deployment {
+		required := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "apiserver", Annotations: map[string]string{}},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "openshift-apiserver-a"}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "openshift-apiserver-a"}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "openshift-apiserver", Image: "new"}}},
+				},
+			},
+		}
+		if err := stampTemplateHash(required); err != nil {
+			t.Fatal(err)
+		}
+		return required
+	}
+	hash := newRequired().Annotations[templateHashAnnotation]
+	existing := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "apiserver", Annotations: map[string]string{canaryPassedAnnotation: "previous"}},
+	}
+	canaryPod := func(age time.Duration) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "openshift-apiserver",
+			Name:              "apiserver-canary",
+			Labels:            map[string]string{"app": "openshift-apiserver-a"},
+			Annotations:       map[string]string{templateHashAnnotation: hash},
+			CreationTimestamp: metav1.NewTime(now.Add(-age)),
+		}}
+	}
+
+	tests := []struct {
+		name              string
+		config            rolloutConfig
+		objects           []runtime.Object
+		checker           fakeCanaryChecker
+		expectPaused      bool
+		expectPassed      string
+		expectStatus      operatorv1.ConditionStatus
+		expectReason      string
+		expectMessagePart string
+		expectRequeue     bool
+	}{
+		{
+			name:         "canary disabled",
+			config:       rolloutConfig{Canary: false, CanaryTimeout: metav1.Duration{Duration: time.Minute}},
+			objects:      []runtime.Object{existing},
+			expectPassed: hash,
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:         "initial rollout",
+			config:       rolloutConfig{Canary: true, CanaryTimeout: metav1.Duration{Duration: time.Minute}},
+			expectPassed: hash,
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:         "waiting for the canary pod",
+			config:       rolloutConfig{Canary: true, CanaryTimeout: metav1.Duration{Duration: time.Minute}},
+			objects:      []runtime.Object{existing},
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "CanaryPending",
+		},
+		{
+			name:              "canary pod not healthy yet",
+			config:            rolloutConfig{Canary: true, CanaryTimeout: metav1.Duration{Duration: time.Minute}},
+			objects:           []runtime.Object{existing, canaryPod(10 * time.Second)},
+			checker:           fakeCanaryChecker{failedCheck: "readyz", err: fmt.Errorf("etcd not ok")},
+			expectPaused:      true,
+			expectStatus:      operatorv1.ConditionFalse,
+			expectReason:      "CanaryInProgress",
+			expectMessagePart: "failed readyz: etcd not ok",
+			expectRequeue:     true,
+		},
+		{
+			name:              "canary pod failing past the timeout",
+			config:            rolloutConfig{Canary: true, CanaryTimeout: metav1.Duration{Duration: time.Minute}},
+			objects:           []runtime.Object{existing, canaryPod(2 * time.Minute)},
+			checker:           fakeCanaryChecker{failedCheck: "discovery", err: fmt.Errorf("route.openshift.io/v1: 503")},
+			expectPaused:      true,
+			expectStatus:      operatorv1.ConditionTrue,
+			expectReason:      "CanaryCheckFailed",
+			expectMessagePart: "canary pod apiserver-canary of pod template " + hash + " failed discovery",
+			expectRequeue:     true,
+		},
+		{
+			name:         "canary pod passed",
+			config:       rolloutConfig{Canary: true, CanaryTimeout: metav1.Duration{Duration: time.Minute}},
+			objects:      []runtime.Object{existing, canaryPod(2 * time.Minute)},
+			expectPassed: hash,
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			deploymentIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, obj := range tc.objects {
+				switch obj.(type) {
+				case *appsv1.Deployment:
+					deploymentIndexer.Add(obj)
+				case *corev1.Pod:
+					podIndexer.Add(obj)
+				}
+			}
+			rollout := &CanaryRollout{
+				deploymentLister: appsv1listers.NewDeploymentLister(deploymentIndexer),
+				podLister:        corev1listers.NewPodLister(podIndexer),
+				checker:          tc.checker,
+				now:              func() time.Time { return now },
+			}
+
+			required := newRequired()
+			result, err := rollout.gate(context.TODO(), tc.config, required, events.NewInMemoryRecorder("test", clocktesting.NewFakePassiveClock(now)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if required.Spec.Paused != tc.expectPaused {
+				t.Errorf("expected paused=%v, got %v", tc.expectPaused, required.Spec.Paused)
+			}
+			if required.Annotations[templateHashAnnotation] != hash || required.Spec.Template.Annotations[templateHashAnnotation] != hash {
+				t.Errorf("expected template hash %q on the deployment and its template", hash)
+			}
+			if required.Annotations[canaryPassedAnnotation] != tc.expectPassed {
+				t.Errorf("expected canary passed annotation %q, got %q", tc.expectPassed, required.Annotations[canaryPassedAnnotation])
+			}
+			if result.condition.Type != canaryConditionType || result.condition.Status != tc.expectStatus || result.condition.Reason != tc.expectReason {
+				t.Errorf("unexpected condition %#v", result.condition)
+			}
+			if !strings.Contains(result.condition.Message, tc.expectMessagePart) {
+				t.Errorf("expected message to contain %q, got %q", tc.expectMessagePart, result.condition.Message)
+			}
+			if (result.requeueAfter > 0) != tc.expectRequeue {
+				t.Errorf("expected requeue=%v, got %v", tc.expectRequeue, result.requeueAfter)
+			}
+		})
+	}
+}
+
+func TestRolloutConfigFor(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         map[string]string
+		expectConfig func(rolloutConfig) bool
+		expectErr    bool
+	}{
+		{
+			name: "defaults",
+			expectConfig: func(config rolloutConfig) bool {
+				return !config.Canary && config.CanaryTimeout.Duration == defaultCanaryTimeout && !config.AutomaticRollback && config.RollbackWindow.Duration == defaultRollbackWindow && config.CoalesceWindow.Duration == defaultCoalesceWindow
+			},
+		},
+		{
+			name: "canary",
+			data: map[string]string{CanaryKey: "true", CanaryTimeoutKey: "5m"},
+			expectConfig: func(config rolloutConfig) bool {
+				return config.Canary && config.CanaryTimeout.Duration == 5*time.Minute
+			},
+		},
+		{
+			name: "automatic rollback",
+			data: map[string]string{AutomaticRollbackKey: "true", RollbackWindowKey: "30m"},
+			expectConfig: func(config rolloutConfig) bool {
+				return config.AutomaticRollback && config.RollbackWindow.Duration == 30*time.Minute
+			},
+		},
+		{
+			name: "coalescing turned off",
+			data: map[string]string{CoalesceWindowKey: "0s"},
+			expectConfig: func(config rolloutConfig) bool {
+				return config.CoalesceWindow.Duration == 0
+			},
+		},
+		{
+			name:      "invalid canary",
+			data:      map[string]string{CanaryKey: "yes please"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid canary timeout",
+			data:      map[string]string{CanaryTimeoutKey: "0s"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid rollback window",
+			data:      map[string]string{RollbackWindowKey: "-5m"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid coalesce window",
+			data:      map[string]string{CoalesceWindowKey: "soon"},
+			expectErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tc.data != nil {
+				if err := indexer.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver-operator", Name: RolloutConfigMapName}, Data: tc.data}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			config, err := rolloutConfigFor(corev1listers.NewConfigMapLister(indexer))
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error=%v, got %v", tc.expectErr, err)
+			}
+			if tc.expectConfig != nil && !tc.expectConfig(config) {
+				t.Errorf("unexpected rollout config %#v", config)
+			}
+		})
+	}
+}
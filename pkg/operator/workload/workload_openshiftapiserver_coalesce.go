@@ -0,0 +1,145 @@
+package workload
+
+import (
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeinformers "k8s.io/client-go/informers"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/library-go/pkg/operator/resource/resourcehash"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	defaultCoalesceWindow = 30 * time.Second
+	// maxCoalesceDelay bounds how long a steady stream of changes can hold back a rollout.
+	maxCoalesceDelay = 5 * time.Minute
+)
+
+// securityInputs are deployment inputs whose changes are rolled out right away.
+var securityInputs = []*resourcehash.ObjectReference{
+	resourcehash.NewObjectRef().ForSecret().InNamespace(operatorclient.TargetNamespace).Named("etcd-client"),
+}
+
+// RolloutCoalescer holds back changes of the pod template until no new change was seen for the coalescing window, so
+// that a burst of configuration changes results in a single rollout.
+//
+// The pending change is kept in memory only. After a restart of the operator a pending change waits for another
+// coalescing window.
+type RolloutCoalescer struct {
+	deploymentLister appsv1listers.DeploymentLister
+	secretLister     corev1listers.SecretLister
+	now              func() time.Time
+
+	// pendingHash is the pod template hash held back, pendingSince when the first change of the burst was seen and
+	// lastChange when the pod template last changed.
+	pendingHash  string
+	pendingSince time.Time
+	lastChange   time.Time
+}
+
+// NewRolloutCoalescer returns a RolloutCoalescer for the deployment in the target namespace.
+func NewRolloutCoalescer(kubeInformersForTargetNamespace kubeinformers.SharedInformerFactory) *RolloutCoalescer {
+	return &RolloutCoalescer{
+		deploymentLister: kubeInformersForTargetNamespace.Apps().V1().Deployments().Lister(),
+		secretLister:     kubeInformersForTargetNamespace.Core().V1().Secrets().Lister(),
+		now:              time.Now,
+	}
+}
+
+// gate replaces the pod template of the required deployment with the existing one while changes are coming in. It
+// returns true when it did.
+func (r *RolloutCoalescer) gate(config rolloutConfig, required *appsv1.Deployment) (rolloutGateResult, bool, error) {
+	result := rolloutGateResult{}
+	desiredHash := required.Annotations[templateHashAnnotation]
+
+	existing, err := r.deploymentLister.Deployments(required.Namespace).Get(required.Name)
+	if apierrors.IsNotFound(err) {
+		return result, false, nil
+	}
+	if err != nil {
+		return result, false, err
+	}
+	// a rolled back deployment keeps differing from the desired pod template, that is not a change
+	if existing.Annotations[templateHashAnnotation] == desiredHash || existing.Annotations[rolledBackFromAnnotation] == desiredHash {
+		r.pendingHash = ""
+		return result, false, nil
+	}
+	if config.CoalesceWindow.Duration <= 0 {
+		return result, false, nil
+	}
+	if _, urgent, err := securityRollout(r.secretLister, existing, required); err != nil || urgent {
+		return result, false, err
+	}
+
+	now := r.now()
+	if r.pendingHash != desiredHash {
+		if len(r.pendingHash) == 0 {
+			r.pendingSince = now
+		}
+		r.pendingHash = desiredHash
+		r.lastChange = now
+	}
+	quietFor := now.Sub(r.lastChange)
+	waited := now.Sub(r.pendingSince)
+	if quietFor >= config.CoalesceWindow.Duration || waited >= maxCoalesceDelay {
+		return result, false, nil
+	}
+
+	holdPodTemplate(existing, required)
+	result.requeueAfter = config.CoalesceWindow.Duration - quietFor
+	if remaining := maxCoalesceDelay - waited; remaining < result.requeueAfter {
+		result.requeueAfter = remaining
+	}
+	return result, true, nil
+}
+
+// holdPodTemplate makes the required deployment keep the pod template and metadata of the existing one.
+func holdPodTemplate(existing, required *appsv1.Deployment) {
+	held := existing.DeepCopy()
+	required.Labels = held.Labels
+	required.Annotations = held.Annotations
+	required.Spec.Template = held.Spec.Template
+	required.Spec.Paused = held.Spec.Paused
+}
+
+// securityRollout tells whether the change from the existing to the required deployment touches a security input,
+// either one of securityInputs or the encryption config of a new revision. Such changes are never held back.
+func securityRollout(secretLister corev1listers.SecretLister, existing, required *appsv1.Deployment) (string, bool, error) {
+	for _, input := range securityInputs {
+		key := dependencyAnnotationPrefix + inputHashKey(input)
+		if existing.Annotations[key] != required.Annotations[key] {
+			return fmt.Sprintf("%s/%s", input.Resource.Resource, input.Name), true, nil
+		}
+	}
+
+	existingRevision, requiredRevision := existing.Labels["revision"], required.Labels["revision"]
+	if existingRevision == requiredRevision {
+		return "", false, nil
+	}
+	hashes := []string{}
+	for _, revision := range []string{existingRevision, requiredRevision} {
+		secret, err := secretLister.Secrets(required.Namespace).Get(fmt.Sprintf("encryption-config-%s", revision))
+		if apierrors.IsNotFound(err) {
+			hashes = append(hashes, "")
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		hash, err := resourcehash.GetSecretHash(secret)
+		if err != nil {
+			return "", false, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if hashes[0] != hashes[1] {
+		return fmt.Sprintf("secrets/encryption-config-%s", requiredRevision), true, nil
+	}
+	return "", false, nil
+}
@@ -0,0 +1,159 @@
+package workload
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestRolloutCoalescerGate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	etcdClientKey := dependencyAnnotationPrefix + "openshift-apiserver.etcd-client.secret"
+	newDeployment := func(hash, revision string, annotations ...string) *appsv1.Deployment {
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "openshift-apiserver",
+				Name:        "apiserver",
+				Labels:      map[string]string{"revision": revision},
+				Annotations: map[string]string{templateHashAnnotation: hash, etcdClientKey: "etcd-client"},
+			},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{templateHashAnnotation: hash}},
+			}},
+		}
+		for i := 0; i+1 < len(annotations); i += 2 {
+			deployment.Annotations[annotations[i]] = annotations[i+1]
+		}
+		return deployment
+	}
+	encryptionConfig := func(revision, content string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "encryption-config-" + revision},
+			Data:       map[string][]byte{"encryption-config": []byte(content)},
+		}
+	}
+	window := rolloutConfig{CoalesceWindow: metav1.Duration{Duration: 30 * time.Second}}
+
+	type step struct {
+		after      time.Duration
+		required   *appsv1.Deployment
+		expectHeld bool
+	}
+	tests := []struct {
+		name     string
+		config   rolloutConfig
+		existing *appsv1.Deployment
+		secrets  []*corev1.Secret
+		steps    []step
+	}{
+		{
+			name:     "burst of changes",
+			config:   window,
+			existing: newDeployment("running", "1"),
+			steps: []step{
+				{after: 0, required: newDeployment("a", "1"), expectHeld: true},
+				{after: 20 * time.Second, required: newDeployment("b", "1"), expectHeld: true},
+				{after: 40 * time.Second, required: newDeployment("b", "1"), expectHeld: true},
+				{after: 50 * time.Second, required: newDeployment("b", "1"), expectHeld: false},
+				{after: 60 * time.Second, required: newDeployment("b", "1"), expectHeld: false},
+			},
+		},
+		{
+			name:     "steady stream of changes",
+			config:   window,
+			existing: newDeployment("running", "1"),
+			steps: []step{
+				{after: 0, required: newDeployment("a", "1"), expectHeld: true},
+				{after: 2 * time.Minute, required: newDeployment("b", "1"), expectHeld: true},
+				{after: 4 * time.Minute, required: newDeployment("c", "1"), expectHeld: true},
+				{after: 5 * time.Minute, required: newDeployment("d", "1"), expectHeld: false},
+			},
+		},
+		{
+			name:     "etcd client changes are not held back",
+			config:   window,
+			existing: newDeployment("running", "1"),
+			steps: []step{
+				{after: 0, required: newDeployment("a", "1", etcdClientKey, "new-etcd-client"), expectHeld: false},
+			},
+		},
+		{
+			name:     "encryption config changes are not held back",
+			config:   window,
+			existing: newDeployment("running", "1"),
+			secrets:  []*corev1.Secret{encryptionConfig("1", "aescbc"), encryptionConfig("2", "aesgcm")},
+			steps: []step{
+				{after: 0, required: newDeployment("a", "2"), expectHeld: false},
+			},
+		},
+		{
+			name:     "revisions with the same encryption config are held back",
+			config:   window,
+			existing: newDeployment("running", "1"),
+			secrets:  []*corev1.Secret{encryptionConfig("1", "aescbc"), encryptionConfig("2", "aescbc")},
+			steps: []step{
+				{after: 0, required: newDeployment("a", "2"), expectHeld: true},
+			},
+		},
+		{
+			name:     "rolled back deployment",
+			config:   window,
+			existing: newDeployment("known-good", "1", rolledBackFromAnnotation, "failed"),
+			steps: []step{
+				{after: 0, required: newDeployment("failed", "2"), expectHeld: false},
+			},
+		},
+		{
+			name:     "coalescing disabled",
+			config:   rolloutConfig{CoalesceWindow: metav1.Duration{}},
+			existing: newDeployment("running", "1"),
+			steps: []step{
+				{after: 0, required: newDeployment("a", "1"), expectHeld: false},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			deploymentIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			deploymentIndexer.Add(tc.existing)
+			secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, secret := range tc.secrets {
+				secretIndexer.Add(secret)
+			}
+			now := start
+			coalescer := &RolloutCoalescer{
+				deploymentLister: appsv1listers.NewDeploymentLister(deploymentIndexer),
+				secretLister:     corev1listers.NewSecretLister(secretIndexer),
+				now:              func() time.Time { return now },
+			}
+
+			for i, step := range tc.steps {
+				now = start.Add(step.after)
+				desiredHash := step.required.Annotations[templateHashAnnotation]
+				result, held, err := coalescer.gate(tc.config, step.required)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if held != step.expectHeld {
+					t.Fatalf("step %d: expected held=%v, got %v", i, step.expectHeld, held)
+				}
+				if held {
+					if step.required.Annotations[templateHashAnnotation] != tc.existing.Annotations[templateHashAnnotation] {
+						t.Errorf("step %d: expected the existing pod template to be kept", i)
+					}
+					if result.requeueAfter <= 0 {
+						t.Errorf("step %d: expected a requeue", i)
+					}
+				} else if step.required.Annotations[templateHashAnnotation] != desiredHash {
+					t.Errorf("step %d: expected the required pod template to be kept", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package workload
+
+import (
+	"errors"
+	"fmt"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+// The steps of the workload sync each own a Degraded condition, so that a failure points at the step that failed
+// instead of ending up in the flattened APIServerDeploymentDegraded message only.
+const (
+	configMapConditionType        = "WorkloadConfigMapDegraded"
+	templateConditionType         = "WorkloadTemplateDegraded"
+	deploymentInputsConditionType = "WorkloadDeploymentInputsDegraded"
+	nodeCountConditionType        = "WorkloadNodeCountDegraded"
+	kmsSidecarConditionType       = "WorkloadKMSSidecarDegraded"
+)
+
+// deploymentSteps are the conditions of the steps rendering the deployment, in the order the steps run.
+var deploymentSteps = []string{
+	templateConditionType,
+	deploymentInputsConditionType,
+	nodeCountConditionType,
+	kmsSidecarConditionType,
+}
+
+// stepError is the failure of a step of the workload sync.
+type stepError struct {
+	conditionType string
+	reason        string
+	err           error
+}
+
+func newStepError(conditionType, reason string, err error) error {
+	return &stepError{conditionType: conditionType, reason: reason, err: err}
+}
+
+func (e *stepError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stepError) Unwrap() error {
+	return e.err
+}
+
+// isStepError returns whether err is the failure of a step, which is reported by the condition of the step.
+func isStepError(err error) bool {
+	var failed *stepError
+	return errors.As(err, &failed)
+}
+
+// stepConditions returns the conditions of the given steps, run in order, after the first step returned err. The
+// steps before the failed one succeeded, the ones after it didn't run and are Unknown, so that a condition of an
+// earlier failure doesn't linger. Errors that don't belong to a step don't tell anything about the steps, so no
+// condition is returned for them.
+func stepConditions(steps []string, err error) []operatorv1.OperatorCondition {
+	var failed *stepError
+	if err != nil && !errors.As(err, &failed) {
+		return nil
+	}
+
+	conditions := []operatorv1.OperatorCondition{}
+	skipped := false
+	for _, step := range steps {
+		switch {
+		case skipped:
+			conditions = append(conditions, operatorv1.OperatorCondition{
+				Type:    step,
+				Status:  operatorv1.ConditionUnknown,
+				Reason:  "PreviousStepFailed",
+				Message: fmt.Sprintf("not run because %s is True", failed.conditionType),
+			})
+		case failed != nil && failed.conditionType == step:
+			conditions = append(conditions, operatorv1.OperatorCondition{
+				Type:    step,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  failed.reason,
+				Message: failed.err.Error(),
+			})
+			skipped = true
+		default:
+			conditions = append(conditions, operatorv1.OperatorCondition{Type: step, Status: operatorv1.ConditionFalse, Reason: "AsExpected"})
+		}
+	}
+	return conditions
+}
@@ -0,0 +1,171 @@
+package workload
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/robfig/cron"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// MaintenanceWindowsConfigMapName is the configmap in the operator namespace holding the maintenance windows.
+	MaintenanceWindowsConfigMapName = "openshift-apiserver-maintenance-windows"
+	maintenanceWindowsKey           = "windows"
+
+	rolloutPendingConditionType = "RolloutPending"
+)
+
+// maintenanceWindow opens at every time matching Schedule, a standard cron expression evaluated in UTC, and stays
+// open for Duration.
+type maintenanceWindow struct {
+	Schedule string          `json:"schedule"`
+	Duration metav1.Duration `json:"duration"`
+}
+
+// MaintenanceWindows defers rollouts of the pod template until a maintenance window opens. Upgrades, changes of
+// security inputs and the initial rollout are never deferred.
+type MaintenanceWindows struct {
+	deploymentLister        appsv1listers.DeploymentLister
+	secretLister            corev1listers.SecretLister
+	operatorConfigMapLister corev1listers.ConfigMapLister
+	now                     func() time.Time
+}
+
+// NewMaintenanceWindows returns MaintenanceWindows for the deployment in the target namespace.
+func NewMaintenanceWindows(kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces) *MaintenanceWindows {
+	kubeInformersForTargetNamespace := kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace)
+	return &MaintenanceWindows{
+		deploymentLister:        kubeInformersForTargetNamespace.Apps().V1().Deployments().Lister(),
+		secretLister:            kubeInformersForTargetNamespace.Core().V1().Secrets().Lister(),
+		operatorConfigMapLister: kubeInformersForNamespaces.InformersFor(operatorclient.OperatorNamespace).Core().V1().ConfigMaps().Lister(),
+		now:                     time.Now,
+	}
+}
+
+// gate replaces the pod template of the required deployment with the existing one while no maintenance window is
+// open. It returns true when it did.
+func (m *MaintenanceWindows) gate(required *appsv1.Deployment) (rolloutGateResult, bool, error) {
+	result := rolloutGateResult{condition: operatorv1.OperatorCondition{Type: rolloutPendingConditionType, Status: operatorv1.ConditionFalse, Reason: "AsExpected"}}
+	desiredHash := required.Annotations[templateHashAnnotation]
+
+	windows, err := m.windows()
+	if err != nil {
+		// a broken schedule must not block rollouts forever
+		result.condition.Reason = "InvalidMaintenanceWindow"
+		result.condition.Message = err.Error()
+		return result, false, nil
+	}
+	if len(windows) == 0 {
+		return result, false, nil
+	}
+
+	existing, err := m.deploymentLister.Deployments(required.Namespace).Get(required.Name)
+	if apierrors.IsNotFound(err) {
+		return result, false, nil
+	}
+	if err != nil {
+		return result, false, err
+	}
+	if existing.Annotations[templateHashAnnotation] == desiredHash || existing.Annotations[rolledBackFromAnnotation] == desiredHash {
+		return result, false, nil
+	}
+	if upgrade(existing, required) {
+		return result, false, nil
+	}
+	if _, urgent, err := securityRollout(m.secretLister, existing, required); err != nil || urgent {
+		return result, false, err
+	}
+
+	now := m.now().UTC()
+	next := time.Time{}
+	for _, window := range windows {
+		opens, open := window.next(now)
+		if open {
+			return result, false, nil
+		}
+		if next.IsZero() || opens.Before(next) {
+			next = opens
+		}
+	}
+
+	holdPodTemplate(existing, required)
+	result.requeueAfter = next.Sub(now)
+	result.condition.Status = operatorv1.ConditionTrue
+	result.condition.Reason = "MaintenanceWindowClosed"
+	result.condition.Message = fmt.Sprintf("pod template %s of revision %s waits for the maintenance window opening at %s", desiredHash, required.Labels["revision"], next.Format(time.RFC3339))
+	return result, true, nil
+}
+
+// windows returns the parsed maintenance windows of MaintenanceWindowsConfigMapName.
+func (m *MaintenanceWindows) windows() ([]parsedMaintenanceWindow, error) {
+	configMap, err := m.operatorConfigMapLister.ConfigMaps(operatorclient.OperatorNamespace).Get(MaintenanceWindowsConfigMapName)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	windows := []maintenanceWindow{}
+	if err := yaml.Unmarshal([]byte(configMap.Data[maintenanceWindowsKey]), &windows); err != nil {
+		return nil, fmt.Errorf("configmaps/%s[%s] key %q: %v", MaintenanceWindowsConfigMapName, operatorclient.OperatorNamespace, maintenanceWindowsKey, err)
+	}
+
+	ret := []parsedMaintenanceWindow{}
+	errs := []string{}
+	for _, window := range windows {
+		schedule, err := cron.ParseStandard(window.Schedule)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("schedule %q: %v", window.Schedule, err))
+			continue
+		}
+		if window.Duration.Duration <= 0 {
+			errs = append(errs, fmt.Sprintf("schedule %q: duration must be positive", window.Schedule))
+			continue
+		}
+		ret = append(ret, parsedMaintenanceWindow{schedule: schedule, duration: window.Duration.Duration})
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid maintenance windows: %s", strings.Join(errs, ", "))
+	}
+	return ret, nil
+}
+
+type parsedMaintenanceWindow struct {
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+// next returns whether the window is open at the given time and, if it isn't, when it opens next.
+func (w parsedMaintenanceWindow) next(now time.Time) (time.Time, bool) {
+	// the last opening that can still be open now is the first one after now-duration
+	if opened := w.schedule.Next(now.Add(-w.duration)); !opened.After(now) {
+		return opened, true
+	}
+	return w.schedule.Next(now), false
+}
+
+// pullSpecAnnotations name the images a deployment was rendered with.
+var pullSpecAnnotations = []string{"openshiftapiservers.operator.openshift.io/pull-spec", "openshiftapiservers.operator.openshift.io/operator-pull-spec"}
+
+// upgrade tells whether the required deployment runs different images than the existing one.
+func upgrade(existing, required *appsv1.Deployment) bool {
+	for _, annotation := range pullSpecAnnotations {
+		if existing.Annotations[annotation] != required.Annotations[annotation] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package workload
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+func TestMaintenanceWindowsGate(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+	pullSpecAnnotation := "openshiftapiservers.operator.openshift.io/pull-spec"
+	newDeployment := func(hash string, annotations ...string) *appsv1.Deployment {
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "openshift-apiserver",
+				Name:        "apiserver",
+				Labels:      map[string]string{"revision": "1"},
+				Annotations: map[string]string{templateHashAnnotation: hash, pullSpecAnnotation: "image"},
+			},
+		}
+		for i := 0; i+1 < len(annotations); i += 2 {
+			deployment.Annotations[annotations[i]] = annotations[i+1]
+		}
+		return deployment
+	}
+	windowsConfigMap := func(windows string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver-operator", Name: MaintenanceWindowsConfigMapName},
+			Data:       map[string]string{maintenanceWindowsKey: windows},
+		}
+	}
+	saturdayNights := windowsConfigMap(`[{"schedule": "0 2 * * 6", "duration": "4h"}]`)
+
+	tests := []struct {
+		name              string
+		configMap         *corev1.ConfigMap
+		existing          *appsv1.Deployment
+		required          *appsv1.Deployment
+		expectHeld        bool
+		expectStatus      operatorv1.ConditionStatus
+		expectReason      string
+		expectMessagePart string
+	}{
+		{
+			name:         "no maintenance windows",
+			existing:     newDeployment("running"),
+			required:     newDeployment("new"),
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:              "outside of the window",
+			configMap:         saturdayNights,
+			existing:          newDeployment("running"),
+			required:          newDeployment("new"),
+			expectHeld:        true,
+			expectStatus:      operatorv1.ConditionTrue,
+			expectReason:      "MaintenanceWindowClosed",
+			expectMessagePart: "pod template new of revision 1 waits for the maintenance window opening at 2024-01-06T02:00:00Z",
+		},
+		{
+			name:         "inside of the window",
+			configMap:    windowsConfigMap(`[{"schedule": "0 10 * * *", "duration": "3h"}]`),
+			existing:     newDeployment("running"),
+			required:     newDeployment("new"),
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:              "invalid windows",
+			configMap:         windowsConfigMap(`[{"schedule": "every saturday", "duration": "4h"}]`),
+			existing:          newDeployment("running"),
+			required:          newDeployment("new"),
+			expectStatus:      operatorv1.ConditionFalse,
+			expectReason:      "InvalidMaintenanceWindow",
+			expectMessagePart: `schedule "every saturday"`,
+		},
+		{
+			name:         "upgrades are not deferred",
+			configMap:    saturdayNights,
+			existing:     newDeployment("running"),
+			required:     newDeployment("new", pullSpecAnnotation, "new-image"),
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:         "security inputs are not deferred",
+			configMap:    saturdayNights,
+			existing:     newDeployment("running"),
+			required:     newDeployment("new", dependencyAnnotationPrefix+"openshift-apiserver.etcd-client.secret", "new-etcd-client"),
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+		{
+			name:         "initial rollout is not deferred",
+			configMap:    saturdayNights,
+			required:     newDeployment("new"),
+			expectStatus: operatorv1.ConditionFalse,
+			expectReason: "AsExpected",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			deploymentIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if tc.existing != nil {
+				deploymentIndexer.Add(tc.existing)
+			}
+			configMapIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if tc.configMap != nil {
+				configMapIndexer.Add(tc.configMap)
+			}
+			maintenanceWindows := &MaintenanceWindows{
+				deploymentLister:        appsv1listers.NewDeploymentLister(deploymentIndexer),
+				secretLister:            corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+				operatorConfigMapLister: corev1listers.NewConfigMapLister(configMapIndexer),
+				now:                     func() time.Time { return now },
+			}
+
+			result, held, err := maintenanceWindows.gate(tc.required)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if held != tc.expectHeld {
+				t.Errorf("expected held=%v, got %v", tc.expectHeld, held)
+			}
+			if held && tc.required.Annotations[templateHashAnnotation] != tc.existing.Annotations[templateHashAnnotation] {
+				t.Errorf("expected the existing pod template to be kept")
+			}
+			if held && result.requeueAfter != 62*time.Hour {
+				t.Errorf("expected a requeue when the window opens, got %v", result.requeueAfter)
+			}
+			if result.condition.Type != rolloutPendingConditionType || result.condition.Status != tc.expectStatus || result.condition.Reason != tc.expectReason {
+				t.Errorf("unexpected condition %#v", result.condition)
+			}
+			if !strings.Contains(result.condition.Message, tc.expectMessagePart) {
+				t.Errorf("expected message to contain %q, got %q", tc.expectMessagePart, result.condition.Message)
+			}
+		})
+	}
+}
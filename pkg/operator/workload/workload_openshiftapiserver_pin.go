@@ -0,0 +1,204 @@
+package workload
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
+)
+
+const (
+	// PinnedRevisionAnnotation on the OpenShiftAPIServer pins the deployment to the revision it names, instead of the
+	// latest available one, until it is removed.
+	PinnedRevisionAnnotation = "openshiftapiservers.operator.openshift.io/pinned-revision"
+
+	pinDegradedConditionType    = "RevisionPinDegraded"
+	pinUpgradeableConditionType = "RevisionPinUpgradeable"
+)
+
+// PinnedRevision returns the revision pinned by the annotation, and false without the annotation.
+func PinnedRevision(operatorConfig metav1.Object) (int32, bool, error) {
+	value, ok := operatorConfig.GetAnnotations()[PinnedRevisionAnnotation]
+	if !ok {
+		return 0, false, nil
+	}
+	revision, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || revision <= 0 {
+		return 0, true, fmt.Errorf("%s %q is not a revision", PinnedRevisionAnnotation, value)
+	}
+	return int32(revision), true, nil
+}
+
+// RevisionPin renders the deployment of the revision pinned by the PinnedRevisionAnnotation.
+//
+// A pin is refused when the revision isn't available, or when its encryption configuration writes with another key
+// than the latest revision or lacks a key of it. Data may still be encrypted with every key the encryption controllers
+// put into the configuration, and they expect new data to be written with their write key.
+type RevisionPin struct {
+	configMapLister corev1listers.ConfigMapLister
+	secretLister    corev1listers.SecretLister
+}
+
+// NewRevisionPin returns a RevisionPin for the deployment in the target namespace.
+func NewRevisionPin(kubeInformersForTargetNamespace kubeinformers.SharedInformerFactory) *RevisionPin {
+	return &RevisionPin{
+		configMapLister: kubeInformersForTargetNamespace.Core().V1().ConfigMaps().Lister(),
+		secretLister:    kubeInformersForTargetNamespace.Core().V1().Secrets().Lister(),
+	}
+}
+
+// revision returns the revision to render, whether it is pinned and the conditions reporting the pin. A refused pin
+// renders the latest available revision. Upgrades are blocked while a pin is in effect.
+func (p *RevisionPin) revision(operatorConfig *operatorv1.OpenShiftAPIServer, namespace string) (int32, bool, []operatorv1.OperatorCondition) {
+	latest := operatorConfig.Status.LatestAvailableRevision
+	degraded := operatorv1.OperatorCondition{Type: pinDegradedConditionType, Status: operatorv1.ConditionFalse, Reason: "AsExpected"}
+	upgradeable := operatorv1.OperatorCondition{Type: pinUpgradeableConditionType, Status: operatorv1.ConditionTrue, Reason: "AsExpected"}
+
+	pinned, ok, err := PinnedRevision(operatorConfig)
+	if !ok {
+		return latest, false, []operatorv1.OperatorCondition{degraded, upgradeable}
+	}
+	if err == nil {
+		err = p.validate(namespace, pinned, latest)
+	}
+	if err != nil {
+		degraded.Status = operatorv1.ConditionTrue
+		degraded.Reason = "PinRefused"
+		degraded.Message = fmt.Sprintf("running the latest revision %d: %v", latest, err)
+		return latest, false, []operatorv1.OperatorCondition{degraded, upgradeable}
+	}
+
+	upgradeable.Status = operatorv1.ConditionFalse
+	upgradeable.Reason = "RevisionPinned"
+	upgradeable.Message = fmt.Sprintf("revision %d is pinned by the %s annotation, the latest revision is %d", pinned, PinnedRevisionAnnotation, latest)
+	return pinned, true, []operatorv1.OperatorCondition{degraded, upgradeable}
+}
+
+// validate returns why the revision can't be pinned.
+func (p *RevisionPin) validate(namespace string, pinned, latest int32) error {
+	if pinned > latest {
+		return fmt.Errorf("revision %d is newer than the latest revision %d", pinned, latest)
+	}
+	if _, err := p.configMapLister.ConfigMaps(namespace).Get(fmt.Sprintf("audit-%d", pinned)); apierrors.IsNotFound(err) {
+		return fmt.Errorf("revision %d was pruned", pinned)
+	} else if err != nil {
+		return err
+	}
+	if pinned == latest {
+		return nil
+	}
+
+	pinnedKeys, err := p.encryptionKeys(namespace, pinned)
+	if err != nil {
+		return err
+	}
+	latestKeys, err := p.encryptionKeys(namespace, latest)
+	if err != nil {
+		return err
+	}
+	resources := map[string]bool{}
+	for resource := range pinnedKeys {
+		resources[resource] = true
+	}
+	for resource := range latestKeys {
+		resources[resource] = true
+	}
+	problems := []string{}
+	for resource := range resources {
+		pinnedResource, latestResource := pinnedKeys[resource], latestKeys[resource]
+		if pinnedResource.writeKey() != latestResource.writeKey() {
+			problems = append(problems, fmt.Sprintf("revision %d writes %s with %s instead of %s", pinned, resource, pinnedResource.writeKey(), latestResource.writeKey()))
+		}
+		for _, key := range latestResource {
+			if !pinnedResource.has(key) {
+				problems = append(problems, fmt.Sprintf("revision %d can't read %s encrypted with %s", pinned, resource, key))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// resourceKeys are the keys of a resource in an encryption configuration as <provider>:<key name>, the write key first.
+type resourceKeys []string
+
+func (k resourceKeys) writeKey() string {
+	if len(k) == 0 {
+		return "identity"
+	}
+	return k[0]
+}
+
+func (k resourceKeys) has(key string) bool {
+	for _, existing := range k {
+		if existing == key {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptionKeys returns the keys of every resource in the encryption configuration of the revision, none without one.
+func (p *RevisionPin) encryptionKeys(namespace string, revision int32) (map[string]resourceKeys, error) {
+	secret, err := p.secretLister.Secrets(namespace).Get(fmt.Sprintf("%s-%d", encryptiondata.EncryptionConfSecretName, revision))
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	config, err := encryptiondata.FromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.Encryption == nil {
+		return nil, nil
+	}
+	keys := map[string]resourceKeys{}
+	for _, resourceConfig := range config.Encryption.Resources {
+		resourceKeys := resourceKeys{}
+		for _, provider := range resourceConfig.Providers {
+			resourceKeys = append(resourceKeys, providerKeys(provider)...)
+		}
+		for _, resource := range resourceConfig.Resources {
+			keys[resource] = resourceKeys
+		}
+	}
+	return keys, nil
+}
+
+// providerKeys returns the keys of a provider. The identity provider has a key too, a write key of identity means
+// unencrypted writes.
+func providerKeys(provider apiserverv1.ProviderConfiguration) []string {
+	keys := []string{}
+	addKeys := func(mode string, configured []apiserverv1.Key) {
+		for _, key := range configured {
+			keys = append(keys, mode+":"+key.Name)
+		}
+	}
+	switch {
+	case provider.AESCBC != nil:
+		addKeys("aescbc", provider.AESCBC.Keys)
+	case provider.AESGCM != nil:
+		addKeys("aesgcm", provider.AESGCM.Keys)
+	case provider.Secretbox != nil:
+		addKeys("secretbox", provider.Secretbox.Keys)
+	case provider.KMS != nil:
+		keys = append(keys, "kms:"+provider.KMS.Name)
+	case provider.Identity != nil:
+		keys = append(keys, "identity")
+	}
+	return keys
+}
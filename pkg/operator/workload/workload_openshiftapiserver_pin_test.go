@@ -0,0 +1,170 @@
+package workload
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/encryption/encryptiondata"
+)
+
+func TestRevisionPin(t *testing.T) {
+	aescbc := func(keys ...string) apiserverv1.ProviderConfiguration {
+		provider := apiserverv1.ProviderConfiguration{AESCBC: &apiserverv1.AESConfiguration{}}
+		for _, key := range keys {
+			provider.AESCBC.Keys = append(provider.AESCBC.Keys, apiserverv1.Key{Name: key, Secret: "NzFlYTdjOTE0MTlhNjhmZDEyMjRmODhkNTAzMTZiNGU="})
+		}
+		return provider
+	}
+	identity := apiserverv1.ProviderConfiguration{Identity: &apiserverv1.IdentityConfiguration{}}
+	routes := func(providers ...apiserverv1.ProviderConfiguration) []apiserverv1.ResourceConfiguration {
+		return []apiserverv1.ResourceConfiguration{{Resources: []string{"routes.route.openshift.io"}, Providers: providers}}
+	}
+
+	tests := []struct {
+		name       string
+		pin        string
+		encryption map[int32][]apiserverv1.ResourceConfiguration
+		expect     int32
+		expectPin  bool
+		expectMsg  string
+	}{
+		{
+			name:   "no pin",
+			expect: 5,
+		},
+		{
+			name:      "unencrypted",
+			pin:       "3",
+			expect:    3,
+			expectPin: true,
+		},
+		{
+			name:      "latest",
+			pin:       "5",
+			expect:    5,
+			expectPin: true,
+		},
+		{
+			name: "same keys",
+			pin:  "3",
+			encryption: map[int32][]apiserverv1.ResourceConfiguration{
+				3: routes(aescbc("2", "1"), identity),
+				5: routes(aescbc("2", "1"), identity),
+			},
+			expect:    3,
+			expectPin: true,
+		},
+		{
+			name: "additional keys",
+			pin:  "3",
+			encryption: map[int32][]apiserverv1.ResourceConfiguration{
+				3: routes(aescbc("2", "1"), identity),
+				5: routes(aescbc("2"), identity),
+			},
+			expect:    3,
+			expectPin: true,
+		},
+		{
+			name: "older write key",
+			pin:  "3",
+			encryption: map[int32][]apiserverv1.ResourceConfiguration{
+				3: routes(aescbc("1", "2"), identity),
+				5: routes(aescbc("2", "1"), identity),
+			},
+			expect:    5,
+			expectMsg: "revision 3 writes routes.route.openshift.io with aescbc:1 instead of aescbc:2",
+		},
+		{
+			name: "missing key",
+			pin:  "3",
+			encryption: map[int32][]apiserverv1.ResourceConfiguration{
+				3: routes(aescbc("1"), identity),
+				5: routes(aescbc("2", "1"), identity),
+			},
+			expect:    5,
+			expectMsg: "revision 3 can't read routes.route.openshift.io encrypted with aescbc:2",
+		},
+		{
+			name: "encrypted since",
+			pin:  "3",
+			encryption: map[int32][]apiserverv1.ResourceConfiguration{
+				5: routes(aescbc("1"), identity),
+			},
+			expect:    5,
+			expectMsg: "revision 3 writes routes.route.openshift.io with identity instead of aescbc:1",
+		},
+		{
+			name:      "pruned",
+			pin:       "1",
+			expect:    5,
+			expectMsg: "revision 1 was pruned",
+		},
+		{
+			name:      "newer",
+			pin:       "6",
+			expect:    5,
+			expectMsg: "revision 6 is newer than the latest revision 5",
+		},
+		{
+			name:      "invalid",
+			pin:       "latest",
+			expect:    5,
+			expectMsg: `"latest" is not a revision`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			configMaps := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for revision := int32(2); revision <= 5; revision++ {
+				if err := configMaps.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: fmt.Sprintf("audit-%d", revision)}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for revision, resources := range tc.encryption {
+				secret, err := encryptiondata.ToSecret("openshift-apiserver", fmt.Sprintf("encryption-config-%d", revision), &encryptiondata.Config{Encryption: &apiserverv1.EncryptionConfiguration{Resources: resources}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := secrets.Add(secret); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pin := &RevisionPin{
+				configMapLister: corev1listers.NewConfigMapLister(configMaps),
+				secretLister:    corev1listers.NewSecretLister(secrets),
+			}
+
+			operatorConfig := &operatorv1.OpenShiftAPIServer{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+				Status:     operatorv1.OpenShiftAPIServerStatus{OperatorStatus: operatorv1.OperatorStatus{LatestAvailableRevision: 5}},
+			}
+			if len(tc.pin) > 0 {
+				operatorConfig.Annotations = map[string]string{PinnedRevisionAnnotation: tc.pin}
+			}
+
+			revision, pinned, conditions := pin.revision(operatorConfig, "openshift-apiserver")
+			if revision != tc.expect || pinned != tc.expectPin {
+				t.Errorf("expected revision %d pinned %v, got %d pinned %v", tc.expect, tc.expectPin, revision, pinned)
+			}
+			degraded, upgradeable := conditions[0], conditions[1]
+			if degraded.Type != pinDegradedConditionType || upgradeable.Type != pinUpgradeableConditionType {
+				t.Fatalf("unexpected conditions %#v", conditions)
+			}
+			if expectDegraded := len(tc.expectMsg) > 0; (degraded.Status == operatorv1.ConditionTrue) != expectDegraded || !strings.Contains(degraded.Message, tc.expectMsg) {
+				t.Errorf("expected degraded %v with %q, got %#v", expectDegraded, tc.expectMsg, degraded)
+			}
+			if (upgradeable.Status == operatorv1.ConditionFalse) != tc.expectPin {
+				t.Errorf("expected upgradeable %v, got %#v", !tc.expectPin, upgradeable)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisterv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configlisterv1 "github.com/openshift/client-go/config/listers/config/v1"
+	workloadcontroller "github.com/openshift/library-go/pkg/operator/apiserver/controller/workload"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/imageimportcacontroller"
+)
+
+// RenderInput holds everything needed to render the operand manifests without a cluster.
+type RenderInput struct {
+	OperatorConfig *operatorv1.OpenShiftAPIServer
+	ClusterVersion *configv1.ClusterVersion
+	ImageConfig    *configv1.Image
+
+	// ExistingObjects are seeded into the fake kube client before rendering, for example
+	// the merged-trusted-image-registry-ca ConfigMap or the user's additionalTrustedCA ConfigMap.
+	ExistingObjects []runtime.Object
+
+	TargetImagePullSpec   string
+	OperatorImagePullSpec string
+	MasterNodeCount       int32
+	// ControlPlaneTopology selects the topology profile, it defaults to a highly available control plane.
+	ControlPlaneTopology configv1.TopologyMode
+
+	FeatureGateAccessor featuregates.FeatureGateAccess
+}
+
+// RenderOutput holds the operand manifests produced by RenderOperand.
+type RenderOutput struct {
+	Config        *corev1.ConfigMap
+	ImageImportCA *corev1.ConfigMap
+	Deployment    *appsv1.Deployment
+}
+
+// RenderOperand runs the same config management and deployment rendering the workload controller runs during Sync and
+// the same merge the image-import-ca controller does, but against fake clients and listers seeded with the given input,
+// and returns the resulting objects.
+func RenderOperand(ctx context.Context, input RenderInput) (*RenderOutput, error) {
+	if input.OperatorConfig == nil {
+		return nil, fmt.Errorf("missing OpenShiftAPIServer")
+	}
+	if input.ClusterVersion == nil {
+		return nil, fmt.Errorf("missing ClusterVersion")
+	}
+	imageConfig := input.ImageConfig
+	if imageConfig == nil {
+		imageConfig = &configv1.Image{}
+	}
+	imageConfig = imageConfig.DeepCopy()
+	imageConfig.Name = "cluster"
+
+	kubeClient := fake.NewSimpleClientset(input.ExistingObjects...)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(input.ClusterVersion); err != nil {
+		return nil, err
+	}
+	clusterVersionLister := configlisterv1.NewClusterVersionLister(indexer)
+
+	imageIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := imageIndexer.Add(imageConfig); err != nil {
+		return nil, err
+	}
+	configMapIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, obj := range input.ExistingObjects {
+		if configMap, ok := obj.(*corev1.ConfigMap); ok {
+			if err := configMapIndexer.Add(configMap); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	recorder := events.NewInMemoryRecorder("openshift-apiserver-render", clocktesting.NewFakePassiveClock(time.Now()))
+	operatorConfig := input.OperatorConfig.DeepCopy()
+
+	config, _, err := manageOpenShiftAPIServerConfigMap_v311_00_to_latest(ctx, kubeClient.CoreV1(), clusterVersionLister, recorder, operatorConfig, input.ControlPlaneTopology)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", "configmap", err)
+	}
+
+	imageImportCA, problems, err := imageimportcacontroller.RequiredConfigMap(configlisterv1.NewImageLister(imageIndexer), corelisterv1.NewConfigMapLister(configMapIndexer))
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", "image-import-ca", err)
+	}
+	for _, problem := range append(problems.Missing, problems.Invalid...) {
+		klog.Warningf("image-import-ca: %s", problem)
+	}
+	// the deployment hashes image-import-ca like in the cluster, where the image-import-ca controller applies it
+	if _, _, err := resourceapply.ApplyConfigMap(ctx, kubeClient.CoreV1(), recorder, imageImportCA); err != nil {
+		return nil, fmt.Errorf("%q: %v", "image-import-ca", err)
+	}
+
+	masterNodeCount := input.MasterNodeCount
+	countNodes := func(_ map[string]string) (*int32, error) {
+		return &masterNodeCount, nil
+	}
+	deployment, err := renderOpenShiftAPIServerDeployment_v311_00_to_latest(ctx, kubeClient, deploymentRenderInput{
+		countNodes:                countNodes,
+		topology:                  input.ControlPlaneTopology,
+		imagePullSpec:             input.TargetImagePullSpec,
+		operatorImagePullSpec:     input.OperatorImagePullSpec,
+		operatorConfig:            operatorConfig,
+		ensureAtMostOnePodPerNode: workloadcontroller.EnsureAtMostOnePodPerNode,
+		featureGateAccessor:       input.FeatureGateAccessor,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", "deployments", err)
+	}
+
+	return &RenderOutput{
+		Config:        config,
+		ImageImportCA: imageImportCA,
+		Deployment:    deployment,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package workload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+)
+
+func TestRenderOperand(t *testing.T) {
+	t.Setenv("KUBE_APISERVER_OPERATOR_IMAGE", "quay.io/openshift/kube-apiserver-operator:latest")
+	ca, err := crypto.MakeSelfSignedCAConfig("registry", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, _, err := ca.GetPEMBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := RenderOperand(context.Background(), RenderInput{
+		OperatorConfig: &operatorv1.OpenShiftAPIServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster", Generation: 3},
+			Spec: operatorv1.OpenShiftAPIServerSpec{OperatorSpec: operatorv1.OperatorSpec{
+				LogLevel:       operatorv1.Debug,
+				ObservedConfig: runtime.RawExtension{Raw: []byte(withETCDServerListJSON)},
+			}},
+			Status: operatorv1.OpenShiftAPIServerStatus{OperatorStatus: operatorv1.OperatorStatus{LatestAvailableRevision: 7}},
+		},
+		ClusterVersion: &configv1.ClusterVersion{ObjectMeta: metav1.ObjectMeta{Name: "version"}},
+		ImageConfig:    &configv1.Image{Spec: configv1.ImageSpec{AdditionalTrustedCA: configv1.ConfigMapNameReference{Name: "user-ca"}}},
+		ExistingObjects: []runtime.Object{
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "user-ca", Namespace: "openshift-config"}, Data: map[string]string{"registry.example.com": string(caPEM)}},
+		},
+		TargetImagePullSpec:   "quay.io/openshift/apiserver:latest",
+		OperatorImagePullSpec: "quay.io/openshift/operator:latest",
+		MasterNodeCount:       2,
+		FeatureGateAccessor:   featuregates.NewHardcodedFeatureGateAccessForTesting(nil, nil, make(chan struct{}), nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := output.Config.Data["config.yaml"]; !ok {
+		t.Errorf("expected config.yaml in the rendered config, got %v", output.Config.Data)
+	}
+	if output.ImageImportCA.Data["registry.example.com"] != string(caPEM) {
+		t.Errorf("expected the additional trusted CA in image-import-ca, got %v", output.ImageImportCA.Data)
+	}
+	for _, annotations := range []map[string]string{output.Deployment.Annotations, output.Deployment.Spec.Template.Annotations} {
+		if _, ok := annotations["operator.openshift.io/dep-openshift-apiserver.image-import-ca.configmap"]; !ok {
+			t.Errorf("expected the image-import-ca hash in the deployment, got %v", annotations)
+		}
+	}
+	if *output.Deployment.Spec.Replicas != 2 {
+		t.Errorf("expected 2 replicas, got %d", *output.Deployment.Spec.Replicas)
+	}
+	if output.Deployment.Spec.Template.Labels["revision"] != "7" {
+		t.Errorf("expected revision 7, got %q", output.Deployment.Spec.Template.Labels["revision"])
+	}
+	if output.Deployment.Spec.Template.Spec.Containers[0].Image != "quay.io/openshift/apiserver:latest" {
+		t.Errorf("unexpected image %q", output.Deployment.Spec.Template.Spec.Containers[0].Image)
+	}
+}
@@ -0,0 +1,324 @@
+package workload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcehash"
+
+	operatormetrics "github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/metrics"
+)
+
+const (
+	// KnownGoodConfigMapName is a snapshot of the config configmap taken when the deployment last became fully available.
+	KnownGoodConfigMapName = "config-known-good"
+	// knownGoodRevisionAnnotation, knownGoodTemplateHashAnnotation and knownGoodInputHashesAnnotation describe the
+	// known-good deployment on the snapshot.
+	knownGoodRevisionAnnotation     = "openshiftapiservers.operator.openshift.io/known-good-revision"
+	knownGoodTemplateHashAnnotation = "openshiftapiservers.operator.openshift.io/known-good-template-hash"
+	knownGoodInputHashesAnnotation  = "openshiftapiservers.operator.openshift.io/known-good-input-hashes"
+	// rolloutStartedAnnotation records when the rollout of the current pod template started.
+	rolloutStartedAnnotation = "openshiftapiservers.operator.openshift.io/rollout-started"
+	// rolledBackFromAnnotation names the pod template hash that was rolled back.
+	rolledBackFromAnnotation = "openshiftapiservers.operator.openshift.io/rolled-back-from"
+
+	dependencyAnnotationPrefix = "operator.openshift.io/dep-"
+
+	rollbackConditionType = "RevisionRollbackDegraded"
+	defaultRollbackWindow = 15 * time.Minute
+)
+
+// knownGoodRevision is the last revision of the deployment that reached full availability.
+type knownGoodRevision struct {
+	revision     int32
+	templateHash string
+	// inputHashes are the dependency annotations of the known-good deployment.
+	inputHashes map[string]string
+	// pullSpecs are the pull-spec annotations of the known-good deployment.
+	pullSpecs map[string]string
+}
+
+// upgrade tells whether the required deployment runs different images than the known-good one. Snapshots taken
+// without pull specs count as upgrades until the next deployment becomes available.
+func (k *knownGoodRevision) upgrade(required *appsv1.Deployment) bool {
+	for _, annotation := range pullSpecAnnotations {
+		if k.pullSpecs[annotation] != required.Annotations[annotation] {
+			return true
+		}
+	}
+	return false
+}
+
+// renderRevisionFunc renders the deployment of the given revision.
+type renderRevisionFunc func(revision int32) (*appsv1.Deployment, error)
+
+// RevisionRollback remembers the last revision that reached full availability and returns to it when a newer
+// revision doesn't become available within the rollback window.
+//
+// The revisioned audit-N and encryption-config-N resources of the known-good revision are still around, only the
+// config configmap is not revisioned. That is why a snapshot of it is kept next to it, in config-known-good.
+type RevisionRollback struct {
+	deploymentLister appsv1listers.DeploymentLister
+	configMapLister  corev1listers.ConfigMapLister
+	configMapsGetter corev1client.ConfigMapsGetter
+	now              func() time.Time
+}
+
+// NewRevisionRollback returns a RevisionRollback for the deployment in the target namespace.
+func NewRevisionRollback(kubeInformersForTargetNamespace kubeinformers.SharedInformerFactory, configMapsGetter corev1client.ConfigMapsGetter) *RevisionRollback {
+	return &RevisionRollback{
+		deploymentLister: kubeInformersForTargetNamespace.Apps().V1().Deployments().Lister(),
+		configMapLister:  kubeInformersForTargetNamespace.Core().V1().ConfigMaps().Lister(),
+		configMapsGetter: configMapsGetter,
+		now:              time.Now,
+	}
+}
+
+// gate records the running deployment as known-good once it is fully available and replaces the required deployment
+// with the known-good one when the rollout of the required pod template takes longer than the rollback window.
+func (r *RevisionRollback) gate(ctx context.Context, config rolloutConfig, required *appsv1.Deployment, renderRevision renderRevisionFunc, recorder events.Recorder) (rolloutGateResult, error) {
+	result := rolloutGateResult{condition: operatorv1.OperatorCondition{Type: rollbackConditionType, Status: operatorv1.ConditionFalse, Reason: "AsExpected"}}
+	desiredHash := required.Annotations[templateHashAnnotation]
+
+	existing, err := r.deploymentLister.Deployments(required.Namespace).Get(required.Name)
+	if apierrors.IsNotFound(err) {
+		required.Annotations[rolloutStartedAnnotation] = r.now().UTC().Format(time.RFC3339)
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	knownGood, err := r.knownGood(required.Namespace)
+	if err != nil {
+		return result, err
+	}
+
+	// stay on the known-good revision until the pod template we rolled back from changes
+	if existing.Annotations[rolledBackFromAnnotation] == desiredHash && config.AutomaticRollback && knownGood != nil {
+		return r.rollback(ctx, config, existing, required, knownGood, renderRevision, recorder)
+	}
+	if _, ok := existing.Annotations[rolledBackFromAnnotation]; ok {
+		// a "-" suffix removes the annotation from the existing deployment
+		required.Annotations[rolledBackFromAnnotation+"-"] = ""
+	}
+
+	started := r.now()
+	if existing.Annotations[templateHashAnnotation] == desiredHash {
+		if t, err := time.Parse(time.RFC3339, existing.Annotations[rolloutStartedAnnotation]); err == nil {
+			started = t
+		}
+	}
+	required.Annotations[rolloutStartedAnnotation] = started.UTC().Format(time.RFC3339)
+
+	if existing.Annotations[templateHashAnnotation] == desiredHash && deploymentAvailable(existing) {
+		if knownGood == nil || knownGood.templateHash != desiredHash {
+			return result, r.recordKnownGood(ctx, existing, recorder)
+		}
+		return result, nil
+	}
+	if !config.AutomaticRollback || knownGood == nil || knownGood.templateHash == desiredHash {
+		return result, nil
+	}
+	// an upgrade is never rolled back to the images of the known-good revision
+	if knownGood.upgrade(required) {
+		result.condition.Message = fmt.Sprintf("pod template %s of revision %s runs other images than the known-good revision %d and is not rolled back", desiredHash, required.Labels["revision"], knownGood.revision)
+		return result, nil
+	}
+	if elapsed := r.now().Sub(started); elapsed < config.RollbackWindow.Duration {
+		result.requeueAfter = config.RollbackWindow.Duration - elapsed
+		return result, nil
+	}
+	return r.rollback(ctx, config, existing, required, knownGood, renderRevision, recorder)
+}
+
+// rollback replaces the required deployment with the deployment of the known-good revision.
+func (r *RevisionRollback) rollback(ctx context.Context, config rolloutConfig, existing, required *appsv1.Deployment, knownGood *knownGoodRevision, renderRevision renderRevisionFunc, recorder events.Recorder) (rolloutGateResult, error) {
+	result := rolloutGateResult{condition: operatorv1.OperatorCondition{Type: rollbackConditionType, Status: operatorv1.ConditionTrue}}
+	desiredHash := required.Annotations[templateHashAnnotation]
+	desiredRevision := required.Labels["revision"]
+
+	// the revisioned resources may have been pruned in the meantime
+	if _, err := r.configMapLister.ConfigMaps(required.Namespace).Get(fmt.Sprintf("audit-%d", knownGood.revision)); apierrors.IsNotFound(err) {
+		result.condition.Reason = "KnownGoodRevisionPruned"
+		result.condition.Message = fmt.Sprintf("pod template %s of revision %s did not become available within %v, but the known-good revision %d can't be restored: %v", desiredHash, desiredRevision, config.RollbackWindow.Duration, knownGood.revision, err)
+		return result, nil
+	} else if err != nil {
+		return result, err
+	}
+
+	previous, err := renderRevision(knownGood.revision)
+	if err != nil {
+		return result, fmt.Errorf("failed to render the known-good revision %d: %w", knownGood.revision, err)
+	}
+	for i, volume := range previous.Spec.Template.Spec.Volumes {
+		if volume.ConfigMap != nil && volume.ConfigMap.Name == "config" {
+			previous.Spec.Template.Spec.Volumes[i].ConfigMap.Name = KnownGoodConfigMapName
+		}
+	}
+	configKey := dependencyAnnotationPrefix + configHashKey(required.Namespace)
+	if hash, ok := knownGood.inputHashes[configKey]; ok {
+		previous.Annotations[configKey] = hash
+		previous.Spec.Template.Annotations[configKey] = hash
+	}
+	if err := stampTemplateHash(previous); err != nil {
+		return result, err
+	}
+	// the known-good template is trusted, it doesn't go through the canary again
+	previous.Annotations[canaryPassedAnnotation] = previous.Annotations[templateHashAnnotation]
+	previous.Annotations[rolledBackFromAnnotation] = desiredHash
+	previous.Annotations[rolloutStartedAnnotation] = existing.Annotations[rolloutStartedAnnotation]
+	*required = *previous
+
+	if existing.Annotations[rolledBackFromAnnotation] != desiredHash {
+		recorder.Warningf("RevisionRolledBack", "Pod template %s of revision %s did not become available within %v, rolled back to revision %d", desiredHash, desiredRevision, config.RollbackWindow.Duration, knownGood.revision)
+	}
+	result.condition.Reason = "RolledBack"
+	result.condition.Message = fmt.Sprintf("pod template %s of revision %s did not become available within %v, rolled back to revision %d", desiredHash, desiredRevision, config.RollbackWindow.Duration, knownGood.revision)
+	if changed := changedInputs(knownGood.inputHashes, existing.Annotations); len(changed) > 0 {
+		result.condition.Message += fmt.Sprintf(", inputs changed since: %s", strings.Join(changed, ", "))
+	}
+	return result, nil
+}
+
+// recordKnownGood snapshots the config configmap the available deployment was rolled out with, and reports how long
+// the rollout took.
+func (r *RevisionRollback) recordKnownGood(ctx context.Context, existing *appsv1.Deployment, recorder events.Recorder) error {
+	config, err := r.configMapLister.ConfigMaps(existing.Namespace).Get("config")
+	if err != nil {
+		return err
+	}
+	hashes, err := resourcehash.MultipleObjectHashStringMap(config)
+	if err != nil {
+		return err
+	}
+	for key, hash := range hashes {
+		if existing.Annotations[dependencyAnnotationPrefix+key] != hash {
+			// the config has moved on already, the next rollout will be recorded instead
+			return nil
+		}
+	}
+
+	inputHashes := map[string]string{}
+	for key, value := range existing.Annotations {
+		if strings.HasPrefix(key, dependencyAnnotationPrefix) {
+			inputHashes[key] = value
+		}
+	}
+	encodedInputHashes, err := json.Marshal(inputHashes)
+	if err != nil {
+		return err
+	}
+
+	annotations := map[string]string{
+		knownGoodRevisionAnnotation:     existing.Labels["revision"],
+		knownGoodTemplateHashAnnotation: existing.Annotations[templateHashAnnotation],
+		knownGoodInputHashesAnnotation:  string(encodedInputHashes),
+	}
+	for _, annotation := range pullSpecAnnotations {
+		annotations[annotation] = existing.Annotations[annotation]
+	}
+	_, _, err = resourceapply.ApplyConfigMap(ctx, r.configMapsGetter, recorder, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   existing.Namespace,
+			Name:        KnownGoodConfigMapName,
+			Annotations: annotations,
+		},
+		Data: config.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	// a rollout is known-good once, when it became available
+	revision, revisionErr := strconv.ParseInt(existing.Labels["revision"], 10, 32)
+	started, startedErr := time.Parse(time.RFC3339, existing.Annotations[rolloutStartedAnnotation])
+	if revisionErr == nil && startedErr == nil {
+		operatormetrics.ObserveRollout(int32(revision), r.now().Sub(started))
+	}
+	return nil
+}
+
+// knownGood returns the recorded known-good revision, or nil when there is none yet.
+func (r *RevisionRollback) knownGood(namespace string) (*knownGoodRevision, error) {
+	snapshot, err := r.configMapLister.ConfigMaps(namespace).Get(KnownGoodConfigMapName)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	revision, err := strconv.ParseInt(snapshot.Annotations[knownGoodRevisionAnnotation], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation on %s: %v", knownGoodRevisionAnnotation, KnownGoodConfigMapName, err)
+	}
+	inputHashes := map[string]string{}
+	if err := json.Unmarshal([]byte(snapshot.Annotations[knownGoodInputHashesAnnotation]), &inputHashes); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation on %s: %v", knownGoodInputHashesAnnotation, KnownGoodConfigMapName, err)
+	}
+	pullSpecs := map[string]string{}
+	for _, annotation := range pullSpecAnnotations {
+		pullSpecs[annotation] = snapshot.Annotations[annotation]
+	}
+	return &knownGoodRevision{
+		revision:     int32(revision),
+		templateHash: snapshot.Annotations[knownGoodTemplateHashAnnotation],
+		inputHashes:  inputHashes,
+		pullSpecs:    pullSpecs,
+	}, nil
+}
+
+// KnownGoodRevision returns the revision the config-known-good snapshot in the namespace was taken of, and false when
+// there is no snapshot. The revisioned resources of that revision are needed to roll back to it.
+func KnownGoodRevision(configMapLister corev1listers.ConfigMapLister, namespace string) (int32, bool, error) {
+	knownGood, err := (&RevisionRollback{configMapLister: configMapLister}).knownGood(namespace)
+	if err != nil || knownGood == nil {
+		return 0, false, err
+	}
+	return knownGood.revision, true, nil
+}
+
+// deploymentAvailable is true when every replica of the current generation is updated and available.
+func deploymentAvailable(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas &&
+		deployment.Status.Replicas == replicas
+}
+
+// changedInputs lists the inputs whose hash differs from the known-good one, without the annotation prefix.
+func changedInputs(knownGood map[string]string, annotations map[string]string) []string {
+	changed := []string{}
+	for key, hash := range knownGood {
+		if annotations[key] != hash && key != dependencyAnnotationPrefix+"desired.generation" {
+			changed = append(changed, strings.TrimPrefix(key, dependencyAnnotationPrefix))
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// configHashKey is the resourcehash key of the config configmap.
+func configHashKey(namespace string) string {
+	return fmt.Sprintf("%s.config.configmap", namespace)
+}
@@ -0,0 +1,272 @@
+package workload
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcehash"
+)
+
+func TestRevisionRollbackGate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	configKey := dependencyAnnotationPrefix + "openshift-apiserver.config.configmap"
+	pullSpecAnnotation := "openshiftapiservers.operator.openshift.io/pull-spec"
+	renderRevision := func(revision int32) (*appsv1.Deployment, error) {
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "openshift-apiserver",
+				Name:        "apiserver",
+				Labels:      map[string]string{"revision": strconv.Itoa(int(revision))},
+				Annotations: map[string]string{configKey: "new-config"},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: ptr.To[int32](3),
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels:      map[string]string{"revision": strconv.Itoa(int(revision))},
+						Annotations: map[string]string{configKey: "new-config"},
+					},
+					Spec: corev1.PodSpec{Volumes: []corev1.Volume{
+						{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "config"}}}},
+						{Name: "audit", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "audit-" + strconv.Itoa(int(revision))}}}},
+					}},
+				},
+			},
+		}
+		return deployment, stampTemplateHash(deployment)
+	}
+	newRequired := func() *appsv1.Deployment {
+		required, err := renderRevision(8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return required
+	}
+	desiredHash := newRequired().Annotations[templateHashAnnotation]
+
+	config := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "config"}, Data: map[string]string{"config.yaml": "current"}}
+	configHashes, err := resourcehash.MultipleObjectHashStringMap(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing := func(templateHash string, started time.Duration, available bool, extraAnnotations ...string) *appsv1.Deployment {
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:  "openshift-apiserver",
+				Name:       "apiserver",
+				Generation: 2,
+				Labels:     map[string]string{"revision": "8"},
+				Annotations: map[string]string{
+					templateHashAnnotation:   templateHash,
+					rolloutStartedAnnotation: now.Add(-started).Format(time.RFC3339),
+					configKey:                configHashes[configHashKey("openshift-apiserver")],
+				},
+			},
+			Spec:   appsv1.DeploymentSpec{Replicas: ptr.To[int32](3)},
+			Status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 2},
+		}
+		if available {
+			deployment.Status.UpdatedReplicas = 3
+			deployment.Status.AvailableReplicas = 3
+		}
+		for i := 0; i+1 < len(extraAnnotations); i += 2 {
+			deployment.Annotations[extraAnnotations[i]] = extraAnnotations[i+1]
+		}
+		return deployment
+	}
+	knownGood := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: KnownGoodConfigMapName, Annotations: map[string]string{
+			knownGoodRevisionAnnotation:     "7",
+			knownGoodTemplateHashAnnotation: "known-good",
+			knownGoodInputHashesAnnotation:  `{"` + configKey + `":"old-config"}`,
+		}},
+		Data: map[string]string{"config.yaml": "old"},
+	}
+	audit7 := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "audit-7"}}
+
+	tests := []struct {
+		name                string
+		config              rolloutConfig
+		objects             []runtime.Object
+		requiredPullSpec    string
+		expectRolledBack    bool
+		expectReason        string
+		expectMessagePart   string
+		expectRequeue       bool
+		expectRecorded      bool
+		expectStartedAt     time.Time
+		expectRemoveFromAnn bool
+	}{
+		{
+			name:            "initial rollout",
+			config:          rolloutConfig{AutomaticRollback: true, RollbackWindow: metav1.Duration{Duration: 10 * time.Minute}},
+			expectReason:    "AsExpected",
+			expectStartedAt: now,
+		},
+		{
+			name:            "available rollout is recorded as known-good",
+			config:          rolloutConfig{AutomaticRollback: true, RollbackWindow: metav1.Duration{Duration: 10 * time.Minute}},
+			objects:         []runtime.Object{existing(desiredHash, time.Minute, true, pullSpecAnnotation, "image"), config},
+			expectReason:    "AsExpected",
+			expectRecorded:  true,
+			expectStartedAt: now.Add(-time.Minute),
+		},
+		{
+			name:            "rollout within the window",
+			config:          rolloutConfig{AutomaticRollback: true, RollbackWindow: metav1.Duration{Duration: 10 * time.Minute}},
+			objects:         []runtime.Object{existing(desiredHash, time.Minute, false), knownGood, audit7},
+			expectReason:    "AsExpected",
+			expectRequeue:   true,
+			expectStartedAt: now.Add(-time.Minute),
+		},
+		{
+			name:              "rollout past the window",
+			config:            rolloutConfig{AutomaticRollback: true, RollbackWindow: metav1.Duration{Duration: 10 * time.Minute}},
+			objects:           []runtime.Object{existing(desiredHash, 11*time.Minute, false), knownGood, audit7},
+			expectRolledBack:  true,
+			expectReason:      "RolledBack",
+			expectMessagePart: "rolled back to revision 7, inputs changed since: openshift-apiserver.config.configmap",
+		},
+		{
+			name:             "stays rolled back",
+			config:           rolloutConfig{AutomaticRollback: true, RollbackWindow: metav1.Duration{Duration: 10 * time.Minute}},
+			objects:          []runtime.Object{existing("rolled-back", 30*time.Minute, true, rolledBackFromAnnotation, desiredHash), knownGood, audit7},
+			expectRolledBack: true,
+			expectReason:     "RolledBack",
+		},
+		{
+			name:                "new template after a rollback",
+			config:              rolloutConfig{AutomaticRollback: true, RollbackWindow: metav1.Duration{Duration: 10 * time.Minute}},
+			objects:             []runtime.Object{existing("rolled-back", 30*time.Minute, true, rolledBackFromAnnotation, "failed"), knownGood, audit7},
+			expectReason:        "AsExpected",
+			expectRequeue:       true,
+			expectStartedAt:     now,
+			expectRemoveFromAnn: true,
+		},
+		{
+			name:              "upgrade past the window",
+			config:            rolloutConfig{AutomaticRollback: true, RollbackWindow: metav1.Duration{Duration: 10 * time.Minute}},
+			objects:           []runtime.Object{existing(desiredHash, 11*time.Minute, false, pullSpecAnnotation, "new-image"), knownGood, audit7},
+			requiredPullSpec:  "new-image",
+			expectReason:      "AsExpected",
+			expectMessagePart: "runs other images than the known-good revision 7",
+			expectStartedAt:   now.Add(-11 * time.Minute),
+		},
+		{
+			name:            "automatic rollback not enabled",
+			config:          rolloutConfig{RollbackWindow: metav1.Duration{Duration: 10 * time.Minute}},
+			objects:         []runtime.Object{existing(desiredHash, 11*time.Minute, false), knownGood, audit7},
+			expectReason:    "AsExpected",
+			expectStartedAt: now.Add(-11 * time.Minute),
+		},
+		{
+			name:              "known-good revision pruned",
+			config:            rolloutConfig{AutomaticRollback: true, RollbackWindow: metav1.Duration{Duration: 10 * time.Minute}},
+			objects:           []runtime.Object{existing(desiredHash, 11*time.Minute, false), knownGood},
+			expectReason:      "KnownGoodRevisionPruned",
+			expectMessagePart: "known-good revision 7 can't be restored",
+			expectStartedAt:   now.Add(-11 * time.Minute),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			deploymentIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			configMapIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, obj := range tc.objects {
+				switch obj.(type) {
+				case *appsv1.Deployment:
+					deploymentIndexer.Add(obj)
+				case *corev1.ConfigMap:
+					configMapIndexer.Add(obj)
+				}
+			}
+			kubeClient := fake.NewSimpleClientset()
+			rollback := &RevisionRollback{
+				deploymentLister: appsv1listers.NewDeploymentLister(deploymentIndexer),
+				configMapLister:  corev1listers.NewConfigMapLister(configMapIndexer),
+				configMapsGetter: kubeClient.CoreV1(),
+				now:              func() time.Time { return now },
+			}
+
+			required := newRequired()
+			if len(tc.requiredPullSpec) > 0 {
+				required.Annotations[pullSpecAnnotation] = tc.requiredPullSpec
+			}
+			recorder := events.NewInMemoryRecorder("test", clocktesting.NewFakePassiveClock(now))
+			result, err := rollback.gate(context.TODO(), tc.config, required, renderRevision, recorder)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.expectRolledBack {
+				if required.Labels["revision"] != "7" {
+					t.Errorf("expected the known-good revision 7, got %q", required.Labels["revision"])
+				}
+				if name := required.Spec.Template.Spec.Volumes[0].ConfigMap.Name; name != KnownGoodConfigMapName {
+					t.Errorf("expected the config volume to use %s, got %q", KnownGoodConfigMapName, name)
+				}
+				if required.Annotations[configKey] != "old-config" || required.Spec.Template.Annotations[configKey] != "old-config" {
+					t.Errorf("expected the known-good config hash, got %q", required.Annotations[configKey])
+				}
+				if required.Annotations[rolledBackFromAnnotation] != desiredHash {
+					t.Errorf("expected rolled back from %q, got %q", desiredHash, required.Annotations[rolledBackFromAnnotation])
+				}
+				if hash := required.Annotations[templateHashAnnotation]; hash == desiredHash || required.Annotations[canaryPassedAnnotation] != hash {
+					t.Errorf("expected a new template hash that passed the canary, got %v", required.Annotations)
+				}
+			} else {
+				if required.Labels["revision"] != "8" || required.Annotations[templateHashAnnotation] != desiredHash {
+					t.Errorf("expected the required deployment to be kept, got %v", required.ObjectMeta)
+				}
+				if started := required.Annotations[rolloutStartedAnnotation]; started != tc.expectStartedAt.Format(time.RFC3339) {
+					t.Errorf("expected rollout started at %v, got %q", tc.expectStartedAt, started)
+				}
+			}
+			if _, ok := required.Annotations[rolledBackFromAnnotation+"-"]; ok != tc.expectRemoveFromAnn {
+				t.Errorf("expected removal of %s: %v", rolledBackFromAnnotation, tc.expectRemoveFromAnn)
+			}
+
+			if result.condition.Type != rollbackConditionType || result.condition.Reason != tc.expectReason {
+				t.Errorf("unexpected condition %#v", result.condition)
+			}
+			if (tc.expectReason == "AsExpected") != (result.condition.Status == operatorv1.ConditionFalse) {
+				t.Errorf("unexpected condition status %#v", result.condition)
+			}
+			if !strings.Contains(result.condition.Message, tc.expectMessagePart) {
+				t.Errorf("expected message to contain %q, got %q", tc.expectMessagePart, result.condition.Message)
+			}
+			if (result.requeueAfter > 0) != tc.expectRequeue {
+				t.Errorf("expected requeue=%v, got %v", tc.expectRequeue, result.requeueAfter)
+			}
+
+			recorded, err := kubeClient.CoreV1().ConfigMaps("openshift-apiserver").Get(context.TODO(), KnownGoodConfigMapName, metav1.GetOptions{})
+			if tc.expectRecorded {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if recorded.Data["config.yaml"] != "current" || recorded.Annotations[knownGoodRevisionAnnotation] != "8" || recorded.Annotations[knownGoodTemplateHashAnnotation] != desiredHash || recorded.Annotations[pullSpecAnnotation] != "image" {
+					t.Errorf("unexpected known-good record %v", recorded)
+				}
+			} else if err == nil {
+				t.Errorf("unexpected known-good record %v", recorded)
+			}
+		})
+	}
+}
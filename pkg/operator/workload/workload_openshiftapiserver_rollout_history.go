@@ -0,0 +1,231 @@
+package workload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcehash"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// RolloutHistoryConfigMapName is the configmap in the operator namespace listing the latest operand rollouts.
+	RolloutHistoryConfigMapName = "openshift-apiserver-rollout-history"
+	rolloutHistoryKey           = "history.json"
+	maxRolloutHistory           = 20
+
+	// inputKeysAnnotation holds the hash of every key of every deployment input, so that the next rollout can tell
+	// which keys changed.
+	inputKeysAnnotation = "openshiftapiservers.operator.openshift.io/input-keys"
+)
+
+// RolloutHistoryEntry describes a single rollout of the operand deployment.
+type RolloutHistoryEntry struct {
+	Time       metav1.Time `json:"time"`
+	Revision   string      `json:"revision"`
+	Generation int64       `json:"generation"`
+	Triggers   []string    `json:"triggers"`
+}
+
+// RolloutHistory tells what triggered a rollout of the operand deployment. It reports it in an event and keeps the
+// last rollouts in the RolloutHistoryConfigMapName configmap.
+type RolloutHistory struct {
+	deploymentLister appsv1listers.DeploymentLister
+	configMapLister  corev1listers.ConfigMapLister
+	secretLister     corev1listers.SecretLister
+	configMapsGetter corev1client.ConfigMapsGetter
+	now              func() time.Time
+}
+
+// NewRolloutHistory returns a RolloutHistory for the deployment in the target namespace.
+func NewRolloutHistory(kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces, configMapsGetter corev1client.ConfigMapsGetter) *RolloutHistory {
+	kubeInformersForTargetNamespace := kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace)
+	return &RolloutHistory{
+		deploymentLister: kubeInformersForTargetNamespace.Apps().V1().Deployments().Lister(),
+		configMapLister:  kubeInformersForTargetNamespace.Core().V1().ConfigMaps().Lister(),
+		secretLister:     kubeInformersForTargetNamespace.Core().V1().Secrets().Lister(),
+		configMapsGetter: configMapsGetter,
+		now:              time.Now,
+	}
+}
+
+// triggers stamps the key hashes of the deployment inputs on the required deployment and returns what makes its pod
+// template differ from the existing one. It returns nothing when the pod template is unchanged.
+func (h *RolloutHistory) triggers(required *appsv1.Deployment) ([]string, error) {
+	keyHashes, err := h.inputKeyHashes()
+	if err != nil {
+		return nil, err
+	}
+	encodedKeyHashes, err := json.Marshal(keyHashes)
+	if err != nil {
+		return nil, err
+	}
+	required.Annotations[inputKeysAnnotation] = string(encodedKeyHashes)
+
+	existing, err := h.deploymentLister.Deployments(required.Namespace).Get(required.Name)
+	if apierrors.IsNotFound(err) {
+		return []string{"initial rollout"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if existing.Annotations[templateHashAnnotation] == required.Annotations[templateHashAnnotation] {
+		return nil, nil
+	}
+
+	// deployments of older operators don't carry the key hashes, their changes are reported without keys
+	previousKeyHashes := map[string]map[string]string{}
+	_ = json.Unmarshal([]byte(existing.Annotations[inputKeysAnnotation]), &previousKeyHashes)
+
+	triggers := []string{}
+	for _, input := range DeploymentInputs() {
+		key := inputHashKey(input)
+		if existing.Annotations[dependencyAnnotationPrefix+key] == required.Annotations[dependencyAnnotationPrefix+key] {
+			continue
+		}
+		trigger := fmt.Sprintf("%s/%s", input.Resource.Resource, input.Name)
+		if keys := changedKeys(previousKeyHashes[key], keyHashes[key]); len(keys) > 0 {
+			trigger += fmt.Sprintf(" (keys: %s)", strings.Join(keys, ", "))
+		}
+		triggers = append(triggers, trigger)
+	}
+	if existing.Labels["revision"] != required.Labels["revision"] {
+		triggers = append(triggers, fmt.Sprintf("revision %s", required.Labels["revision"]))
+	}
+	for _, annotation := range pullSpecAnnotations {
+		if existing.Annotations[annotation] != required.Annotations[annotation] {
+			triggers = append(triggers, fmt.Sprintf("image %s", required.Annotations[annotation]))
+		}
+	}
+	generationKey := dependencyAnnotationPrefix + "desired.generation"
+	if existing.Annotations[generationKey] != required.Annotations[generationKey] {
+		triggers = append(triggers, fmt.Sprintf("operator config generation %s", required.Annotations[generationKey]))
+	}
+	if rolledBackFrom := required.Annotations[rolledBackFromAnnotation]; len(rolledBackFrom) > 0 && existing.Annotations[rolledBackFromAnnotation] != rolledBackFrom {
+		triggers = append(triggers, fmt.Sprintf("rollback of pod template %s", rolledBackFrom))
+	}
+	if len(triggers) == 0 {
+		triggers = append(triggers, "pod template")
+	}
+	return triggers, nil
+}
+
+// record emits an event for the rollout of the deployment and appends it to the rollout history.
+func (h *RolloutHistory) record(ctx context.Context, deployment *appsv1.Deployment, triggers []string, recorder events.Recorder) error {
+	recorder.Eventf("OperandRolloutTriggered", "Rolling out revision %s of %s, triggered by %s", deployment.Labels["revision"], deployment.Name, strings.Join(triggers, "; "))
+
+	history := []RolloutHistoryEntry{}
+	existing, err := h.configMapsGetter.ConfigMaps(operatorclient.OperatorNamespace).Get(ctx, RolloutHistoryConfigMapName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && len(existing.Data[rolloutHistoryKey]) > 0 {
+		if err := json.Unmarshal([]byte(existing.Data[rolloutHistoryKey]), &history); err != nil {
+			// start over rather than getting stuck on a history somebody broke
+			history = []RolloutHistoryEntry{}
+		}
+	}
+	history = append(history, RolloutHistoryEntry{
+		Time:       metav1.NewTime(h.now()),
+		Revision:   deployment.Labels["revision"],
+		Generation: deployment.Generation,
+		Triggers:   triggers,
+	})
+	if len(history) > maxRolloutHistory {
+		history = history[len(history)-maxRolloutHistory:]
+	}
+	encodedHistory, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, _, err = resourceapply.ApplyConfigMap(ctx, h.configMapsGetter, recorder, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.OperatorNamespace, Name: RolloutHistoryConfigMapName},
+		Data:       map[string]string{rolloutHistoryKey: string(encodedHistory)},
+	})
+	return err
+}
+
+// inputKeyHashes hashes every key of every deployment input, indexed the same way as the dependency annotations.
+func (h *RolloutHistory) inputKeyHashes() (map[string]map[string]string, error) {
+	ret := map[string]map[string]string{}
+	for _, input := range DeploymentInputs() {
+		keyHashes := map[string]string{}
+		switch input.Resource.Resource {
+		case "configmap", "configmaps":
+			configMap, err := h.configMapLister.ConfigMaps(input.Namespace).Get(input.Name)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range configMap.Data {
+				keyHashes[key] = hashValue([]byte(value))
+			}
+			for key, value := range configMap.BinaryData {
+				keyHashes[key] = hashValue(value)
+			}
+		case "secret", "secrets":
+			secret, err := h.secretLister.Secrets(input.Namespace).Get(input.Name)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range secret.Data {
+				keyHashes[key] = hashValue(value)
+			}
+		default:
+			return nil, fmt.Errorf("%v is not handled", input.Resource)
+		}
+		ret[inputHashKey(input)] = keyHashes
+	}
+	return ret, nil
+}
+
+// inputHashKey is the resourcehash key of the input, the dependency annotations are named after it.
+func inputHashKey(input *resourcehash.ObjectReference) string {
+	return fmt.Sprintf("%s.%s.%s", input.Namespace, input.Name, strings.TrimSuffix(input.Resource.Resource, "s"))
+}
+
+// changedKeys lists the keys that were added, removed or changed.
+func changedKeys(previous, current map[string]string) []string {
+	changed := []string{}
+	for key, hash := range current {
+		if previous[key] != hash {
+			changed = append(changed, key)
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func hashValue(value []byte) string {
+	hasher := fnv.New32()
+	hasher.Write(value)
+	return fmt.Sprintf("%x", hasher.Sum32())
+}
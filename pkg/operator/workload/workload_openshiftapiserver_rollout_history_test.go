@@ -0,0 +1,174 @@
+package workload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+)
+
+func TestRolloutHistoryTriggers(t *testing.T) {
+	configKey := dependencyAnnotationPrefix + "openshift-apiserver.config.configmap"
+	etcdClientKey := dependencyAnnotationPrefix + "openshift-apiserver.etcd-client.secret"
+	config := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "config"}, Data: map[string]string{"config.yaml": "new", "other": "same"}}
+	etcdClient := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "etcd-client"}, Data: map[string][]byte{"tls.crt": []byte("crt")}}
+
+	newRequired := func() *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "openshift-apiserver",
+			Name:      "apiserver",
+			Labels:    map[string]string{"revision": "3"},
+			Annotations: map[string]string{
+				templateHashAnnotation: "new",
+				configKey:              "new-config",
+				etcdClientKey:          "etcd-client",
+				"openshiftapiservers.operator.openshift.io/pull-spec": "new-image",
+			},
+		}}
+	}
+	existing := func(templateHash string, annotations ...string) *appsv1.Deployment {
+		deployment := newRequired()
+		deployment.Annotations[templateHashAnnotation] = templateHash
+		for i := 0; i+1 < len(annotations); i += 2 {
+			deployment.Annotations[annotations[i]] = annotations[i+1]
+		}
+		return deployment
+	}
+	previousKeyHashes := fmt.Sprintf(`{"openshift-apiserver.config.configmap":{"config.yaml":"old","other":%q,"removed":"x"}}`, hashValue([]byte("same")))
+
+	tests := []struct {
+		name           string
+		existing       *appsv1.Deployment
+		expectTriggers []string
+	}{
+		{
+			name:           "initial rollout",
+			expectTriggers: []string{"initial rollout"},
+		},
+		{
+			name:     "unchanged pod template",
+			existing: existing("new", configKey, "old-config"),
+		},
+		{
+			name:           "changed config keys",
+			existing:       existing("old", configKey, "old-config", inputKeysAnnotation, previousKeyHashes),
+			expectTriggers: []string{"configmaps/config (keys: config.yaml, removed)"},
+		},
+		{
+			name:           "changed input of an older operator",
+			existing:       existing("old", configKey, "old-config"),
+			expectTriggers: []string{"configmaps/config (keys: config.yaml, other)"},
+		},
+		{
+			name:           "new image",
+			existing:       existing("old", "openshiftapiservers.operator.openshift.io/pull-spec", "old-image"),
+			expectTriggers: []string{"image new-image"},
+		},
+		{
+			name:           "unknown change",
+			existing:       existing("old"),
+			expectTriggers: []string{"pod template"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			deploymentIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if tc.existing != nil {
+				deploymentIndexer.Add(tc.existing)
+			}
+			configMapIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			configMapIndexer.Add(config)
+			secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			secretIndexer.Add(etcdClient)
+			history := &RolloutHistory{
+				deploymentLister: appsv1listers.NewDeploymentLister(deploymentIndexer),
+				configMapLister:  corev1listers.NewConfigMapLister(configMapIndexer),
+				secretLister:     corev1listers.NewSecretLister(secretIndexer),
+			}
+
+			required := newRequired()
+			triggers, err := history.triggers(required)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(triggers, tc.expectTriggers) {
+				t.Errorf("expected triggers %q, got %q", tc.expectTriggers, triggers)
+			}
+
+			keyHashes := map[string]map[string]string{}
+			if err := json.Unmarshal([]byte(required.Annotations[inputKeysAnnotation]), &keyHashes); err != nil {
+				t.Fatal(err)
+			}
+			if keyHashes["openshift-apiserver.etcd-client.secret"]["tls.crt"] != hashValue([]byte("crt")) {
+				t.Errorf("expected the key hashes of etcd-client, got %v", keyHashes)
+			}
+		})
+	}
+}
+
+func TestRolloutHistoryRecord(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	previous := []RolloutHistoryEntry{}
+	for i := 0; i < maxRolloutHistory; i++ {
+		previous = append(previous, RolloutHistoryEntry{Revision: fmt.Sprintf("%d", i), Triggers: []string{"pod template"}})
+	}
+	encodedPrevious, err := json.Marshal(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver-operator", Name: RolloutHistoryConfigMapName},
+			Data:       map[string]string{rolloutHistoryKey: string(encodedPrevious)},
+		},
+	)
+	history := &RolloutHistory{configMapsGetter: kubeClient.CoreV1(), now: func() time.Time { return now }}
+	recorder := events.NewInMemoryRecorder("test", clocktesting.NewFakePassiveClock(now))
+
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "apiserver", Generation: 5, Labels: map[string]string{"revision": "21"}}}
+	if err := history.record(context.TODO(), deployment, []string{"secrets/etcd-client (keys: tls.crt)"}, recorder); err != nil {
+		t.Fatal(err)
+	}
+
+	configMap, err := kubeClient.CoreV1().ConfigMaps("openshift-apiserver-operator").Get(context.TODO(), RolloutHistoryConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := []RolloutHistoryEntry{}
+	if err := json.Unmarshal([]byte(configMap.Data[rolloutHistoryKey]), &recorded); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != maxRolloutHistory {
+		t.Fatalf("expected %d entries, got %d", maxRolloutHistory, len(recorded))
+	}
+	if recorded[0].Revision != "1" {
+		t.Errorf("expected the oldest entry to be dropped, got revision %q first", recorded[0].Revision)
+	}
+	last := recorded[len(recorded)-1]
+	if last.Revision != "21" || last.Generation != 5 || !last.Time.Time.Equal(now) || !reflect.DeepEqual(last.Triggers, []string{"secrets/etcd-client (keys: tls.crt)"}) {
+		t.Errorf("unexpected last entry %#v", last)
+	}
+
+	found := false
+	for _, event := range recorder.Events() {
+		if event.Reason == "OperandRolloutTriggered" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected an OperandRolloutTriggered event")
+	}
+}
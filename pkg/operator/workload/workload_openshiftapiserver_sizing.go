@@ -0,0 +1,300 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// SizingTiersConfigMapName is the configmap in the operator namespace replacing the default sizing tiers.
+	SizingTiersConfigMapName = "openshift-apiserver-sizing"
+	sizingTiersKey           = "tiers"
+
+	sizingConditionType = "ResourceSizing"
+	// sizingTierAnnotation records the tier the deployment was sized for.
+	sizingTierAnnotation = "openshiftapiservers.operator.openshift.io/sizing-tier"
+
+	// objectCountInterval is how often the sized objects are counted, counting lists every resource.
+	objectCountInterval = 10 * time.Minute
+	// downsizeMargin is the share of the bounds of a smaller tier the signals have to stay below to move down to it,
+	// so that a cluster at the edge of two tiers doesn't roll out on every count.
+	downsizeMargin = 0.8
+)
+
+// sizedResources are the resources whose number the load of openshift-apiserver grows with.
+var sizedResources = []schema.GroupVersionResource{
+	{Group: "image.openshift.io", Version: "v1", Resource: "imagestreams"},
+	{Group: "build.openshift.io", Version: "v1", Resource: "builds"},
+	{Group: "route.openshift.io", Version: "v1", Resource: "routes"},
+}
+
+// sizingTier sets the resource requests of the containers for clusters within its bounds.
+type sizingTier struct {
+	Name string `json:"name"`
+	// MaxNodes and MaxObjects bound the tier, zero means unbounded.
+	MaxNodes   int `json:"maxNodes"`
+	MaxObjects int `json:"maxObjects"`
+	// APIServer and CheckEndpoints are the requests of the openshift-apiserver and check-endpoints containers.
+	APIServer      corev1.ResourceList `json:"apiServer"`
+	CheckEndpoints corev1.ResourceList `json:"checkEndpoints"`
+}
+
+// defaultSizingTiers start with the requests of the deployment template, so that small clusters keep them.
+var defaultSizingTiers = []sizingTier{
+	{
+		Name: "small", MaxNodes: 25, MaxObjects: 5000,
+		APIServer:      resourceList("100m", "200Mi"),
+		CheckEndpoints: resourceList("10m", "50Mi"),
+	},
+	{
+		Name: "medium", MaxNodes: 100, MaxObjects: 25000,
+		APIServer:      resourceList("200m", "500Mi"),
+		CheckEndpoints: resourceList("10m", "50Mi"),
+	},
+	{
+		Name: "large", MaxNodes: 250, MaxObjects: 100000,
+		APIServer:      resourceList("400m", "1Gi"),
+		CheckEndpoints: resourceList("20m", "100Mi"),
+	},
+	{
+		Name:           "xlarge",
+		APIServer:      resourceList("800m", "2Gi"),
+		CheckEndpoints: resourceList("20m", "100Mi"),
+	},
+}
+
+// sizingSignals are the observations the tier is chosen from. The memory usage of the pods is left out on purpose: it
+// grows with the requests of the tier, so the tier would never come down again.
+type sizingSignals struct {
+	nodes   int
+	objects map[string]int
+}
+
+func (s sizingSignals) totalObjects() int {
+	total := 0
+	for _, count := range s.objects {
+		total += count
+	}
+	return total
+}
+
+func (s sizingSignals) String() string {
+	parts := []string{fmt.Sprintf("%d nodes", s.nodes)}
+	for _, gvr := range sizedResources {
+		parts = append(parts, fmt.Sprintf("%d %s", s.objects[gvr.Resource], gvr.Resource))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ResourceSizing chooses the resource requests of the openshift-apiserver pods from the size of the cluster.
+type ResourceSizing struct {
+	nodeLister              corev1listers.NodeLister
+	deploymentLister        appsv1listers.DeploymentLister
+	operatorConfigMapLister corev1listers.ConfigMapLister
+	dynamicClient           dynamic.Interface
+	now                     func() time.Time
+
+	lock      sync.Mutex
+	objects   map[string]int
+	countedAt time.Time
+}
+
+// NewResourceSizing returns a ResourceSizing counting the objects with the given client.
+func NewResourceSizing(kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces, dynamicClient dynamic.Interface) *ResourceSizing {
+	return &ResourceSizing{
+		nodeLister:              kubeInformersForNamespaces.InformersFor("").Core().V1().Nodes().Lister(),
+		deploymentLister:        kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace).Apps().V1().Deployments().Lister(),
+		operatorConfigMapLister: kubeInformersForNamespaces.InformersFor(operatorclient.OperatorNamespace).Core().V1().ConfigMaps().Lister(),
+		dynamicClient:           dynamicClient,
+		now:                     time.Now,
+	}
+}
+
+// tier returns the tier the deployment is sized for and the condition reporting it. When counting fails the last
+// counts are used and the error is returned along with the tier.
+func (r *ResourceSizing) tier(ctx context.Context) (*sizingTier, operatorv1.OperatorCondition, error) {
+	condition := operatorv1.OperatorCondition{Type: sizingConditionType, Status: operatorv1.ConditionTrue, Reason: "TierSelected"}
+
+	// invalid tiers must not shrink a big cluster down to the requests of the template
+	tiers, tiersErr := sizingTiersFor(r.operatorConfigMapLister)
+	if tiersErr != nil {
+		tiers = defaultSizingTiers
+	}
+
+	signals, countErr := r.signals(ctx)
+	current := ""
+	existing, err := r.deploymentLister.Deployments(operatorclient.TargetNamespace).Get("apiserver")
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, condition, err
+	}
+	if existing != nil {
+		current = existing.Annotations[sizingTierAnnotation]
+	}
+
+	tier := chooseSizingTier(tiers, signals, current)
+	condition.Message = fmt.Sprintf("sized for tier %q: %s", tier.Name, signals)
+	if countErr != nil {
+		condition.Message += fmt.Sprintf(" (counting failed: %v)", countErr)
+	}
+	if tiersErr != nil {
+		condition.Reason = "InvalidSizingTiers"
+		condition.Message += fmt.Sprintf(", using the default tiers: %v", tiersErr)
+	}
+	return tier, condition, utilerrors.NewAggregate([]error{tiersErr, countErr})
+}
+
+// chooseSizingTier returns the smallest tier the signals fit in. It moves down from the current tier only when the
+// signals fit in the smaller tier with the downsizeMargin.
+func chooseSizingTier(tiers []sizingTier, signals sizingSignals, current string) *sizingTier {
+	fitting := fittingTier(tiers, signals, 1)
+	for i := range tiers {
+		if tiers[i].Name != current || i <= fitting {
+			continue
+		}
+		// shrinking, but not below what fits with the margin
+		if withMargin := fittingTier(tiers, signals, downsizeMargin); withMargin < i {
+			return &tiers[withMargin]
+		}
+		return &tiers[i]
+	}
+	return &tiers[fitting]
+}
+
+// fittingTier returns the index of the first tier whose bounds, scaled by factor, hold the signals. The last tier holds
+// everything.
+func fittingTier(tiers []sizingTier, signals sizingSignals, factor float64) int {
+	for i, tier := range tiers {
+		if tier.MaxNodes > 0 && float64(signals.nodes) > float64(tier.MaxNodes)*factor {
+			continue
+		}
+		if tier.MaxObjects > 0 && float64(signals.totalObjects()) > float64(tier.MaxObjects)*factor {
+			continue
+		}
+		return i
+	}
+	return len(tiers) - 1
+}
+
+// signals returns the node count and the object counts, refreshed every objectCountInterval.
+func (r *ResourceSizing) signals(ctx context.Context) (sizingSignals, error) {
+	signals := sizingSignals{}
+	nodes, err := r.nodeLister.List(labels.Everything())
+	if err != nil {
+		return signals, err
+	}
+	signals.nodes = len(nodes)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var countErr error
+	if r.objects == nil || r.now().Sub(r.countedAt) >= objectCountInterval {
+		objects, err := r.countObjects(ctx)
+		if err != nil {
+			countErr = err
+		} else {
+			r.objects = objects
+		}
+		// don't retry on every sync when counting fails
+		r.countedAt = r.now()
+	}
+	signals.objects = r.objects
+	return signals, countErr
+}
+
+// countObjects counts the sizedResources with a single item list each, the remaining item count tells the rest.
+func (r *ResourceSizing) countObjects(ctx context.Context) (map[string]int, error) {
+	objects := map[string]int{}
+	for _, gvr := range sizedResources {
+		list, err := r.dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{Limit: 1})
+		if apierrors.IsNotFound(err) {
+			// the API is disabled, for instance by a capability
+			objects[gvr.Resource] = 0
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to count %s: %v", gvr.Resource, err)
+		}
+		count := len(list.Items)
+		if remaining := list.GetRemainingItemCount(); remaining != nil {
+			count += int(*remaining)
+		}
+		objects[gvr.Resource] = count
+	}
+	return objects, nil
+}
+
+// sizingTiersFor returns the tiers of SizingTiersConfigMapName, or the default ones.
+func sizingTiersFor(configMapLister corev1listers.ConfigMapLister) ([]sizingTier, error) {
+	configMap, err := configMapLister.ConfigMaps(operatorclient.OperatorNamespace).Get(SizingTiersConfigMapName)
+	if apierrors.IsNotFound(err) {
+		return defaultSizingTiers, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tiers := []sizingTier{}
+	if err := yaml.Unmarshal([]byte(configMap.Data[sizingTiersKey]), &tiers); err != nil {
+		return nil, fmt.Errorf("configmaps/%s[%s] key %q: %v", SizingTiersConfigMapName, operatorclient.OperatorNamespace, sizingTiersKey, err)
+	}
+	if len(tiers) == 0 {
+		return defaultSizingTiers, nil
+	}
+	for i, tier := range tiers {
+		if len(tier.Name) == 0 {
+			return nil, fmt.Errorf("sizing tier %d has no name", i)
+		}
+		if i > 0 && (tier.MaxNodes != 0 && tier.MaxNodes < tiers[i-1].MaxNodes || tier.MaxObjects != 0 && tier.MaxObjects < tiers[i-1].MaxObjects) {
+			return nil, fmt.Errorf("sizing tier %q has smaller bounds than tier %q before it", tier.Name, tiers[i-1].Name)
+		}
+	}
+	return tiers, nil
+}
+
+// applySizingTier sets the requests of the tier on the containers of the deployment.
+func applySizingTier(deployment *appsv1.Deployment, tier *sizingTier) {
+	if tier == nil {
+		return
+	}
+	deployment.Annotations[sizingTierAnnotation] = tier.Name
+	for name, requests := range map[string]corev1.ResourceList{apiServerContainerName: tier.APIServer, checkEndpointsContainerName: tier.CheckEndpoints} {
+		container := findContainer(deployment.Spec.Template.Spec.Containers, name)
+		if container == nil || len(requests) == 0 {
+			continue
+		}
+		if container.Resources.Requests == nil {
+			container.Resources.Requests = corev1.ResourceList{}
+		}
+		for resourceName, quantity := range requests {
+			container.Resources.Requests[resourceName] = quantity
+		}
+	}
+}
+
+func resourceList(cpu, memory string) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}
+}
@@ -0,0 +1,221 @@
+package workload
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestChooseSizingTier(t *testing.T) {
+	objects := func(imagestreams int) map[string]int { return map[string]int{"imagestreams": imagestreams} }
+	tests := []struct {
+		name       string
+		signals    sizingSignals
+		current    string
+		expectTier string
+	}{
+		{
+			name:       "small cluster",
+			signals:    sizingSignals{nodes: 6, objects: objects(100)},
+			expectTier: "small",
+		},
+		{
+			name:       "many nodes",
+			signals:    sizingSignals{nodes: 120, objects: objects(100)},
+			expectTier: "large",
+		},
+		{
+			name:       "many objects",
+			signals:    sizingSignals{nodes: 6, objects: objects(30000)},
+			expectTier: "large",
+		},
+		{
+			name:       "growing",
+			signals:    sizingSignals{nodes: 30, objects: objects(100)},
+			current:    "small",
+			expectTier: "medium",
+		},
+		{
+			name:       "shrinking within the margin",
+			signals:    sizingSignals{nodes: 22, objects: objects(100)},
+			current:    "medium",
+			expectTier: "medium",
+		},
+		{
+			name:       "shrinking below the margin",
+			signals:    sizingSignals{nodes: 15, objects: objects(100)},
+			current:    "large",
+			expectTier: "small",
+		},
+		{
+			name:       "beyond every bound",
+			signals:    sizingSignals{nodes: 1000, objects: objects(1000000)},
+			expectTier: "xlarge",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tier := chooseSizingTier(defaultSizingTiers, tc.signals, tc.current); tier.Name != tc.expectTier {
+				t.Errorf("expected tier %q, got %q", tc.expectTier, tier.Name)
+			}
+		})
+	}
+}
+
+func TestResourceSizingTier(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	imageStream := func(namespace, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("image.openshift.io/v1")
+		obj.SetKind("ImageStream")
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, gvr := range sizedResources {
+		listKinds[gvr] = "List"
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds,
+		imageStream("a", "one"), imageStream("b", "two"))
+
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, name := range []string{"master-0", "master-1", "master-2"} {
+		nodeIndexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	sizing := &ResourceSizing{
+		nodeLister:              corev1listers.NewNodeLister(nodeIndexer),
+		deploymentLister:        appsv1listers.NewDeploymentLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+		operatorConfigMapLister: corev1listers.NewConfigMapLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+		dynamicClient:           dynamicClient,
+		now:                     func() time.Time { return start },
+	}
+
+	tier, condition, err := sizing.tier(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tier.Name != "small" {
+		t.Errorf("expected the small tier, got %q", tier.Name)
+	}
+	if condition.Type != sizingConditionType || condition.Reason != "TierSelected" {
+		t.Errorf("unexpected condition %#v", condition)
+	}
+	if expected := `sized for tier "small": 3 nodes, 2 imagestreams, 0 builds, 0 routes`; condition.Message != expected {
+		t.Errorf("expected message %q, got %q", expected, condition.Message)
+	}
+
+	// the counts are cached
+	dynamicClient.Tracker().Add(imageStream("c", "three"))
+	if _, condition, _ = sizing.tier(context.Background()); !strings.Contains(condition.Message, "2 imagestreams") {
+		t.Errorf("expected the cached counts, got %q", condition.Message)
+	}
+	sizing.now = func() time.Time { return start.Add(objectCountInterval) }
+	if _, condition, _ = sizing.tier(context.Background()); !strings.Contains(condition.Message, "3 imagestreams") {
+		t.Errorf("expected the objects to be counted again, got %q", condition.Message)
+	}
+}
+
+// TestResourceSizingTierShrinks makes sure that a deployment sized for a big cluster comes down once the cluster
+// shrinks.
+func TestResourceSizingTierShrinks(t *testing.T) {
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, gvr := range sizedResources {
+		listKinds[gvr] = "List"
+	}
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, name := range []string{"master-0", "master-1", "master-2"} {
+		nodeIndexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	deploymentIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	deploymentIndexer.Add(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "openshift-apiserver",
+		Name:        "apiserver",
+		Annotations: map[string]string{sizingTierAnnotation: "large"},
+	}})
+	sizing := &ResourceSizing{
+		nodeLister:              corev1listers.NewNodeLister(nodeIndexer),
+		deploymentLister:        appsv1listers.NewDeploymentLister(deploymentIndexer),
+		operatorConfigMapLister: corev1listers.NewConfigMapLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+		dynamicClient:           dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds),
+		now:                     time.Now,
+	}
+
+	tier, _, err := sizing.tier(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tier.Name != "small" {
+		t.Errorf("expected the shrunk cluster to move down to the small tier, got %q", tier.Name)
+	}
+}
+
+func TestSizingTiersFor(t *testing.T) {
+	withTiers := func(tiers string) corev1listers.ConfigMapLister {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		if len(tiers) > 0 {
+			indexer.Add(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver-operator", Name: SizingTiersConfigMapName},
+				Data:       map[string]string{sizingTiersKey: tiers},
+			})
+		}
+		return corev1listers.NewConfigMapLister(indexer)
+	}
+
+	tiers, err := sizingTiersFor(withTiers(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tiers) != len(defaultSizingTiers) {
+		t.Errorf("expected the default tiers without the configmap, got %#v", tiers)
+	}
+
+	tiers, err = sizingTiersFor(withTiers(`[{"name": "tiny", "maxNodes": 3, "apiServer": {"memory": "100Mi"}}, {"name": "rest", "apiServer": {"memory": "1Gi"}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tiers) != 2 || tiers[0].Name != "tiny" || tiers[1].APIServer.Memory().String() != "1Gi" {
+		t.Errorf("unexpected tiers %#v", tiers)
+	}
+
+	if _, err := sizingTiersFor(withTiers(`[{"name": "big", "maxNodes": 100}, {"name": "small", "maxNodes": 10}]`)); err == nil {
+		t.Errorf("expected tiers with shrinking bounds to be rejected")
+	}
+	if _, err := sizingTiersFor(withTiers(`{"name": "tiny"}`)); err == nil {
+		t.Errorf("expected tiers that are not a list to be rejected")
+	}
+}
+
+func TestApplySizingTier(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: apiServerContainerName, Resources: corev1.ResourceRequirements{Requests: resourceList("100m", "200Mi")}},
+			{Name: checkEndpointsContainerName},
+		}}}},
+	}
+	applySizingTier(deployment, &defaultSizingTiers[2])
+
+	if deployment.Annotations[sizingTierAnnotation] != "large" {
+		t.Errorf("expected the tier to be recorded, got %v", deployment.Annotations)
+	}
+	containers := deployment.Spec.Template.Spec.Containers
+	if memory := containers[0].Resources.Requests.Memory().String(); memory != "1Gi" {
+		t.Errorf("unexpected openshift-apiserver memory request %s", memory)
+	}
+	if cpu := containers[1].Resources.Requests.Cpu().String(); cpu != "20m" {
+		t.Errorf("unexpected check-endpoints cpu request %s", cpu)
+	}
+}
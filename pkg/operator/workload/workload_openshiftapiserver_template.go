@@ -0,0 +1,263 @@
+package workload
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/v311_00_assets"
+)
+
+const (
+	// DeploymentOverlaysConfigMapName is the configmap in the operator namespace holding strategic merge patches of the
+	// deployment.
+	DeploymentOverlaysConfigMapName = "openshift-apiserver-deployment-overlays"
+	deploymentOverlaysKey           = "overlays"
+
+	deploymentTemplateAsset = "v3.11.0/openshift-apiserver/deploy.yaml"
+
+	apiServerContainerName      = "openshift-apiserver"
+	checkEndpointsContainerName = "openshift-apiserver-check-endpoints"
+	checkEndpointsPort          = 17698
+)
+
+// RevisionedVolumes are the volumes of the deployment template whose configmap or secret is copied for every revision.
+// The template refers to the unrevisioned name, the render pipeline appends the revision.
+var RevisionedVolumes = sets.NewString("audit", "encryption-config")
+
+// requiredVolumes are the volumes the operator relies on being part of the deployment.
+var requiredVolumes = []string{"config", "audit", "etcd-client", "etcd-serving-ca", "serving-cert", "encryption-config"}
+
+var (
+	templateScheme = runtime.NewScheme()
+	templateCodecs = serializer.NewCodecFactory(templateScheme)
+)
+
+func init() {
+	if err := appsv1.AddToScheme(templateScheme); err != nil {
+		panic(err)
+	}
+}
+
+// deploymentTemplateInputs are the values the deployment template is rendered with.
+type deploymentTemplateInputs struct {
+	// Image runs the openshift-apiserver container and its init containers.
+	Image string
+	// CheckEndpointsImage runs the check-endpoints container.
+	CheckEndpointsImage string
+	Revision            int32
+	// Verbosity is the klog verbosity of openshift-apiserver.
+	Verbosity string
+	// CheckEndpointsBindIP is the address check-endpoints listens on.
+	CheckEndpointsBindIP string
+	// Overlays are strategic merge patches applied in order to the rendered deployment, before it is validated.
+	Overlays []runtime.RawExtension
+}
+
+// ReadDeploymentTemplate returns the deployment template as it is, without any inputs applied.
+func ReadDeploymentTemplate() (*appsv1.Deployment, error) {
+	raw, err := v311_00_assets.Asset(deploymentTemplateAsset)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := runtime.Decode(templateCodecs.UniversalDecoder(appsv1.SchemeGroupVersion), raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", deploymentTemplateAsset, err)
+	}
+	deployment, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return nil, fmt.Errorf("%s is a %T, not a deployment", deploymentTemplateAsset, obj)
+	}
+	return deployment, nil
+}
+
+// renderDeploymentTemplate builds the deployment from the template and the given inputs, applies the overlays and
+// validates the result. The errors are step errors of the template step.
+func renderDeploymentTemplate(inputs deploymentTemplateInputs) (*appsv1.Deployment, error) {
+	deployment, err := ReadDeploymentTemplate()
+	if err != nil {
+		return nil, newStepError(templateConditionType, "InvalidTemplate", err)
+	}
+
+	if err := applyTemplateInputs(deployment, inputs); err != nil {
+		return nil, newStepError(templateConditionType, "InvalidTemplateReference", err)
+	}
+	for i, overlay := range inputs.Overlays {
+		if deployment, err = applyOverlay(deployment, overlay.Raw); err != nil {
+			return nil, newStepError(templateConditionType, "InvalidOverlay", fmt.Errorf("overlay %d: %v", i, err))
+		}
+	}
+	if err := validateDeployment(deployment); err != nil {
+		return nil, newStepError(templateConditionType, "InvalidDeployment", err)
+	}
+	return deployment, nil
+}
+
+// applyTemplateInputs sets the inputs on the containers and volumes of the template they belong to.
+func applyTemplateInputs(deployment *appsv1.Deployment, inputs deploymentTemplateInputs) error {
+	podSpec := &deployment.Spec.Template.Spec
+
+	apiServer := findContainer(podSpec.Containers, apiServerContainerName)
+	if apiServer == nil {
+		return fmt.Errorf("missing container %q", apiServerContainerName)
+	}
+	apiServer.Image = inputs.Image
+	verbosity := findEnvVar(apiServer.Env, "VERBOSITY")
+	if verbosity == nil {
+		return fmt.Errorf("missing VERBOSITY environment variable of container %q", apiServerContainerName)
+	}
+	verbosity.Value = inputs.Verbosity
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].Image = inputs.Image
+	}
+
+	checkEndpoints := findContainer(podSpec.Containers, checkEndpointsContainerName)
+	if checkEndpoints == nil {
+		return fmt.Errorf("missing container %q", checkEndpointsContainerName)
+	}
+	checkEndpoints.Image = inputs.CheckEndpointsImage
+	listen := -1
+	for i, arg := range checkEndpoints.Args {
+		if arg == "--listen" && i+1 < len(checkEndpoints.Args) {
+			listen = i + 1
+		}
+	}
+	if listen < 0 {
+		return fmt.Errorf("missing --listen argument of container %q", checkEndpointsContainerName)
+	}
+	checkEndpoints.Args[listen] = fmt.Sprintf("%s:%d", inputs.CheckEndpointsBindIP, checkEndpointsPort)
+
+	for _, name := range RevisionedVolumes.List() {
+		volume := findVolume(podSpec.Volumes, name)
+		if volume == nil {
+			return fmt.Errorf("missing volume %q", name)
+		}
+		suffix := "-" + strconv.Itoa(int(inputs.Revision))
+		switch {
+		case volume.ConfigMap != nil:
+			volume.ConfigMap.Name += suffix
+		case volume.Secret != nil:
+			volume.Secret.SecretName += suffix
+		default:
+			return fmt.Errorf("volume %q is neither a configmap nor a secret", name)
+		}
+	}
+	return nil
+}
+
+// applyOverlay applies a strategic merge patch, in YAML or JSON, to the deployment.
+func applyOverlay(deployment *appsv1.Deployment, overlay []byte) (*appsv1.Deployment, error) {
+	patch, err := yaml.YAMLToJSON(overlay)
+	if err != nil {
+		return nil, err
+	}
+	original, err := json.Marshal(deployment)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := strategicpatch.StrategicMergePatch(original, patch, appsv1.Deployment{})
+	if err != nil {
+		return nil, err
+	}
+	ret := &appsv1.Deployment{}
+	if err := json.Unmarshal(patched, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// validateDeployment checks that the required volumes exist, that every volume mount has a volume and that every
+// container has an image.
+func validateDeployment(deployment *appsv1.Deployment) error {
+	podSpec := deployment.Spec.Template.Spec
+	errs := []error{}
+
+	volumes := sets.NewString()
+	for _, volume := range podSpec.Volumes {
+		volumes.Insert(volume.Name)
+	}
+	for _, name := range requiredVolumes {
+		if !volumes.Has(name) {
+			errs = append(errs, fmt.Errorf("missing required volume %q", name))
+		}
+	}
+
+	for _, container := range append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...) {
+		if len(container.Image) == 0 {
+			errs = append(errs, fmt.Errorf("container %q has no image", container.Name))
+		}
+		for _, mount := range container.VolumeMounts {
+			if !volumes.Has(mount.Name) {
+				errs = append(errs, fmt.Errorf("container %q mounts missing volume %q", container.Name, mount.Name))
+			}
+		}
+	}
+
+	if deployment.Spec.Selector == nil {
+		errs = append(errs, fmt.Errorf("missing selector"))
+	} else if selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector); err != nil {
+		errs = append(errs, fmt.Errorf("invalid selector: %v", err))
+	} else if !selector.Matches(labels.Set(deployment.Spec.Template.Labels)) {
+		errs = append(errs, fmt.Errorf("selector does not match the pod template labels"))
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// deploymentOverlaysFor returns the strategic merge patches of the deployment in DeploymentOverlaysConfigMapName.
+func deploymentOverlaysFor(configMapLister corev1listers.ConfigMapLister) ([]runtime.RawExtension, error) {
+	configMap, err := configMapLister.ConfigMaps(operatorclient.OperatorNamespace).Get(DeploymentOverlaysConfigMapName)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	overlays := []runtime.RawExtension{}
+	if err := yaml.Unmarshal([]byte(configMap.Data[deploymentOverlaysKey]), &overlays); err != nil {
+		return nil, fmt.Errorf("configmaps/%s[%s] key %q: %v", DeploymentOverlaysConfigMapName, operatorclient.OperatorNamespace, deploymentOverlaysKey, err)
+	}
+	return overlays, nil
+}
+
+func findContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func findVolume(volumes []corev1.Volume, name string) *corev1.Volume {
+	for i := range volumes {
+		if volumes[i].Name == name {
+			return &volumes[i]
+		}
+	}
+	return nil
+}
+
+func findEnvVar(env []corev1.EnvVar, name string) *corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == name {
+			return &env[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package workload
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestRenderDeploymentTemplate(t *testing.T) {
+	inputs := func(overlays ...string) deploymentTemplateInputs {
+		ret := deploymentTemplateInputs{
+			Image:                "openshift-apiserver-image",
+			CheckEndpointsImage:  "check-endpoints-image",
+			Revision:             3,
+			Verbosity:            "4",
+			CheckEndpointsBindIP: "::",
+		}
+		for _, overlay := range overlays {
+			ret.Overlays = append(ret.Overlays, runtime.RawExtension{Raw: []byte(overlay)})
+		}
+		return ret
+	}
+
+	t.Run("inputs", func(t *testing.T) {
+		deployment, err := renderDeploymentTemplate(inputs())
+		if err != nil {
+			t.Fatal(err)
+		}
+		podSpec := deployment.Spec.Template.Spec
+		if image := findContainer(podSpec.Containers, apiServerContainerName).Image; image != "openshift-apiserver-image" {
+			t.Errorf("unexpected openshift-apiserver image %q", image)
+		}
+		if image := podSpec.InitContainers[0].Image; image != "openshift-apiserver-image" {
+			t.Errorf("unexpected init container image %q", image)
+		}
+		if verbosity := findEnvVar(findContainer(podSpec.Containers, apiServerContainerName).Env, "VERBOSITY"); verbosity.Value != "4" {
+			t.Errorf("unexpected verbosity %q", verbosity.Value)
+		}
+		checkEndpoints := findContainer(podSpec.Containers, checkEndpointsContainerName)
+		if checkEndpoints.Image != "check-endpoints-image" {
+			t.Errorf("unexpected check-endpoints image %q", checkEndpoints.Image)
+		}
+		if checkEndpoints.Args[1] != ":::17698" {
+			t.Errorf("unexpected check-endpoints listen address %q", checkEndpoints.Args[1])
+		}
+		if name := findVolume(podSpec.Volumes, "audit").ConfigMap.Name; name != "audit-3" {
+			t.Errorf("unexpected audit configmap %q", name)
+		}
+		if name := findVolume(podSpec.Volumes, "encryption-config").Secret.SecretName; name != "encryption-config-3" {
+			t.Errorf("unexpected encryption config secret %q", name)
+		}
+	})
+
+	t.Run("overlay", func(t *testing.T) {
+		deployment, err := renderDeploymentTemplate(inputs(`
+spec:
+  template:
+    spec:
+      containers:
+      - name: openshift-apiserver
+        resources:
+          requests:
+            cpu: 200m
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		apiServer := findContainer(deployment.Spec.Template.Spec.Containers, apiServerContainerName)
+		if cpu := apiServer.Resources.Requests.Cpu().String(); cpu != "200m" {
+			t.Errorf("expected the overlay to set the cpu request, got %s", cpu)
+		}
+		if apiServer.Image != "openshift-apiserver-image" || len(deployment.Spec.Template.Spec.Containers) != 2 {
+			t.Errorf("expected the overlay to merge into the containers")
+		}
+	})
+
+	tests := []struct {
+		name         string
+		inputs       deploymentTemplateInputs
+		expectReason string
+		expectError  string
+	}{
+		{
+			name:         "missing image",
+			inputs:       func() deploymentTemplateInputs { i := inputs(); i.CheckEndpointsImage = ""; return i }(),
+			expectReason: "InvalidDeployment",
+			expectError:  `container "openshift-apiserver-check-endpoints" has no image`,
+		},
+		{
+			name: "overlay removing a required volume",
+			inputs: inputs(`
+spec:
+  template:
+    spec:
+      volumes:
+      - name: etcd-client
+        $patch: delete
+`),
+			expectReason: "InvalidDeployment",
+			expectError:  `missing required volume "etcd-client"`,
+		},
+		{
+			name: "overlay mounting a missing volume",
+			inputs: inputs(`
+spec:
+  template:
+    spec:
+      containers:
+      - name: openshift-apiserver
+        volumeMounts:
+        - name: extra
+          mountPath: /extra
+`),
+			expectReason: "InvalidDeployment",
+			expectError:  `container "openshift-apiserver" mounts missing volume "extra"`,
+		},
+		{
+			name:         "malformed overlay",
+			inputs:       inputs(`spec: [`),
+			expectReason: "InvalidOverlay",
+			expectError:  "overlay 0",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := renderDeploymentTemplate(tc.inputs)
+			var failed *stepError
+			if !errors.As(err, &failed) {
+				t.Fatalf("expected a step error, got %v", err)
+			}
+			if failed.conditionType != templateConditionType || failed.reason != tc.expectReason {
+				t.Errorf("unexpected step error %s/%s", failed.conditionType, failed.reason)
+			}
+			if !strings.Contains(err.Error(), tc.expectError) {
+				t.Errorf("expected error to contain %q, got %q", tc.expectError, err.Error())
+			}
+		})
+	}
+}
+
+func TestDeploymentOverlaysFor(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           map[string]string
+		expectOverlays []string
+		expectErr      bool
+	}{
+		{
+			name: "no configmap",
+		},
+		{
+			name:           "overlays",
+			data:           map[string]string{deploymentOverlaysKey: "- spec:\n    replicas: 5\n"},
+			expectOverlays: []string{`{"spec":{"replicas":5}}`},
+		},
+		{
+			name:      "invalid overlays",
+			data:      map[string]string{deploymentOverlaysKey: "spec: {}"},
+			expectErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tc.data != nil {
+				if err := indexer.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver-operator", Name: DeploymentOverlaysConfigMapName}, Data: tc.data}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			overlays, err := deploymentOverlaysFor(corev1listers.NewConfigMapLister(indexer))
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error=%v, got %v", tc.expectErr, err)
+			}
+			raw := []string{}
+			for _, overlay := range overlays {
+				raw = append(raw, string(overlay.Raw))
+			}
+			if len(raw) != len(tc.expectOverlays) || strings.Join(raw, ",") != strings.Join(tc.expectOverlays, ",") {
+				t.Errorf("expected overlays %v, got %v", tc.expectOverlays, raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package workload
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	configlisterv1 "github.com/openshift/client-go/config/listers/config/v1"
+)
+
+// ArbiterNodeLabel marks the arbiter nodes of a HighlyAvailableArbiter control plane. They run etcd only.
+const ArbiterNodeLabel = "node-role.kubernetes.io/arbiter"
+
+// controlPlaneTopologyFunc returns the control-plane topology of the cluster.
+type controlPlaneTopologyFunc func() (configv1.TopologyMode, error)
+
+// NewControlPlaneTopologyFunc returns the control-plane topology from the status of the cluster infrastructure. A
+// missing infrastructure resource is treated as a highly available control plane.
+func NewControlPlaneTopologyFunc(infrastructureLister configlisterv1.InfrastructureLister) controlPlaneTopologyFunc {
+	return func() (configv1.TopologyMode, error) {
+		infrastructure, err := infrastructureLister.Get("cluster")
+		if apierrors.IsNotFound(err) {
+			return configv1.HighlyAvailableTopologyMode, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(infrastructure.Status.ControlPlaneTopology) == 0 {
+			return configv1.HighlyAvailableTopologyMode, nil
+		}
+		return infrastructure.Status.ControlPlaneTopology, nil
+	}
+}
+
+// CountControlPlaneNodesFunc counts the nodes matching the node selector the way CountNodesFuncWrapper does, without
+// the arbiter nodes, which never run openshift-apiserver.
+func CountControlPlaneNodesFunc(nodeLister corev1listers.NodeLister) nodeCountFunc {
+	return func(nodeSelector map[string]string) (*int32, error) {
+		nodes, err := nodeLister.List(labels.SelectorFromSet(nodeSelector))
+		if err != nil {
+			return nil, err
+		}
+		replicas := int32(0)
+		for _, node := range nodes {
+			if _, arbiter := node.Labels[ArbiterNodeLabel]; !arbiter {
+				replicas++
+			}
+		}
+		return &replicas, nil
+	}
+}
+
+// topologyProfile holds the settings of the operand that differ between control-plane topologies. Zero values keep
+// the defaults of the templates.
+type topologyProfile struct {
+	// shutdownDelay replaces the shutdown-delay-duration of the default config.
+	shutdownDelay string
+	// readinessFailureThreshold and livenessFailureThreshold replace the thresholds of the openshift-apiserver probes.
+	readinessFailureThreshold int32
+	livenessFailureThreshold  int32
+	// avoidArbiters keeps the pods off the arbiter nodes.
+	avoidArbiters bool
+}
+
+// With two openshift-apiserver pods every rollout and every node reboot leaves a single pod serving. The profiles of
+// those topologies take a pod out of the endpoints sooner, so that its shutdown delay can be shorter while still
+// leaving the SDN 15s to converge, and they are slower to restart the pod left serving when it is busy.
+var topologyProfiles = map[configv1.TopologyMode]topologyProfile{
+	configv1.DualReplicaTopologyMode: {
+		shutdownDelay:             "30s",
+		readinessFailureThreshold: 2,
+		livenessFailureThreshold:  6,
+	},
+	configv1.HighlyAvailableArbiterMode: {
+		shutdownDelay:             "30s",
+		readinessFailureThreshold: 2,
+		livenessFailureThreshold:  6,
+		avoidArbiters:             true,
+	},
+}
+
+// topologyConfig returns the config overlaying the default config for the topology, or nil when there is none.
+func topologyConfig(topology configv1.TopologyMode) []byte {
+	profile := topologyProfiles[topology]
+	if len(profile.shutdownDelay) == 0 {
+		return nil
+	}
+	return []byte(fmt.Sprintf(`{"apiServerArguments": {"shutdown-delay-duration": [%q]}}`, profile.shutdownDelay))
+}
+
+// applyTopology adjusts the deployment to the topology.
+func applyTopology(spec *appsv1.DeploymentSpec, topology configv1.TopologyMode) {
+	profile := topologyProfiles[topology]
+	podSpec := &spec.Template.Spec
+
+	if apiServer := findContainer(podSpec.Containers, apiServerContainerName); apiServer != nil {
+		if profile.readinessFailureThreshold > 0 && apiServer.ReadinessProbe != nil {
+			apiServer.ReadinessProbe.FailureThreshold = profile.readinessFailureThreshold
+		}
+		if profile.livenessFailureThreshold > 0 && apiServer.LivenessProbe != nil {
+			apiServer.LivenessProbe.FailureThreshold = profile.livenessFailureThreshold
+		}
+	}
+
+	if profile.avoidArbiters {
+		if podSpec.Affinity == nil {
+			podSpec.Affinity = &corev1.Affinity{}
+		}
+		if podSpec.Affinity.NodeAffinity == nil {
+			podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+		}
+		nodeAffinity := podSpec.Affinity.NodeAffinity
+		if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+			nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+		}
+		required := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		notArbiter := corev1.NodeSelectorRequirement{Key: ArbiterNodeLabel, Operator: corev1.NodeSelectorOpDoesNotExist}
+		if len(required.NodeSelectorTerms) == 0 {
+			required.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+		}
+		// the terms are ORed, every one of them has to exclude the arbiters
+		for i := range required.NodeSelectorTerms {
+			required.NodeSelectorTerms[i].MatchExpressions = append(required.NodeSelectorTerms[i].MatchExpressions, notArbiter)
+		}
+	}
+}
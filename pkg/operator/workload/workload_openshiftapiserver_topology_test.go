@@ -0,0 +1,106 @@
+package workload
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	configv1 "github.com/openshift/api/config/v1"
+	configlisterv1 "github.com/openshift/client-go/config/listers/config/v1"
+)
+
+func TestCountControlPlaneNodesFunc(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for name, labels := range map[string]map[string]string{
+		"master-0":  {"node-role.kubernetes.io/master": ""},
+		"master-1":  {"node-role.kubernetes.io/master": ""},
+		"arbiter-0": {"node-role.kubernetes.io/master": "", ArbiterNodeLabel: ""},
+		"worker-0":  {"node-role.kubernetes.io/worker": ""},
+	} {
+		indexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}})
+	}
+
+	count, err := CountControlPlaneNodesFunc(corev1listers.NewNodeLister(indexer))(map[string]string{"node-role.kubernetes.io/master": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *count != 2 {
+		t.Errorf("expected 2 replicas, got %d", *count)
+	}
+}
+
+func TestControlPlaneTopologyFunc(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	topology := NewControlPlaneTopologyFunc(configlisterv1.NewInfrastructureLister(indexer))
+
+	if mode, err := topology(); err != nil || mode != configv1.HighlyAvailableTopologyMode {
+		t.Errorf("expected a missing infrastructure to be highly available, got %q, %v", mode, err)
+	}
+	indexer.Add(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+		Status:     configv1.InfrastructureStatus{ControlPlaneTopology: configv1.DualReplicaTopologyMode},
+	})
+	if mode, err := topology(); err != nil || mode != configv1.DualReplicaTopologyMode {
+		t.Errorf("expected DualReplica, got %q, %v", mode, err)
+	}
+}
+
+func TestApplyTopology(t *testing.T) {
+	newSpec := func() *appsv1.DeploymentSpec {
+		return &appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:           apiServerContainerName,
+				ReadinessProbe: &corev1.Probe{FailureThreshold: 3},
+				LivenessProbe:  &corev1.Probe{FailureThreshold: 3},
+			}},
+		}}}
+	}
+
+	t.Run("highly available", func(t *testing.T) {
+		spec := newSpec()
+		applyTopology(spec, configv1.HighlyAvailableTopologyMode)
+		if spec.Template.Spec.Containers[0].ReadinessProbe.FailureThreshold != 3 || spec.Template.Spec.Affinity != nil {
+			t.Errorf("expected the template to be left alone")
+		}
+		if config := topologyConfig(configv1.HighlyAvailableTopologyMode); config != nil {
+			t.Errorf("expected no topology config, got %s", config)
+		}
+	})
+
+	t.Run("dual replica", func(t *testing.T) {
+		spec := newSpec()
+		applyTopology(spec, configv1.DualReplicaTopologyMode)
+		apiServer := spec.Template.Spec.Containers[0]
+		if apiServer.ReadinessProbe.FailureThreshold != 2 || apiServer.LivenessProbe.FailureThreshold != 6 {
+			t.Errorf("unexpected probes %v, %v", apiServer.ReadinessProbe, apiServer.LivenessProbe)
+		}
+		if spec.Template.Spec.Affinity != nil {
+			t.Errorf("expected no node affinity without arbiters")
+		}
+		if config := string(topologyConfig(configv1.DualReplicaTopologyMode)); !strings.Contains(config, `"shutdown-delay-duration": ["30s"]`) {
+			t.Errorf("unexpected topology config %s", config)
+		}
+	})
+
+	t.Run("arbiter", func(t *testing.T) {
+		spec := newSpec()
+		spec.Template.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+				{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "a", Operator: corev1.NodeSelectorOpExists}}},
+				{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "b", Operator: corev1.NodeSelectorOpExists}}},
+			}},
+		}}
+		applyTopology(spec, configv1.HighlyAvailableArbiterMode)
+		for i, term := range spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			last := term.MatchExpressions[len(term.MatchExpressions)-1]
+			if len(term.MatchExpressions) != 2 || last.Key != ArbiterNodeLabel || last.Operator != corev1.NodeSelectorOpDoesNotExist {
+				t.Errorf("expected term %d to exclude the arbiters, got %v", i, term.MatchExpressions)
+			}
+		}
+	})
+}
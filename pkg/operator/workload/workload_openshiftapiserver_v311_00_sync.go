@@ -6,16 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"regexp"
 	"sort"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/ghodss/yaml"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -24,16 +22,16 @@ import (
 	"k8s.io/client-go/kubernetes"
 	appsclientv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
 	coreclientv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
 
 	openshiftapi "github.com/openshift/api"
-	"github.com/openshift/api/annotations"
 	configv1 "github.com/openshift/api/config/v1"
 	openshiftcontrolplanev1 "github.com/openshift/api/openshiftcontrolplane/v1"
 	operatorv1 "github.com/openshift/api/operator/v1"
-	openshiftconfigclientv1 "github.com/openshift/client-go/config/clientset/versioned/typed/config/v1"
 	configlisterv1 "github.com/openshift/client-go/config/listers/config/v1"
 	operatorv1client "github.com/openshift/client-go/operator/clientset/versioned/typed/operator/v1"
+	operatormetrics "github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/metrics"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/v311_00_assets"
 	"github.com/openshift/library-go/pkg/controller/factory"
@@ -48,10 +46,6 @@ import (
 	"github.com/openshift/library-go/pkg/operator/v1helpers"
 )
 
-const (
-	imageImportCAName = "image-import-ca"
-)
-
 // nodeCountFunction a function to return count of nodes
 type nodeCountFunc func(nodeSelector map[string]string) (*int32, error)
 
@@ -61,11 +55,10 @@ type ensureAtMostOnePodPerNodeFunc func(spec *appsv1.DeploymentSpec, component s
 
 // OpenShiftAPIServerWorkload is a struct that holds necessary data to install OpenShiftAPIServer
 type OpenShiftAPIServerWorkload struct {
-	operatorClient        v1helpers.OperatorClient
-	operatorConfigClient  operatorv1client.OpenShiftAPIServersGetter
-	openshiftConfigClient openshiftconfigclientv1.ConfigV1Interface
-	clusterVersionLister  configlisterv1.ClusterVersionLister
-	kubeClient            kubernetes.Interface
+	operatorClient       v1helpers.OperatorClient
+	operatorConfigClient operatorv1client.OpenShiftAPIServersGetter
+	clusterVersionLister configlisterv1.ClusterVersionLister
+	kubeClient           kubernetes.Interface
 
 	// countNodes a function to return count of nodes on which the workload will be installed
 	countNodes nodeCountFunc
@@ -80,13 +73,36 @@ type OpenShiftAPIServerWorkload struct {
 
 	featureGateAccessor featuregates.FeatureGateAccess
 	versionRecorder     status.VersionGetter
+
+	// operatorConfigMapLister lists the configmaps in the operator namespace holding the rollout settings and the
+	// deployment overlays.
+	operatorConfigMapLister corev1listers.ConfigMapLister
+
+	// canaryRollout gates the rollout of new pod templates when the canary is enabled, it is optional.
+	canaryRollout *CanaryRollout
+	// revisionRollback returns to the last known-good revision when a rollout doesn't complete, it is optional.
+	revisionRollback *RevisionRollback
+	// revisionPin renders a revision pinned on the operator config instead of the latest one, it is optional.
+	revisionPin *RevisionPin
+	// rolloutHistory reports what triggered each rollout, it is optional.
+	rolloutHistory *RolloutHistory
+	// rolloutCoalescer holds back bursts of pod template changes, it is optional.
+	rolloutCoalescer *RolloutCoalescer
+	// maintenanceWindows defers rollouts until a maintenance window opens, it is optional.
+	maintenanceWindows *MaintenanceWindows
+	// zoneSpread spreads the pods and their rollout across zones, it is optional.
+	zoneSpread *ZoneSpread
+	// controlPlaneTopology selects the topology profile of the operand, without it the cluster is treated as highly
+	// available.
+	controlPlaneTopology controlPlaneTopologyFunc
+	// resourceSizing scales the resource requests with the cluster, without it the requests of the template are used.
+	resourceSizing *ResourceSizing
 }
 
 // NewOpenShiftAPIServerWorkload creates new OpenShiftAPIServerWorkload struct
 func NewOpenShiftAPIServerWorkload(
 	operatorClient v1helpers.OperatorClient,
 	operatorConfigClient operatorv1client.OpenShiftAPIServersGetter,
-	openshiftConfigClient openshiftconfigclientv1.ConfigV1Interface,
 	clusterVersionLister configlisterv1.ClusterVersionLister,
 	countNodes nodeCountFunc,
 	ensureAtMostOnePodPerNode ensureAtMostOnePodPerNodeFunc,
@@ -96,11 +112,20 @@ func NewOpenShiftAPIServerWorkload(
 	kubeClient kubernetes.Interface,
 	featureGateAccessor featuregates.FeatureGateAccess,
 	versionRecorder status.VersionGetter,
+	operatorConfigMapLister corev1listers.ConfigMapLister,
+	canaryRollout *CanaryRollout,
+	revisionRollback *RevisionRollback,
+	revisionPin *RevisionPin,
+	rolloutHistory *RolloutHistory,
+	rolloutCoalescer *RolloutCoalescer,
+	maintenanceWindows *MaintenanceWindows,
+	zoneSpread *ZoneSpread,
+	controlPlaneTopology controlPlaneTopologyFunc,
+	resourceSizing *ResourceSizing,
 ) *OpenShiftAPIServerWorkload {
 	return &OpenShiftAPIServerWorkload{
 		operatorClient:            operatorClient,
 		operatorConfigClient:      operatorConfigClient,
-		openshiftConfigClient:     openshiftConfigClient,
 		clusterVersionLister:      clusterVersionLister,
 		countNodes:                countNodes,
 		ensureAtMostOnePodPerNode: ensureAtMostOnePodPerNode,
@@ -110,7 +135,25 @@ func NewOpenShiftAPIServerWorkload(
 		kubeClient:                kubeClient,
 		featureGateAccessor:       featureGateAccessor,
 		versionRecorder:           versionRecorder,
+		operatorConfigMapLister:   operatorConfigMapLister,
+		canaryRollout:             canaryRollout,
+		revisionRollback:          revisionRollback,
+		revisionPin:               revisionPin,
+		rolloutHistory:            rolloutHistory,
+		rolloutCoalescer:          rolloutCoalescer,
+		maintenanceWindows:        maintenanceWindows,
+		zoneSpread:                zoneSpread,
+		controlPlaneTopology:      controlPlaneTopology,
+		resourceSizing:            resourceSizing,
+	}
+}
+
+// zones returns the zonesFunc of the zoneSpread, or nil when the pods are not spread across zones.
+func (c *OpenShiftAPIServerWorkload) zones() zonesFunc {
+	if c.zoneSpread == nil {
+		return nil
 	}
+	return c.zoneSpread.zones
 }
 
 // WorkloadDeleted indicates whether the delegate workload has been deleted or not. It returns a bool
@@ -167,32 +210,181 @@ func (c *OpenShiftAPIServerWorkload) Sync(ctx context.Context, syncContext facto
 	}
 	operatorConfig := originalOperatorConfig.DeepCopy()
 
-	_, _, err = manageOpenShiftAPIServerConfigMap_v311_00_to_latest(ctx, c.kubeClient.CoreV1(), c.clusterVersionLister, syncContext.Recorder(), operatorConfig)
-	if err != nil {
+	// a pinned revision is rendered as if it were the latest one
+	pinned := false
+	if c.revisionPin != nil {
+		var revision int32
+		var conditions []operatorv1.OperatorCondition
+		revision, pinned, conditions = c.revisionPin.revision(operatorConfig, c.targetNamespace)
+		operatorConfig.Status.LatestAvailableRevision = revision
+		updates := []v1helpers.UpdateStatusFunc{}
+		for _, condition := range conditions {
+			updates = append(updates, v1helpers.UpdateConditionFn(condition))
+		}
+		handleErrorForOperatorStatus(v1helpers.UpdateStatus(ctx, c.operatorClient, updates...))
+	}
+
+	topology := configv1.HighlyAvailableTopologyMode
+	if c.controlPlaneTopology != nil {
+		if topology, err = c.controlPlaneTopology(); err != nil {
+			errors = append(errors, fmt.Errorf("failed to determine the control plane topology: %v", err))
+			return nil, false, errors
+		}
+	}
+
+	started := time.Now()
+	_, _, err = manageOpenShiftAPIServerConfigMap_v311_00_to_latest(ctx, c.kubeClient.CoreV1(), c.clusterVersionLister, syncContext.Recorder(), operatorConfig, topology)
+	operatormetrics.ObserveSyncStep("configmap", started, err)
+	// the failure of a step is reported by the condition of the step only
+	if err != nil && !isStepError(err) {
 		errors = append(errors, fmt.Errorf("%q: %v", "configmap", err))
 	}
+	stepConditionUpdates := stepConditions([]string{configMapConditionType}, err)
 
-	_, _, err = manageOpenShiftAPIServerImageImportCA_v311_00_to_latest(ctx, c.openshiftConfigClient, c.kubeClient.CoreV1(), syncContext.Recorder())
-	if err != nil {
-		errors = append(errors, fmt.Errorf("%q: %v", "image-import-ca", err))
+	var tier *sizingTier
+	if c.resourceSizing != nil {
+		var condition operatorv1.OperatorCondition
+		started := time.Now()
+		tier, condition, err = c.resourceSizing.tier(ctx)
+		operatormetrics.ObserveSyncStep("sizing", started, err)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%q: %v", "sizing", err))
+		}
+		// the tier is kept when counting fails, it is only missing when the existing deployment is unknown
+		if tier != nil {
+			stepConditionUpdates = append(stepConditionUpdates, condition)
+		}
+	}
+
+	renderInput := deploymentRenderInput{
+		countNodes:                c.countNodes,
+		zones:                     c.zones(),
+		topology:                  topology,
+		tier:                      tier,
+		imagePullSpec:             c.targetImagePullSpec,
+		operatorImagePullSpec:     c.operatorImagePullSpec,
+		operatorConfig:            operatorConfig,
+		ensureAtMostOnePodPerNode: c.ensureAtMostOnePodPerNode,
+		featureGateAccessor:       c.featureGateAccessor,
+		operatorConfigMapLister:   c.operatorConfigMapLister,
+	}
+	var rolloutGate rolloutGateFunc
+	var gateResults []rolloutGateResult
+	var rolloutTriggers []string
+	if c.maintenanceWindows != nil || c.rolloutCoalescer != nil || c.revisionRollback != nil || c.canaryRollout != nil || c.rolloutHistory != nil {
+		config, err := rolloutConfigFor(c.operatorConfigMapLister)
+		if err != nil {
+			errors = append(errors, err)
+		} else {
+			rolloutGate = func(ctx context.Context, required *appsv1.Deployment) error {
+				// nothing to gate while a change waits for a maintenance window or a burst of changes is held back
+				if c.maintenanceWindows != nil {
+					result, held, err := c.maintenanceWindows.gate(required)
+					if err != nil {
+						return err
+					}
+					gateResults = append(gateResults, result)
+					if held {
+						return nil
+					}
+				}
+				if c.rolloutCoalescer != nil {
+					result, held, err := c.rolloutCoalescer.gate(config, required)
+					if err != nil {
+						return err
+					}
+					if held {
+						gateResults = append(gateResults, result)
+						return nil
+					}
+				}
+				// then the rollback, a rolled back template is not held back by the canary and a pinned one is not
+				// rolled back
+				if c.revisionRollback != nil && !pinned {
+					renderRevision := func(revision int32) (*appsv1.Deployment, error) {
+						previousInput := renderInput
+						previousInput.operatorConfig = operatorConfig.DeepCopy()
+						previousInput.operatorConfig.Status.LatestAvailableRevision = revision
+						return renderOpenShiftAPIServerDeployment_v311_00_to_latest(ctx, c.kubeClient, previousInput)
+					}
+					result, err := c.revisionRollback.gate(ctx, config, required, renderRevision, syncContext.Recorder())
+					if err != nil {
+						return err
+					}
+					gateResults = append(gateResults, result)
+				}
+				if c.canaryRollout != nil {
+					result, err := c.canaryRollout.gate(ctx, config, required, syncContext.Recorder())
+					if err != nil {
+						return err
+					}
+					gateResults = append(gateResults, result)
+				}
+				// what is left is what gets rolled out
+				if c.rolloutHistory != nil {
+					var err error
+					if rolloutTriggers, err = c.rolloutHistory.triggers(required); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		}
 	}
 
 	// our configmaps and secrets are in order, now it is time to create the deployment
 	// TODO check basic preconditions here
+	started = time.Now()
 	actualDeployment, _, err := manageOpenShiftAPIServerDeployment_v311_00_to_latest(
 		ctx,
 		c.kubeClient,
 		c.kubeClient.AppsV1(),
-		c.countNodes,
 		syncContext.Recorder(),
-		c.targetImagePullSpec,
-		c.operatorImagePullSpec,
-		operatorConfig,
+		renderInput,
 		operatorConfig.Status.Generations,
-		c.ensureAtMostOnePodPerNode,
-		c.featureGateAccessor)
+		rolloutGate)
+	operatormetrics.ObserveSyncStep("deployments", started, err)
+	stepConditionUpdates = append(stepConditionUpdates, stepConditions(deploymentSteps, err)...)
+	if len(stepConditionUpdates) > 0 {
+		updates := []v1helpers.UpdateStatusFunc{}
+		for _, condition := range stepConditionUpdates {
+			updates = append(updates, v1helpers.UpdateConditionFn(condition))
+		}
+		handleErrorForOperatorStatus(v1helpers.UpdateStatus(ctx, c.operatorClient, updates...))
+	}
 	if err != nil {
-		errors = append(errors, fmt.Errorf("%q: %v", "deployments", err))
+		if !isStepError(err) {
+			errors = append(errors, fmt.Errorf("%q: %v", "deployments", err))
+		}
+	} else if len(rolloutTriggers) > 0 {
+		started := time.Now()
+		err := c.rolloutHistory.record(ctx, actualDeployment, rolloutTriggers, syncContext.Recorder())
+		operatormetrics.ObserveSyncStep("rollout-history", started, err)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%q: %v", "rollout-history", err))
+		}
+	}
+	if err == nil && c.zoneSpread != nil {
+		started := time.Now()
+		err := c.zoneSpread.order(ctx, actualDeployment, syncContext.Recorder())
+		operatormetrics.ObserveSyncStep("zone-spread", started, err)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%q: %v", "zone-spread", err))
+		}
+		if condition, err := c.zoneSpread.skewCondition(actualDeployment); err != nil {
+			errors = append(errors, fmt.Errorf("%q: %v", "zone-spread", err))
+		} else {
+			handleErrorForOperatorStatus(v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(condition)))
+		}
+	}
+
+	for _, result := range gateResults {
+		if len(result.condition.Type) > 0 {
+			handleErrorForOperatorStatus(v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(result.condition)))
+		}
+		if result.requeueAfter > 0 {
+			syncContext.Queue().AddAfter(syncContext.QueueKey(), result.requeueAfter)
+		}
 	}
 
 	if operatorConfig.ObjectMeta.Generation != operatorConfig.Status.ObservedGeneration {
@@ -227,83 +419,13 @@ func (c *OpenShiftAPIServerWorkload) Sync(ctx context.Context, syncContext facto
 	return actualDeployment, operatorConfig.Status.ObservedGeneration == operatorConfig.ObjectMeta.Generation, errors
 }
 
-// mergeImageRegistryCertificates merges two distinct ConfigMap, both containing
-// trusted CAs for Image Registries. The first one is the default CA bundle for
-// OpenShift internal registry access, the latter is a custom config map that may
-// be configured by the user on image.config.openshift.io/cluster.
-func mergeImageRegistryCertificates(ctx context.Context, cfgCli openshiftconfigclientv1.ConfigV1Interface, cli coreclientv1.CoreV1Interface) (map[string]string, error) {
-	cas := make(map[string]string)
-
-	internalRegistryCAs, err := cli.ConfigMaps("openshift-config-managed").Get(
-		ctx, "merged-trusted-image-registry-ca", metav1.GetOptions{},
-	)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return nil, err
-	} else if err == nil {
-		for key, value := range internalRegistryCAs.Data {
-			cas[key] = value
-		}
-	}
-
-	imageConfig, err := cfgCli.Images().Get(
-		ctx, "cluster", metav1.GetOptions{},
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	// No custom config map, return.
-	if len(imageConfig.Spec.AdditionalTrustedCA.Name) == 0 {
-		return cas, nil
-	}
-
-	additionalImageRegistryCAs, err := cli.ConfigMaps(
-		operatorclient.GlobalUserSpecifiedConfigNamespace,
-	).Get(
-		ctx,
-		imageConfig.Spec.AdditionalTrustedCA.Name,
-		metav1.GetOptions{},
-	)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return nil, err
-	} else if err == nil {
-		for key, value := range additionalImageRegistryCAs.Data {
-			cas[key] = value
-		}
-	}
-	return cas, nil
-}
-
-// manageOpenShiftAPIServerImageImportCA_v311_00_to_latest synchronizes image import ca-bundle. Returns the modified
-// ca-bundle ConfigMap.
-func manageOpenShiftAPIServerImageImportCA_v311_00_to_latest(ctx context.Context, openshiftConfigClient openshiftconfigclientv1.ConfigV1Interface, client coreclientv1.CoreV1Interface, recorder events.Recorder) (*corev1.ConfigMap, bool, error) {
-	mergedCAs, err := mergeImageRegistryCertificates(ctx, openshiftConfigClient, client)
-	if err != nil {
-		return nil, false, err
-	}
-	requiredConfigMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: operatorclient.TargetNamespace,
-			Name:      imageImportCAName,
-			Annotations: map[string]string{
-				annotations.OpenShiftComponent: "openshift-apiserver",
-			},
-		},
-		Data: mergedCAs,
-	}
-
-	// this can leave configmaps mounted without any content, but that should not have an impact on functionality since empty and missing
-	// should logically be treated the same in the case of trust.
-	return resourceapply.ApplyConfigMap(ctx, client, recorder, requiredConfigMap)
-}
-
-func manageOpenShiftAPIServerConfigMap_v311_00_to_latest(ctx context.Context, client coreclientv1.ConfigMapsGetter, clusterVersionLister configlisterv1.ClusterVersionLister, recorder events.Recorder, operatorConfig *operatorv1.OpenShiftAPIServer) (*corev1.ConfigMap, bool, error) {
+func manageOpenShiftAPIServerConfigMap_v311_00_to_latest(ctx context.Context, client coreclientv1.ConfigMapsGetter, clusterVersionLister configlisterv1.ClusterVersionLister, recorder events.Recorder, operatorConfig *operatorv1.OpenShiftAPIServer, topology configv1.TopologyMode) (*corev1.ConfigMap, bool, error) {
 	configMap := resourceread.ReadConfigMapV1OrDie(v311_00_assets.MustAsset("v3.11.0/openshift-apiserver/cm.yaml"))
 	defaultConfig := v311_00_assets.MustAsset("v3.11.0/config/defaultconfig.yaml")
 
 	clusterVersion, err := clusterVersionLister.Get("version")
 	if err != nil {
-		return nil, false, err
+		return nil, false, newStepError(configMapConditionType, "ClusterVersionUnavailable", err)
 	}
 
 	knownCaps := sets.New[configv1.ClusterVersionCapability](clusterVersion.Status.Capabilities.KnownCapabilities...)
@@ -325,12 +447,12 @@ func manageOpenShiftAPIServerConfigMap_v311_00_to_latest(ctx context.Context, cl
 
 	bytes, err := json.Marshal(apiServers)
 	if err != nil {
-		return nil, false, fmt.Errorf("unable to marshal APIServers struct: %v", err)
+		return nil, false, newStepError(configMapConditionType, "ConfigMapMergeFailed", fmt.Errorf("unable to marshal APIServers struct: %v", err))
 	}
 
 	configYaml, err := yaml.JSONToYAML([]byte(fmt.Sprintf("{\"apiVersion\": \"openshiftcontrolplane.config.openshift.io/v1\", \"kind\": \"OpenShiftAPIServerConfig\", \"apiServers\": %v}\n", string(bytes))))
 	if err != nil {
-		return nil, false, fmt.Errorf("unable to marshal OpenShiftAPIServerConfig struct: %v", err)
+		return nil, false, newStepError(configMapConditionType, "ConfigMapMergeFailed", fmt.Errorf("unable to marshal OpenShiftAPIServerConfig struct: %v", err))
 	}
 
 	requiredConfigMap, _, err := resourcemerge.MergePrunedConfigMap(
@@ -339,15 +461,20 @@ func manageOpenShiftAPIServerConfigMap_v311_00_to_latest(ctx context.Context, cl
 		"config.yaml",
 		nil,
 		defaultConfig,
+		topologyConfig(topology),
 		configYaml,
 		operatorConfig.Spec.ObservedConfig.Raw,
 		operatorConfig.Spec.UnsupportedConfigOverrides.Raw,
 	)
 	if err != nil {
-		return nil, false, err
+		return nil, false, newStepError(configMapConditionType, "ConfigMapMergeFailed", err)
 	}
 
-	return resourceapply.ApplyConfigMap(ctx, client, recorder, requiredConfigMap)
+	configMap, modified, err := resourceapply.ApplyConfigMap(ctx, client, recorder, requiredConfigMap)
+	if err != nil {
+		return nil, false, newStepError(configMapConditionType, "ConfigMapApplyFailed", err)
+	}
+	return configMap, modified, nil
 }
 
 func loglevelToKlog(logLevel operatorv1.LogLevel) string {
@@ -380,47 +507,80 @@ func checkEndpointsBindIPFromConfig(config map[string]any) (string, error) {
 	return "0.0.0.0", nil
 }
 
+// deploymentRenderInput is what the deployment is rendered from, both by the workload sync and by the offline render.
+type deploymentRenderInput struct {
+	countNodes nodeCountFunc
+	// zones is optional, without it the pods are not spread across zones
+	zones    zonesFunc
+	topology configv1.TopologyMode
+	// tier is optional, without it the requests of the deployment template are kept
+	tier                      *sizingTier
+	imagePullSpec             string
+	operatorImagePullSpec     string
+	operatorConfig            *operatorv1.OpenShiftAPIServer
+	ensureAtMostOnePodPerNode ensureAtMostOnePodPerNodeFunc
+	featureGateAccessor       featuregates.FeatureGateAccess
+	// operatorConfigMapLister is optional, without it no deployment overlays are applied
+	operatorConfigMapLister corev1listers.ConfigMapLister
+}
+
 func manageOpenShiftAPIServerDeployment_v311_00_to_latest(
 	ctx context.Context,
 	kubeClient kubernetes.Interface,
 	client appsclientv1.DeploymentsGetter,
-	countNodes nodeCountFunc,
 	recorder events.Recorder,
-	imagePullSpec string,
-	operatorImagePullSpec string,
-	operatorConfig *operatorv1.OpenShiftAPIServer,
+	input deploymentRenderInput,
 	generationStatus []operatorv1.GenerationStatus,
-	ensureAtMostOnePodPerNodeFn ensureAtMostOnePodPerNodeFunc,
-	featureGateAccessor featuregates.FeatureGateAccess,
+	rolloutGate rolloutGateFunc,
 ) (*appsv1.Deployment, bool, error) {
-	tmpl := v311_00_assets.MustAsset("v3.11.0/openshift-apiserver/deploy.yaml")
+	required, err := renderOpenShiftAPIServerDeployment_v311_00_to_latest(ctx, kubeClient, input)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if rolloutGate != nil {
+		if err := rolloutGate(ctx, required); err != nil {
+			return nil, false, fmt.Errorf("failed to gate the rollout: %w", err)
+		}
+	}
+	// ApplyDeployment only writes the spec when the metadata changed, so pausing and resuming has to show up there.
+	required.Annotations[pausedAnnotation] = strconv.FormatBool(required.Spec.Paused)
+
+	return resourceapply.ApplyDeployment(ctx, client, recorder, required, resourcemerge.ExpectedDeploymentGeneration(required, generationStatus))
+}
 
+// renderOpenShiftAPIServerDeployment_v311_00_to_latest renders the deployment of the given operator config revision
+// and stamps it with the hash of its pod template.
+func renderOpenShiftAPIServerDeployment_v311_00_to_latest(ctx context.Context, kubeClient kubernetes.Interface, input deploymentRenderInput) (*appsv1.Deployment, error) {
+	operatorConfig, imagePullSpec, operatorImagePullSpec := input.operatorConfig, input.imagePullSpec, input.operatorImagePullSpec
 	var observedConfig map[string]interface{}
 	if err := yaml.Unmarshal(operatorConfig.Spec.ObservedConfig.Raw, &observedConfig); err != nil {
-		return nil, false, fmt.Errorf("failed to unmarshal the observedConfig: %v", err)
+		return nil, newStepError(templateConditionType, "InvalidObservedConfig", fmt.Errorf("failed to unmarshal the observedConfig: %v", err))
 	}
 
 	checkEndpointsBindIP, err := checkEndpointsBindIPFromConfig(observedConfig)
 	if err != nil {
-		return nil, false, err
+		return nil, newStepError(templateConditionType, "InvalidObservedConfig", err)
 	}
 
-	r := strings.NewReplacer(
-		"${IMAGE}", imagePullSpec,
-		"${OPERATOR_IMAGE}", operatorImagePullSpec,
-		"${REVISION}", strconv.Itoa(int(operatorConfig.Status.LatestAvailableRevision)),
-		"${VERBOSITY}", loglevelToKlog(operatorConfig.Spec.LogLevel),
-		"${KUBE_APISERVER_OPERATOR_IMAGE}", os.Getenv("KUBE_APISERVER_OPERATOR_IMAGE"),
-		"${CHECK_ENDPOINTS_BIND_IP}", checkEndpointsBindIP,
-	)
-	tmpl = []byte(r.Replace(string(tmpl)))
-
-	re := regexp.MustCompile("\\$\\{[^}]*}")
-	if match := re.Find(tmpl); len(match) > 0 {
-		return nil, false, fmt.Errorf("invalid template reference %q", string(match))
+	var overlays []runtime.RawExtension
+	if input.operatorConfigMapLister != nil {
+		if overlays, err = deploymentOverlaysFor(input.operatorConfigMapLister); err != nil {
+			return nil, newStepError(templateConditionType, "InvalidOverlay", err)
+		}
 	}
 
-	required := resourceread.ReadDeploymentV1OrDie(tmpl)
+	required, err := renderDeploymentTemplate(deploymentTemplateInputs{
+		Image:                imagePullSpec,
+		CheckEndpointsImage:  os.Getenv("KUBE_APISERVER_OPERATOR_IMAGE"),
+		Revision:             operatorConfig.Status.LatestAvailableRevision,
+		Verbosity:            loglevelToKlog(operatorConfig.Spec.LogLevel),
+		CheckEndpointsBindIP: checkEndpointsBindIP,
+		Overlays:             overlays,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// we set this so that when the requested image pull spec changes, we always have a diff.  Remember that we don't directly
 	// diff any fields on the deployment because they can be rewritten by admission and we don't want to constantly be fighting
@@ -430,13 +590,14 @@ func manageOpenShiftAPIServerDeployment_v311_00_to_latest(
 	}
 	required.Annotations["openshiftapiservers.operator.openshift.io/pull-spec"] = imagePullSpec
 	required.Annotations["openshiftapiservers.operator.openshift.io/operator-pull-spec"] = operatorImagePullSpec
+	applySizingTier(required, input.tier)
 
 	required.Labels["revision"] = strconv.Itoa(int(operatorConfig.Status.LatestAvailableRevision))
 	required.Spec.Template.Labels["revision"] = strconv.Itoa(int(operatorConfig.Status.LatestAvailableRevision))
 
 	proxyConfig, _, err := unstructured.NestedStringMap(observedConfig, "workloadcontroller", "proxy")
 	if err != nil {
-		return nil, false, fmt.Errorf("couldn't get the proxy config from observedConfig: %v", err)
+		return nil, newStepError(templateConditionType, "InvalidObservedConfig", fmt.Errorf("couldn't get the proxy config from observedConfig: %v", err))
 	}
 
 	proxyEnvVars := proxyMapToEnvVars(proxyConfig)
@@ -448,14 +609,10 @@ func manageOpenShiftAPIServerDeployment_v311_00_to_latest(
 	inputHashes, err := resourcehash.MultipleObjectHashStringMapForObjectReferences(
 		ctx,
 		kubeClient,
-		resourcehash.NewObjectRef().ForConfigMap().InNamespace(operatorclient.TargetNamespace).Named("config"),
-		resourcehash.NewObjectRef().ForSecret().InNamespace(operatorclient.TargetNamespace).Named("etcd-client"),
-		resourcehash.NewObjectRef().ForConfigMap().InNamespace(operatorclient.TargetNamespace).Named("etcd-serving-ca"),
-		resourcehash.NewObjectRef().ForConfigMap().InNamespace(operatorclient.TargetNamespace).Named("image-import-ca"),
-		resourcehash.NewObjectRef().ForConfigMap().InNamespace(operatorclient.TargetNamespace).Named("trusted-ca-bundle"),
+		DeploymentInputs()...,
 	)
 	if err != nil {
-		return nil, false, fmt.Errorf("invalid dependency reference: %q", err)
+		return nil, newStepError(deploymentInputsConditionType, "InvalidDependencyReference", fmt.Errorf("invalid dependency reference: %q", err))
 	}
 	inputHashes["desired.generation"] = fmt.Sprintf("%d", operatorConfig.ObjectMeta.Generation)
 	for k, v := range inputHashes {
@@ -467,18 +624,27 @@ func manageOpenShiftAPIServerDeployment_v311_00_to_latest(
 		required.Spec.Template.Annotations[annotationKey] = v
 	}
 
-	err = ensureAtMostOnePodPerNodeFn(&required.Spec, operatorclient.TargetNamespace)
+	err = input.ensureAtMostOnePodPerNode(&required.Spec, operatorclient.TargetNamespace)
 	if err != nil {
-		return nil, false, fmt.Errorf("unable to ensure at most one pod per node: %v", err)
+		return nil, newStepError(nodeCountConditionType, "PodPlacementFailed", fmt.Errorf("unable to ensure at most one pod per node: %v", err))
 	}
+	applyTopology(&required.Spec, input.topology)
 
 	// Set the replica count to the number of master nodes.
-	masterNodeCount, err := countNodes(required.Spec.Template.Spec.NodeSelector)
+	masterNodeCount, err := input.countNodes(required.Spec.Template.Spec.NodeSelector)
 	if err != nil {
-		return nil, false, fmt.Errorf("failed to determine number of master nodes: %v", err)
+		return nil, newStepError(nodeCountConditionType, "NodeCountUnavailable", fmt.Errorf("failed to determine number of master nodes: %v", err))
 	}
 	required.Spec.Replicas = masterNodeCount
 
+	if input.zones != nil {
+		nodeZones, err := input.zones(required.Spec.Template.Spec.NodeSelector)
+		if err != nil {
+			return nil, newStepError(nodeCountConditionType, "NodeZonesUnavailable", fmt.Errorf("failed to determine the zones of the master nodes: %v", err))
+		}
+		spreadAcrossZones(&required.Spec, nodeZones)
+	}
+
 	if err := kmspluginlifecycle.EnsureKMSPluginSidecarInPodSpec(
 		ctx,
 		&required.Spec.Template.Spec,
@@ -488,11 +654,14 @@ func manageOpenShiftAPIServerDeployment_v311_00_to_latest(
 		"cluster-openshift-apiserver-operator",
 		operatorImagePullSpec,
 		kubeClient.CoreV1(),
-		featureGateAccessor); err != nil {
-		return nil, false, fmt.Errorf("failed to ensure KMS plugin in pod spec: %w", err)
+		input.featureGateAccessor); err != nil {
+		return nil, newStepError(kmsSidecarConditionType, "KMSSidecarInjectionFailed", fmt.Errorf("failed to ensure KMS plugin in pod spec: %w", err))
 	}
 
-	return resourceapply.ApplyDeployment(ctx, client, recorder, required, resourcemerge.ExpectedDeploymentGeneration(required, generationStatus))
+	if err := stampTemplateHash(required); err != nil {
+		return nil, err
+	}
+	return required, nil
 }
 
 var openshiftScheme = runtime.NewScheme()
@@ -503,6 +672,18 @@ func init() {
 	}
 }
 
+// DeploymentInputs returns the resources whose content is hashed into the deployment annotations, so that a change
+// to any of them rolls out new pods.
+func DeploymentInputs() []*resourcehash.ObjectReference {
+	return []*resourcehash.ObjectReference{
+		resourcehash.NewObjectRef().ForConfigMap().InNamespace(operatorclient.TargetNamespace).Named("config"),
+		resourcehash.NewObjectRef().ForSecret().InNamespace(operatorclient.TargetNamespace).Named("etcd-client"),
+		resourcehash.NewObjectRef().ForConfigMap().InNamespace(operatorclient.TargetNamespace).Named("etcd-serving-ca"),
+		resourcehash.NewObjectRef().ForConfigMap().InNamespace(operatorclient.TargetNamespace).Named("image-import-ca"),
+		resourcehash.NewObjectRef().ForConfigMap().InNamespace(operatorclient.TargetNamespace).Named("trusted-ca-bundle"),
+	}
+}
+
 func proxyMapToEnvVars(proxyConfig map[string]string) []corev1.EnvVar {
 	if proxyConfig == nil {
 		return nil
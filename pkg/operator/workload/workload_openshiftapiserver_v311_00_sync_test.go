@@ -2,6 +2,7 @@ package workload
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -10,7 +11,6 @@ import (
 	configv1 "github.com/openshift/api/config/v1"
 	openshiftcontrolplanev1 "github.com/openshift/api/openshiftcontrolplane/v1"
 	operatorv1 "github.com/openshift/api/operator/v1"
-	configfake "github.com/openshift/client-go/config/clientset/versioned/fake"
 	configlistersv1 "github.com/openshift/client-go/config/listers/config/v1"
 	operatorfake "github.com/openshift/client-go/operator/clientset/versioned/fake"
 	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
@@ -39,6 +39,7 @@ func fakeCountNodes(_ map[string]string) (*int32, error) {
 }
 
 func TestOperatorConfigProgressingCondition(t *testing.T) {
+	t.Setenv("KUBE_APISERVER_OPERATOR_IMAGE", "quay.io/openshift/kube-apiserver-operator:latest")
 	testCases := []struct {
 		name                             string
 		operatorConfigGeneration         int64
@@ -104,20 +105,15 @@ func TestOperatorConfigProgressingCondition(t *testing.T) {
 				},
 			}
 			apiServiceOperatorClient := operatorfake.NewSimpleClientset(operatorConfig)
-			openshiftConfigClient := configfake.NewSimpleClientset(
-				&configv1.Image{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}},
-				&configv1.ClusterVersion{ObjectMeta: metav1.ObjectMeta{Name: "version"}},
-			)
-
 			fakeOperatorClient := operatorv1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{}, nil)
 			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
 			indexer.Add(&configv1.ClusterVersion{ObjectMeta: metav1.ObjectMeta{Name: "version"}})
 
 			target := OpenShiftAPIServerWorkload{
+				targetImagePullSpec:       "quay.io/openshift/apiserver:latest",
 				kubeClient:                fakeKubeClient,
 				operatorClient:            fakeOperatorClient,
 				operatorConfigClient:      apiServiceOperatorClient.OperatorV1(),
-				openshiftConfigClient:     openshiftConfigClient.ConfigV1(),
 				clusterVersionLister:      configlistersv1.NewClusterVersionLister(indexer),
 				versionRecorder:           status.NewVersionGetter(),
 				countNodes:                fakeCountNodes,
@@ -343,6 +339,7 @@ func TestCheckEndpointsBindIPFromConfig(t *testing.T) {
 }
 
 func TestCapabilities(t *testing.T) {
+	t.Setenv("KUBE_APISERVER_OPERATOR_IMAGE", "quay.io/openshift/kube-apiserver-operator:latest")
 	testCases := []struct {
 		name                    string
 		knownCapabilities       []configv1.ClusterVersionCapability
@@ -448,21 +445,16 @@ func TestCapabilities(t *testing.T) {
 					},
 				},
 			}
-			openshiftConfigClient := configfake.NewSimpleClientset(
-				&configv1.Image{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}},
-				clusterVersion,
-			)
-
 			fakeOperatorClient := operatorv1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{}, nil)
 
 			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
 			indexer.Add(clusterVersion)
 
 			target := OpenShiftAPIServerWorkload{
+				targetImagePullSpec:       "quay.io/openshift/apiserver:latest",
 				kubeClient:                fakeKubeClient,
 				operatorClient:            fakeOperatorClient,
 				operatorConfigClient:      apiServiceOperatorClient.OperatorV1(),
-				openshiftConfigClient:     openshiftConfigClient.ConfigV1(),
 				clusterVersionLister:      configlistersv1.NewClusterVersionLister(indexer),
 				versionRecorder:           status.NewVersionGetter(),
 				countNodes:                fakeCountNodes,
@@ -542,6 +534,7 @@ func TestCapabilities(t *testing.T) {
 }
 
 func TestCheckEndpointsContainerRendering(t *testing.T) {
+	t.Setenv("KUBE_APISERVER_OPERATOR_IMAGE", "quay.io/openshift/kube-apiserver-operator:latest")
 	testCases := []struct {
 		name              string
 		observedConfig    string
@@ -625,15 +618,6 @@ func TestCheckEndpointsContainerRendering(t *testing.T) {
 					Name: "version",
 				},
 			}
-			openshiftConfigClient := configfake.NewSimpleClientset(
-				&configv1.Image{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "cluster",
-					},
-				},
-				clusterVersion,
-			)
-
 			fakeOperatorClient := operatorv1helpers.NewFakeOperatorClient(
 				&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
 				&operatorv1.OperatorStatus{},
@@ -644,10 +628,10 @@ func TestCheckEndpointsContainerRendering(t *testing.T) {
 			indexer.Add(clusterVersion)
 
 			target := OpenShiftAPIServerWorkload{
+				targetImagePullSpec:       "quay.io/openshift/apiserver:latest",
 				kubeClient:                fakeKubeClient,
 				operatorClient:            fakeOperatorClient,
 				operatorConfigClient:      apiServiceOperatorClient.OperatorV1(),
-				openshiftConfigClient:     openshiftConfigClient.ConfigV1(),
 				clusterVersionLister:      configlistersv1.NewClusterVersionLister(indexer),
 				versionRecorder:           status.NewVersionGetter(),
 				countNodes:                fakeCountNodes,
@@ -698,3 +682,58 @@ func TestCheckEndpointsContainerRendering(t *testing.T) {
 		})
 	}
 }
+
+func TestSyncStepConditions(t *testing.T) {
+	t.Setenv("KUBE_APISERVER_OPERATOR_IMAGE", "quay.io/openshift/kube-apiserver-operator:latest")
+	fakeKubeClient := fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "etcd-client", Namespace: "openshift-apiserver"}},
+	)
+	operatorConfig := &operatorv1.OpenShiftAPIServer{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}}
+	fakeOperatorClient := operatorv1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{
+		Conditions: []operatorv1.OperatorCondition{{Type: kmsSidecarConditionType, Status: operatorv1.ConditionTrue, Reason: "KMSSidecarInjectionFailed"}},
+	}, nil)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(&configv1.ClusterVersion{ObjectMeta: metav1.ObjectMeta{Name: "version"}})
+
+	target := OpenShiftAPIServerWorkload{
+		targetImagePullSpec:  "quay.io/openshift/apiserver:latest",
+		kubeClient:           fakeKubeClient,
+		operatorClient:       fakeOperatorClient,
+		operatorConfigClient: operatorfake.NewSimpleClientset(operatorConfig).OperatorV1(),
+		clusterVersionLister: configlistersv1.NewClusterVersionLister(indexer),
+		versionRecorder:      status.NewVersionGetter(),
+		countNodes: func(_ map[string]string) (*int32, error) {
+			return nil, fmt.Errorf("no nodes cached yet")
+		},
+		ensureAtMostOnePodPerNode: func(spec *appsv1.DeploymentSpec, componentName string) error { return nil },
+		featureGateAccessor:       featuregates.NewHardcodedFeatureGateAccessForTesting(nil, nil, make(chan struct{}), nil),
+	}
+
+	if _, _, errs := target.Sync(context.Background(), factory.NewSyncContext("TestSyncContext", events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(time.Now())))); len(errs) != 0 {
+		t.Fatalf("expected the step error to be reported by its condition only, got %v", errs)
+	}
+
+	_, resultStatus, _, err := fakeOperatorClient.GetOperatorState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		configMapConditionType:        "AsExpected",
+		templateConditionType:         "AsExpected",
+		deploymentInputsConditionType: "AsExpected",
+		nodeCountConditionType:        "NodeCountUnavailable",
+	}
+	for conditionType, reason := range expected {
+		condition := operatorv1helpers.FindOperatorCondition(resultStatus.Conditions, conditionType)
+		if condition == nil {
+			t.Errorf("missing condition %s", conditionType)
+			continue
+		}
+		if condition.Reason != reason || (condition.Status == operatorv1.ConditionTrue) != (reason != "AsExpected") {
+			t.Errorf("unexpected condition %#v", condition)
+		}
+	}
+	if condition := operatorv1helpers.FindOperatorCondition(resultStatus.Conditions, kmsSidecarConditionType); condition == nil || condition.Status != operatorv1.ConditionUnknown || condition.Reason != "PreviousStepFailed" {
+		t.Errorf("expected the step that didn't run to be Unknown, got %#v", condition)
+	}
+}
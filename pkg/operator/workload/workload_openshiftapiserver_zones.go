@@ -0,0 +1,252 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-openshift-apiserver-operator/pkg/operator/operatorclient"
+)
+
+const (
+	// zoneSkewConditionType is informational, an uneven spread is no reason for the ClusterOperator to be Degraded, so
+	// its type has none of the suffixes the ClusterOperator conditions are unioned from.
+	zoneSkewConditionType = "ZoneSkew"
+
+	// podDeletionCostAnnotation makes the replicaset controller scale down pods with a lower cost first.
+	podDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+)
+
+// zonesFunc returns the zones of the nodes matching the node selector.
+type zonesFunc func(nodeSelector map[string]string) ([]string, error)
+
+// ZoneSpread spreads the openshift-apiserver pods across the zones of the master nodes, orders rollouts so that pods
+// of the same zone don't go down back to back and reports when the pods are unevenly spread.
+type ZoneSpread struct {
+	nodeLister corev1listers.NodeLister
+	podLister  corev1listers.PodLister
+	podsGetter corev1client.PodsGetter
+}
+
+// NewZoneSpread returns a ZoneSpread for the pods in the target namespace.
+func NewZoneSpread(kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces, podsGetter corev1client.PodsGetter) *ZoneSpread {
+	return &ZoneSpread{
+		nodeLister: kubeInformersForNamespaces.InformersFor("").Core().V1().Nodes().Lister(),
+		podLister:  kubeInformersForNamespaces.InformersFor(operatorclient.TargetNamespace).Core().V1().Pods().Lister(),
+		podsGetter: podsGetter,
+	}
+}
+
+// zones returns the sorted zones of the nodes matching the node selector.
+func (z *ZoneSpread) zones(nodeSelector map[string]string) ([]string, error) {
+	nodes, err := z.nodeLister.List(labels.SelectorFromSet(nodeSelector))
+	if err != nil {
+		return nil, err
+	}
+	zones := sets.NewString()
+	for _, node := range nodes {
+		if zone := node.Labels[corev1.LabelTopologyZone]; len(zone) > 0 {
+			zones.Insert(zone)
+		}
+	}
+	return zones.List(), nil
+}
+
+// spreadAcrossZones adds a topology spread constraint across zones when the pods can land in more than one.
+func spreadAcrossZones(spec *appsv1.DeploymentSpec, zones []string) {
+	if len(zones) < 2 {
+		return
+	}
+	spec.Template.Spec.TopologySpreadConstraints = append(spec.Template.Spec.TopologySpreadConstraints, corev1.TopologySpreadConstraint{
+		MaxSkew:     1,
+		TopologyKey: corev1.LabelTopologyZone,
+		// a zone outage must not leave the replacement pods unschedulable
+		WhenUnsatisfiable: corev1.ScheduleAnyway,
+		LabelSelector:     spec.Selector.DeepCopy(),
+		// spread the pods of each pod template on their own
+		MatchLabelKeys: []string{appsv1.DefaultDeploymentUniqueLabelKey},
+	})
+}
+
+// order sets the deletion cost of the pods still running an old pod template, so that the next pod the rollout takes
+// down is in a different zone than the last one. Pods are replaced on the node they ran on, so the zone of the newest
+// pod of the current pod template is the zone that went down last.
+func (z *ZoneSpread) order(ctx context.Context, deployment *appsv1.Deployment, recorder events.Recorder) error {
+	pods, err := z.pods(deployment)
+	if err != nil {
+		return err
+	}
+	hash := deployment.Spec.Template.Annotations[templateHashAnnotation]
+
+	var newest *corev1.Pod
+	old := []*corev1.Pod{}
+	for _, pod := range pods {
+		if pod.Annotations[templateHashAnnotation] != hash {
+			old = append(old, pod)
+			continue
+		}
+		if newest == nil || newest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			newest = pod
+		}
+	}
+	if newest == nil || len(old) == 0 {
+		return nil
+	}
+	lastZone, err := z.zoneOf(newest)
+	if err != nil || len(lastZone) == 0 {
+		return err
+	}
+
+	for _, pod := range old {
+		zone, err := z.zoneOf(pod)
+		if err != nil {
+			return err
+		}
+		cost := "0"
+		if zone == lastZone {
+			cost = "1"
+		}
+		if pod.Annotations[podDeletionCostAnnotation] == cost {
+			continue
+		}
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, podDeletionCostAnnotation, cost)
+		if _, err := z.podsGetter.Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		recorder.Eventf("PodDeletionCostUpdated", "Set the deletion cost of pod %s in zone %q to %s, the last pod replaced was in zone %q", pod.Name, zone, cost, lastZone)
+	}
+	return nil
+}
+
+// skewCondition reports when the available pods of a completed rollout are spread unevenly across the zones. A zone
+// only counts as lacking pods while it has schedulable master nodes without one, the pods run at most one per node,
+// so an uneven layout of the master nodes across the zones is not reported.
+func (z *ZoneSpread) skewCondition(deployment *appsv1.Deployment) (operatorv1.OperatorCondition, error) {
+	condition := operatorv1.OperatorCondition{Type: zoneSkewConditionType, Status: operatorv1.ConditionFalse, Reason: "AsExpected"}
+
+	zones, err := z.zones(deployment.Spec.Template.Spec.NodeSelector)
+	if err != nil {
+		return condition, err
+	}
+	if len(zones) < 2 {
+		condition.Reason = "SingleZone"
+		return condition, nil
+	}
+	// pods move between zones during a rollout
+	if !deploymentAvailable(deployment) {
+		return condition, nil
+	}
+
+	schedulable, err := z.schedulableNodes(deployment.Spec.Template.Spec.NodeSelector)
+	if err != nil {
+		return condition, err
+	}
+	pods, err := z.pods(deployment)
+	if err != nil {
+		return condition, err
+	}
+	perZone := map[string]int{}
+	for _, zone := range zones {
+		perZone[zone] = 0
+	}
+	for _, pod := range pods {
+		if !podReady(pod) {
+			continue
+		}
+		zone, err := z.zoneOf(pod)
+		if err != nil {
+			return condition, err
+		}
+		if _, ok := perZone[zone]; ok {
+			perZone[zone]++
+		}
+	}
+
+	// min is the fewest pods of a zone with room for another pod
+	min, max := -1, 0
+	counts := []string{}
+	for _, zone := range zones {
+		count := perZone[zone]
+		if count < schedulable[zone] && (min < 0 || count < min) {
+			min = count
+		}
+		if count > max {
+			max = count
+		}
+		counts = append(counts, fmt.Sprintf("%s=%d/%d", zone, count, schedulable[zone]))
+	}
+	if min >= 0 && max-min > 1 {
+		condition.Status = operatorv1.ConditionTrue
+		condition.Reason = "ZonesUnbalanced"
+		condition.Message = fmt.Sprintf("available pods per zone differ by %d while zones have schedulable master nodes left (available pods/schedulable master nodes): %s", max-min, strings.Join(counts, ", "))
+	}
+	return condition, nil
+}
+
+// schedulableNodes returns the number of schedulable nodes matching the node selector by zone.
+func (z *ZoneSpread) schedulableNodes(nodeSelector map[string]string) (map[string]int, error) {
+	nodes, err := z.nodeLister.List(labels.SelectorFromSet(nodeSelector))
+	if err != nil {
+		return nil, err
+	}
+	schedulable := map[string]int{}
+	for _, node := range nodes {
+		if !node.Spec.Unschedulable {
+			schedulable[node.Labels[corev1.LabelTopologyZone]]++
+		}
+	}
+	return schedulable, nil
+}
+
+// pods returns the pods of the deployment sorted by name.
+func (z *ZoneSpread) pods(deployment *appsv1.Deployment) ([]*corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := z.podLister.Pods(deployment.Namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+// zoneOf returns the zone of the node the pod runs on, or an empty string when it is not scheduled.
+func (z *ZoneSpread) zoneOf(pod *corev1.Pod) (string, error) {
+	if len(pod.Spec.NodeName) == 0 {
+		return "", nil
+	}
+	node, err := z.nodeLister.Get(pod.Spec.NodeName)
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return node.Labels[corev1.LabelTopologyZone], nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package workload
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+)
+
+func TestSpreadAcrossZones(t *testing.T) {
+	spec := &appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"apiserver": "true"}}}
+	spreadAcrossZones(spec, []string{"a"})
+	if len(spec.Template.Spec.TopologySpreadConstraints) != 0 {
+		t.Fatalf("expected no spread constraint for a single zone")
+	}
+	spreadAcrossZones(spec, []string{"a", "b", "c"})
+	constraints := spec.Template.Spec.TopologySpreadConstraints
+	if len(constraints) != 1 || constraints[0].TopologyKey != corev1.LabelTopologyZone || constraints[0].MaxSkew != 1 {
+		t.Fatalf("unexpected spread constraints %#v", constraints)
+	}
+	if constraints[0].LabelSelector.MatchLabels["apiserver"] != "true" {
+		t.Errorf("expected the constraint to select the pods of the deployment")
+	}
+}
+
+func TestZoneSpread(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	newNode := func(name, zone string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"node-role.kubernetes.io/master": "", corev1.LabelTopologyZone: zone},
+		}}
+	}
+	newPod := func(name, node, hash string, created time.Duration, ready bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "openshift-apiserver",
+				Name:              name,
+				Labels:            map[string]string{"apiserver": "true"},
+				Annotations:       map[string]string{templateHashAnnotation: hash},
+				CreationTimestamp: metav1.NewTime(start.Add(created)),
+			},
+			Spec:   corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}},
+		}
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-apiserver", Name: "apiserver", Generation: 2},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](3),
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"apiserver": "true"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{templateHashAnnotation: "new"}},
+				Spec:       corev1.PodSpec{NodeSelector: map[string]string{"node-role.kubernetes.io/master": ""}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3},
+	}
+	nodes := []*corev1.Node{newNode("master-0", "zone-a"), newNode("master-1", "zone-a"), newNode("master-2", "zone-b"), newNode("master-3", "zone-c")}
+
+	zoneSpread := func(nodes []*corev1.Node, pods ...*corev1.Pod) (*ZoneSpread, *fake.Clientset) {
+		nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, node := range nodes {
+			nodeIndexer.Add(node)
+		}
+		podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		objects := []runtime.Object{}
+		for _, pod := range pods {
+			podIndexer.Add(pod)
+			objects = append(objects, pod)
+		}
+		kubeClient := fake.NewSimpleClientset(objects...)
+		return &ZoneSpread{
+			nodeLister: corev1listers.NewNodeLister(nodeIndexer),
+			podLister:  corev1listers.NewPodLister(podIndexer),
+			podsGetter: kubeClient.CoreV1(),
+		}, kubeClient
+	}
+
+	t.Run("zones", func(t *testing.T) {
+		z, _ := zoneSpread(nodes)
+		zones, err := z.zones(map[string]string{"node-role.kubernetes.io/master": ""})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(zones, ",") != "zone-a,zone-b,zone-c" {
+			t.Errorf("unexpected zones %v", zones)
+		}
+	})
+
+	t.Run("order", func(t *testing.T) {
+		z, kubeClient := zoneSpread(nodes,
+			newPod("apiserver-new", "master-0", "new", time.Minute, true),
+			newPod("apiserver-old-a", "master-1", "old", 0, true),
+			newPod("apiserver-old-b", "master-2", "old", 0, true),
+		)
+		if err := z.order(context.Background(), deployment, events.NewInMemoryRecorder("", clocktesting.NewFakePassiveClock(start))); err != nil {
+			t.Fatal(err)
+		}
+		costs := map[string]string{}
+		for _, name := range []string{"apiserver-old-a", "apiserver-old-b"} {
+			pod, err := kubeClient.CoreV1().Pods("openshift-apiserver").Get(context.Background(), name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			costs[name] = pod.Annotations[podDeletionCostAnnotation]
+		}
+		if costs["apiserver-old-a"] != "1" || costs["apiserver-old-b"] != "0" {
+			t.Errorf("expected the old pod in the zone replaced last to be deleted last, got %v", costs)
+		}
+	})
+
+	tests := []struct {
+		name              string
+		nodes             []*corev1.Node
+		pods              []*corev1.Pod
+		expectStatus      operatorv1.ConditionStatus
+		expectMessagePart string
+	}{
+		{
+			name: "balanced",
+			pods: []*corev1.Pod{
+				newPod("apiserver-0", "master-0", "new", 0, true),
+				newPod("apiserver-1", "master-2", "new", 0, true),
+				newPod("apiserver-2", "master-3", "new", 0, true),
+			},
+			expectStatus: operatorv1.ConditionFalse,
+		},
+		{
+			name: "unbalanced",
+			pods: []*corev1.Pod{
+				newPod("apiserver-0", "master-0", "new", 0, true),
+				newPod("apiserver-1", "master-1", "new", 0, true),
+				newPod("apiserver-2", "master-2", "new", 0, false),
+			},
+			expectStatus:      operatorv1.ConditionTrue,
+			expectMessagePart: "zone-a=2/2, zone-b=0/1, zone-c=0/1",
+		},
+		{
+			name:  "uneven master nodes",
+			nodes: append([]*corev1.Node{newNode("master-4", "zone-a")}, nodes...),
+			pods: []*corev1.Pod{
+				newPod("apiserver-0", "master-0", "new", 0, true),
+				newPod("apiserver-1", "master-1", "new", 0, true),
+				newPod("apiserver-2", "master-2", "new", 0, true),
+				newPod("apiserver-3", "master-3", "new", 0, true),
+				newPod("apiserver-4", "master-4", "new", 0, true),
+			},
+			expectStatus: operatorv1.ConditionFalse,
+		},
+		{
+			name: "unschedulable master nodes",
+			nodes: []*corev1.Node{
+				newNode("master-0", "zone-a"),
+				newNode("master-1", "zone-a"),
+				{ObjectMeta: newNode("master-2", "zone-b").ObjectMeta, Spec: corev1.NodeSpec{Unschedulable: true}},
+				{ObjectMeta: newNode("master-3", "zone-c").ObjectMeta, Spec: corev1.NodeSpec{Unschedulable: true}},
+			},
+			pods: []*corev1.Pod{
+				newPod("apiserver-0", "master-0", "new", 0, true),
+				newPod("apiserver-1", "master-1", "new", 0, true),
+			},
+			expectStatus: operatorv1.ConditionFalse,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nodes := nodes
+			if tc.nodes != nil {
+				nodes = tc.nodes
+			}
+			z, _ := zoneSpread(nodes, tc.pods...)
+			condition, err := z.skewCondition(deployment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if condition.Type != zoneSkewConditionType || condition.Status != tc.expectStatus {
+				t.Errorf("unexpected condition %#v", condition)
+			}
+			if !strings.Contains(condition.Message, tc.expectMessagePart) {
+				t.Errorf("expected message to contain %q, got %q", tc.expectMessagePart, condition.Message)
+			}
+		})
+	}
+}